@@ -6,7 +6,7 @@ import (
 	. "github.com/k0923/go/json"
 )
 
-var _ Condition[any] = (*ArrayCondition[any])(nil)
+var _ ScopedCondition[any] = (*ArrayCondition[any])(nil)
 
 type ArrayCondition[T any] struct {
 	X   G[Picker[T, []T]] `json:"x"`
@@ -14,23 +14,49 @@ type ArrayCondition[T any] struct {
 	Y   G[Condition[T]]   `json:"y"`
 }
 
+func (cond *ArrayCondition[T]) Operators() []string {
+	return []string{"any", "all"}
+}
+
 func (cond *ArrayCondition[T]) Match(data T) (bool, error) {
+	return cond.MatchScope(nil, data)
+}
+
+func (cond *ArrayCondition[T]) MatchScope(scope *Scope[T], data T) (bool, error) {
 	if cond.Y.Value() == nil {
-		return false, fmt.Errorf("y condition is nil")
+		return false, newEvalError(cond, cond.Opt, nil, fmt.Errorf("y %w", ErrNilOperand))
 	}
 	var x []T = nil
 	var err error
 	if cond.X.Value() != nil {
-		x, err = cond.X.Value().Pick(data)
+		x, err = pickIn(scope, cond.X.Value(), data)
+		if err != nil {
+			return scope.pickFailed(locate(err, "x", cond.X.Value()))
+		}
+	}
+
+	// every item is a record of its own, so it gets its own picker cache
+	var itemScope *Scope[T]
+	if scope != nil {
+		itemScope = scope.child()
+	}
+	matchItem := func(i int, item T) (bool, error) {
+		if itemScope != nil {
+			itemScope.reset()
+		}
+		mark := itemScope.pending()
+		result, err := matchIn(itemScope, cond.Y.Value(), item)
+		itemScope.locateFailed(mark, "y[%d]", i)
 		if err != nil {
-			return false, err
+			return false, locate(err, fmt.Sprintf("y[%d]", i), cond.Y.Value())
 		}
+		return result, nil
 	}
 
 	switch cond.Opt {
 	case "any":
-		for _, item := range x {
-			result, err := cond.Y.Value().Match(item)
+		for i, item := range x {
+			result, err := matchItem(i, item)
 			if err != nil {
 				return false, err
 			}
@@ -40,8 +66,8 @@ func (cond *ArrayCondition[T]) Match(data T) (bool, error) {
 		}
 		return false, nil
 	case "all":
-		for _, item := range x {
-			result, err := cond.Y.Value().Match(item)
+		for i, item := range x {
+			result, err := matchItem(i, item)
 			if err != nil {
 				return false, err
 			}
@@ -51,7 +77,7 @@ func (cond *ArrayCondition[T]) Match(data T) (bool, error) {
 		}
 		return true, nil
 	default:
-		return false, fmt.Errorf("invalid operator: %v", cond.Opt)
+		return false, newEvalError(cond, cond.Opt, nil, ErrInvalidOperator)
 	}
 
 }
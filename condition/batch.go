@@ -0,0 +1,301 @@
+package condition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+type BatchOptions struct {
+	// Workers bounds the number of goroutines evaluating records,
+	// defaults to GOMAXPROCS.
+	Workers int
+	// ChunkSize is the number of records handed to a worker at once.
+	ChunkSize int
+	// CollectErrors keeps evaluating when a record fails: the failed record
+	// is left out of the results and reported in a *BatchError. Otherwise
+	// the batch fails with the *RecordError of the first failed record in
+	// input order, whatever the workers.
+	CollectErrors bool
+	// ScopeOptions, when not nil, gives every worker its own Scope so picker
+	// results are memoized per record.
+	ScopeOptions []ScopeOption
+}
+
+type BatchOption func(opt *BatchOptions)
+
+func WithWorkers(workers int) BatchOption {
+	return func(opt *BatchOptions) { opt.Workers = workers }
+}
+
+func WithChunkSize(size int) BatchOption {
+	return func(opt *BatchOptions) { opt.ChunkSize = size }
+}
+
+func WithCollectErrors() BatchOption {
+	return func(opt *BatchOptions) { opt.CollectErrors = true }
+}
+
+func WithBatchScope(opts ...ScopeOption) BatchOption {
+	return func(opt *BatchOptions) { opt.ScopeOptions = append(make([]ScopeOption, 0, len(opts)), opts...) }
+}
+
+// RecordError is the failure of the record at Index of the input.
+type RecordError struct {
+	Index int
+	Err   error
+}
+
+func (err *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", err.Index, err.Err)
+}
+
+func (err *RecordError) Unwrap() error {
+	return err.Err
+}
+
+// BatchError collects the record errors of a batch run with WithCollectErrors,
+// ordered by record index.
+type BatchError struct {
+	Errors []*RecordError
+}
+
+func (err *BatchError) Error() string {
+	if len(err.Errors) == 1 {
+		return err.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d records failed, first: %v", len(err.Errors), err.Errors[0])
+}
+
+func (err *BatchError) Unwrap() []error {
+	result := make([]error, len(err.Errors))
+	for i, e := range err.Errors {
+		result[i] = e
+	}
+	return result
+}
+
+// Filter returns the records of seq matching cond, in input order.
+func Filter[T any](ctx context.Context, cond Condition[T], seq iter.Seq[T], opts ...BatchOption) ([]T, error) {
+	result := make([]T, 0)
+	err := runBatch(ctx, cond, seq, opts, func(item T, matched bool) {
+		if matched {
+			result = append(result, item)
+		}
+	})
+	if err != nil && !isBatchError(err) {
+		return nil, err
+	}
+	return result, err
+}
+
+func FilterSlice[T any](ctx context.Context, cond Condition[T], data []T, opts ...BatchOption) ([]T, error) {
+	return Filter(ctx, cond, slices.Values(data), opts...)
+}
+
+// Partition splits the records of seq into those matching cond and the rest,
+// both in input order.
+func Partition[T any](ctx context.Context, cond Condition[T], seq iter.Seq[T], opts ...BatchOption) ([]T, []T, error) {
+	matched := make([]T, 0)
+	unmatched := make([]T, 0)
+	err := runBatch(ctx, cond, seq, opts, func(item T, ok bool) {
+		if ok {
+			matched = append(matched, item)
+		} else {
+			unmatched = append(unmatched, item)
+		}
+	})
+	if err != nil && !isBatchError(err) {
+		return nil, nil, err
+	}
+	return matched, unmatched, err
+}
+
+func PartitionSlice[T any](ctx context.Context, cond Condition[T], data []T, opts ...BatchOption) ([]T, []T, error) {
+	return Partition(ctx, cond, slices.Values(data), opts...)
+}
+
+// Count returns the number of records of seq matching cond.
+func Count[T any](ctx context.Context, cond Condition[T], seq iter.Seq[T], opts ...BatchOption) (int, error) {
+	count := 0
+	err := runBatch(ctx, cond, seq, opts, func(item T, matched bool) {
+		if matched {
+			count++
+		}
+	})
+	if err != nil && !isBatchError(err) {
+		return 0, err
+	}
+	return count, err
+}
+
+func CountSlice[T any](ctx context.Context, cond Condition[T], data []T, opts ...BatchOption) (int, error) {
+	return Count(ctx, cond, slices.Values(data), opts...)
+}
+
+func isBatchError(err error) bool {
+	var batchErr *BatchError
+	return errors.As(err, &batchErr)
+}
+
+type chunk[T any] struct {
+	start   int
+	items   []T
+	matched []bool
+	errs    []*RecordError
+}
+
+// firstFailure keeps the failed record of the lowest index when a batch
+// stops at the first error: the records after it need not be evaluated, but
+// the ones before it still do, since one of them may fail first.
+type firstFailure struct {
+	mu    sync.Mutex
+	err   *RecordError
+	index atomic.Int64
+}
+
+func newFirstFailure() *firstFailure {
+	f := &firstFailure{}
+	f.index.Store(math.MaxInt64)
+	return f
+}
+
+// after reports whether a record before index failed.
+func (f *firstFailure) after(index int) bool {
+	return int64(index) > f.index.Load()
+}
+
+func (f *firstFailure) record(err *RecordError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil || err.Index < f.err.Index {
+		f.err = err
+		f.index.Store(int64(err.Index))
+	}
+}
+
+func (c *chunk[T]) eval(ctx context.Context, cond Condition[T], scope *Scope[T], collect bool, failed *firstFailure) {
+	c.matched = make([]bool, len(c.items))
+	for i, item := range c.items {
+		if ctx.Err() != nil || !collect && failed.after(c.start+i) {
+			return
+		}
+		var ok bool
+		var err error
+		if scope != nil {
+			ok, err = scope.Match(cond, item)
+		} else {
+			ok, err = cond.Match(item)
+		}
+		if err != nil {
+			recordErr := &RecordError{Index: c.start + i, Err: err}
+			if !collect {
+				failed.record(recordErr)
+				return
+			}
+			c.errs = append(c.errs, recordErr)
+			continue
+		}
+		c.matched[i] = ok
+	}
+}
+
+// runBatch evaluates cond over seq with a bounded worker pool and calls visit
+// for every successfully evaluated record in input order. seq is consumed by
+// the calling goroutine only.
+func runBatch[T any](ctx context.Context, cond Condition[T], seq iter.Seq[T], opts []BatchOption, visit func(item T, matched bool)) error {
+	if cond == nil {
+		return fmt.Errorf("condition is nil")
+	}
+	opt := BatchOptions{
+		Workers:   runtime.GOMAXPROCS(0),
+		ChunkSize: 64,
+	}
+	for _, f := range opts {
+		f(&opt)
+	}
+	if opt.Workers < 1 {
+		opt.Workers = 1
+	}
+	if opt.ChunkSize < 1 {
+		opt.ChunkSize = 1
+	}
+
+	failed := newFirstFailure()
+	jobs := make(chan *chunk[T])
+	var wg sync.WaitGroup
+	for range opt.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var scope *Scope[T]
+			if opt.ScopeOptions != nil {
+				scope = NewScope[T](opt.ScopeOptions...)
+			}
+			for c := range jobs {
+				c.eval(ctx, cond, scope, opt.CollectErrors, failed)
+			}
+		}()
+	}
+
+	chunks := make([]*chunk[T], 0)
+	send := func(c *chunk[T]) bool {
+		select {
+		case jobs <- c:
+			chunks = append(chunks, c)
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	index := 0
+	current := &chunk[T]{start: 0, items: make([]T, 0, opt.ChunkSize)}
+	for item := range seq {
+		if ctx.Err() != nil || failed.after(index) {
+			break
+		}
+		index++
+		current.items = append(current.items, item)
+		if len(current.items) == opt.ChunkSize {
+			if !send(current) {
+				break
+			}
+			current = &chunk[T]{start: index, items: make([]T, 0, opt.ChunkSize)}
+		}
+	}
+	if len(current.items) > 0 && ctx.Err() == nil && !failed.after(current.start) {
+		send(current)
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	if failed.err != nil {
+		return failed.err
+	}
+
+	var errs []*RecordError
+	for _, c := range chunks {
+		next := 0
+		for i, item := range c.items {
+			if next < len(c.errs) && c.errs[next].Index == c.start+i {
+				next++
+				continue
+			}
+			visit(item, c.matched[i])
+		}
+		errs = append(errs, c.errs...)
+	}
+	if len(errs) > 0 {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
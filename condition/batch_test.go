@@ -0,0 +1,98 @@
+package condition
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/k0923/go/json"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type pricePicker struct{}
+
+func (pricePicker) Pick(from record) (float64, error) {
+	v, ok := from["price"].(float64)
+	if !ok {
+		return 0, errors.New("price is missing")
+	}
+	return v, nil
+}
+
+func TestBatch(t *testing.T) {
+	cond := &NumberCondition[record, float64]{
+		X:   NG[Picker[record, float64]](pricePicker{}),
+		Opt: "ge",
+		Y:   NG[Picker[record, float64]](ConstFloatPicker[record](50)),
+	}
+	data := make([]record, 1000)
+	for i := range data {
+		data[i] = record{"price": float64(i % 100)}
+	}
+
+	Convey("filter keeps input order", t, func() {
+		result, err := FilterSlice(context.Background(), cond, data, WithWorkers(4), WithChunkSize(7))
+		So(err, ShouldBeNil)
+		So(len(result), ShouldEqual, 500)
+		So(result[0]["price"], ShouldEqual, 50.0)
+		So(result[49]["price"], ShouldEqual, 99.0)
+		So(result[50]["price"], ShouldEqual, 50.0)
+	})
+
+	Convey("partition and count", t, func() {
+		matched, unmatched, err := PartitionSlice(context.Background(), cond, data, WithBatchScope())
+		So(err, ShouldBeNil)
+		So(len(matched), ShouldEqual, 500)
+		So(len(unmatched), ShouldEqual, 500)
+		So(unmatched[1]["price"], ShouldEqual, 1.0)
+
+		count, err := CountSlice(context.Background(), cond, data)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 500)
+	})
+
+	broken := append([]record{}, data...)
+	broken[10] = record{}
+	broken[550] = record{}
+
+	Convey("first error aborts the batch", t, func() {
+		result, err := FilterSlice(context.Background(), cond, broken, WithWorkers(1))
+		So(result, ShouldBeNil)
+		var recordErr *RecordError
+		So(errors.As(err, &recordErr), ShouldBeTrue)
+		So(recordErr.Index, ShouldEqual, 10)
+	})
+
+	Convey("the first error is the one of the lowest index", t, func() {
+		broken := append([]record{}, data...)
+		for _, i := range []int{3, 97, 98, 400, 401, 999} {
+			broken[i] = record{}
+		}
+		for range 20 {
+			_, err := CountSlice(context.Background(), cond, broken, WithWorkers(4), WithChunkSize(1))
+			var recordErr *RecordError
+			So(errors.As(err, &recordErr), ShouldBeTrue)
+			So(recordErr.Index, ShouldEqual, 3)
+			_, err = FilterSlice(context.Background(), cond, broken[50:], WithWorkers(4), WithChunkSize(5))
+			So(errors.As(err, &recordErr), ShouldBeTrue)
+			So(recordErr.Index, ShouldEqual, 47)
+		}
+	})
+
+	Convey("collected errors skip the failed records", t, func() {
+		count, err := CountSlice(context.Background(), cond, broken, WithCollectErrors(), WithChunkSize(3))
+		So(count, ShouldEqual, 499)
+		var batchErr *BatchError
+		So(errors.As(err, &batchErr), ShouldBeTrue)
+		So(len(batchErr.Errors), ShouldEqual, 2)
+		So(batchErr.Errors[0].Index, ShouldEqual, 10)
+		So(batchErr.Errors[1].Index, ShouldEqual, 550)
+	})
+
+	Convey("cancelled context stops the batch", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := CountSlice(ctx, cond, data)
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+	})
+}
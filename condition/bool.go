@@ -1,13 +1,11 @@
 package condition
 
 import (
-	"fmt"
-
 	. "github.com/k0923/go/json"
 )
 
 var _ Picker[any, bool] = (*ConstBoolPicker[any])(nil)
-var _ Condition[any] = (*BoolCondition[any])(nil)
+var _ ScopedCondition[any] = (*BoolCondition[any])(nil)
 
 type BoolCondition[T any] struct {
 	X   G[Picker[T, bool]] `json:"x"`
@@ -15,27 +13,35 @@ type BoolCondition[T any] struct {
 	Y   G[Picker[T, bool]] `json:"y"`
 }
 
+func (n *BoolCondition[T]) Operators() []string {
+	return []string{"eq"}
+}
+
 func (n *BoolCondition[T]) Match(data T) (bool, error) {
+	return n.MatchScope(nil, data)
+}
+
+func (n *BoolCondition[T]) MatchScope(scope *Scope[T], data T) (bool, error) {
 	var x bool = false
 	var y bool = false
 	var err error
 	if n.X.Value() != nil {
-		x, err = n.X.Value().Pick(data)
+		x, err = pickIn(scope, n.X.Value(), data)
 		if err != nil {
-			return false, err
+			return scope.pickFailed(locate(err, "x", n.X.Value()))
 		}
 	}
 	if n.Y.Value() != nil {
-		y, err = n.Y.Value().Pick(data)
+		y, err = pickIn(scope, n.Y.Value(), data)
 		if err != nil {
-			return false, err
+			return scope.pickFailed(locate(err, "y", n.Y.Value()))
 		}
 	}
 	switch n.Opt {
 	case "eq":
 		return x == y, nil
 	default:
-		return false, fmt.Errorf("invalid operator: %v", n.Opt)
+		return false, newEvalError(n, n.Opt, map[string]any{"x": x, "y": y}, ErrInvalidOperator)
 	}
 }
 
@@ -9,3 +9,9 @@ type Condition[T any] interface {
 type Picker[T any, E any] interface {
 	Pick(from T) (E, error)
 }
+
+// OperatorLister is implemented by nodes with an opt field and lists the
+// operators the node accepts.
+type OperatorLister interface {
+	Operators() []string
+}
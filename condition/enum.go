@@ -7,26 +7,36 @@ import (
 	. "github.com/k0923/go/json"
 )
 
+var _ ScopedCondition[any] = (*EnumCondition[any, string])(nil)
+
 type EnumCondition[T any, E string | float64 | int] struct {
 	X   G[Picker[T, E]]   `json:"x"`
 	Opt string            `json:"opt"`
 	Y   G[Picker[T, []E]] `json:"y"`
 }
 
+func (n *EnumCondition[T, E]) Operators() []string {
+	return []string{"in", "not_in"}
+}
+
 func (n *EnumCondition[T, E]) Match(data T) (bool, error) {
+	return n.MatchScope(nil, data)
+}
+
+func (n *EnumCondition[T, E]) MatchScope(scope *Scope[T], data T) (bool, error) {
 	if n.X.Value() == nil {
-		return false, fmt.Errorf("x condition is nil")
+		return false, newEvalError(n, n.Opt, nil, fmt.Errorf("x %w", ErrNilOperand))
 	}
 	if n.Y.Value() == nil {
-		return false, fmt.Errorf("y condition is nil")
+		return false, newEvalError(n, n.Opt, nil, fmt.Errorf("y %w", ErrNilOperand))
 	}
-	x, err := n.X.Value().Pick(data)
+	x, err := pickIn(scope, n.X.Value(), data)
 	if err != nil {
-		return false, err
+		return scope.pickFailed(locate(err, "x", n.X.Value()))
 	}
-	y, err := n.Y.Value().Pick(data)
+	y, err := pickIn(scope, n.Y.Value(), data)
 	if err != nil {
-		return false, err
+		return scope.pickFailed(locate(err, "y", n.Y.Value()))
 	}
 	switch n.Opt {
 	case "in":
@@ -34,6 +44,6 @@ func (n *EnumCondition[T, E]) Match(data T) (bool, error) {
 	case "not_in":
 		return !slices.Contains(y, x), nil
 	default:
-		return false, fmt.Errorf("invalid operator: %v", n.Opt)
+		return false, newEvalError(n, n.Opt, map[string]any{"x": x, "y": y}, ErrInvalidOperator)
 	}
 }
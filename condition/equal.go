@@ -0,0 +1,234 @@
+package condition
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+
+	. "github.com/k0923/go/json"
+)
+
+// Unordered is implemented by nodes holding lists whose element order does
+// not change the result, like the conditions of an and/or group or the values
+// of an enum. It returns the json keys of those lists; a node that is a list
+// itself returns nil.
+type Unordered interface {
+	UnorderedFields() []string
+}
+
+func (g *GroupCondition[T]) UnorderedFields() []string {
+	return []string{"Conditions"}
+}
+
+func (c ConstEnumPicker[T, E]) UnorderedFields() []string {
+	return nil
+}
+
+// Canonical returns the canonical JSON of a condition or picker: object keys
+// are sorted (as SortJSON does), numbers are normalized and unordered lists
+// are sorted by the canonical JSON of their elements. Node must be an
+// interface type bound with xjson.Bind.
+func Canonical[I any](node I) ([]byte, error) {
+	data, err := json.Marshal(NG(node))
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	value, err := canonicalBound(reflect.TypeFor[I](), raw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// Equal reports whether a and b are structurally equal conditions or pickers,
+// ignoring the order of unordered lists. Nodes that cannot be marshalled are
+// compared with reflect.DeepEqual.
+func Equal[I any](a, b I) bool {
+	x, err := Canonical(a)
+	if err != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	y, err := Canonical(b)
+	if err != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return bytes.Equal(x, y)
+}
+
+// Hash returns the hex encoded SHA-256 of the canonical JSON of node, so
+// structurally equal nodes share the same hash.
+func Hash[I any](node I) (string, error) {
+	data, err := Canonical(node)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalBound normalizes the json of a value bound to interface iface,
+// following the type field to the registered concrete type.
+func canonicalBound(iface reflect.Type, raw any) (any, error) {
+	binding, ok := LookupBinding(iface)
+	obj, isObj := raw.(map[string]any)
+	if !ok || !isObj || binding.Layout == LayoutCustom {
+		return canonicalValue(nil, raw, false)
+	}
+	typeName, _ := obj[binding.TypeKey].(string)
+	typ := binding.Types[typeName]
+	if typ == nil {
+		return nil, fmt.Errorf("type alias '%s' is not registered for %v", typeName, iface)
+	}
+	if binding.Layout == LayoutFlat {
+		data := make(map[string]any, len(obj))
+		for k, v := range obj {
+			if k != binding.TypeKey {
+				data[k] = v
+			}
+		}
+		value, err := canonicalValue(typ, data, false)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := value.(map[string]any); ok {
+			m[binding.TypeKey] = typeName
+		}
+		return value, nil
+	}
+	value, err := canonicalValue(typ, obj[binding.ValueKey], false)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		binding.TypeKey:  typeName,
+		binding.ValueKey: value,
+	}, nil
+}
+
+// canonicalNumber spells equal numbers alike, e.g. 100, 100.0 and 1e2 are
+// 100. Integers are kept exact, beyond the 53 bits of a float64; fractions
+// are compared as float64.
+func canonicalNumber(n json.Number) json.Number {
+	f, err := n.Float64()
+	if err != nil {
+		return n
+	}
+	if f == 0 {
+		return "0"
+	}
+	if f == math.Trunc(f) {
+		// f is finite, so the exponent of n is bounded by its length
+		if r, ok := new(big.Rat).SetString(string(n)); ok && r.IsInt() {
+			return json.Number(r.Num().String())
+		}
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// canonicalValue normalizes raw json decoded for a value of typ, typ may be
+// nil when unknown.
+func canonicalValue(typ reflect.Type, raw any, unordered bool) (any, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	if typ != nil {
+		if inner, ok := boundType(typ); ok {
+			return canonicalBound(inner, raw)
+		}
+		if inner, ok := optionalType(typ); ok {
+			return canonicalValue(inner, raw, unordered)
+		}
+		for typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+	}
+
+	switch data := raw.(type) {
+	case json.Number:
+		return canonicalNumber(data), nil
+	case []any:
+		var elem reflect.Type
+		if typ != nil && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) {
+			elem = typ.Elem()
+			if u, ok := instance(typ).(Unordered); ok && u.UnorderedFields() == nil {
+				unordered = true
+			}
+		}
+		return canonicalList(elem, data, unordered)
+	case map[string]any:
+		result := make(map[string]any, len(data))
+		if typ == nil || typ.Kind() != reflect.Struct {
+			var elem reflect.Type
+			if typ != nil && typ.Kind() == reflect.Map {
+				elem = typ.Elem()
+			}
+			for k, v := range data {
+				value, err := canonicalValue(elem, v, false)
+				if err != nil {
+					return nil, err
+				}
+				result[k] = value
+			}
+			return result, nil
+		}
+		var unorderedFields []string
+		if u, ok := instance(typ).(Unordered); ok {
+			unorderedFields = u.UnorderedFields()
+		}
+		fields := make(map[string]reflect.Type, typ.NumField())
+		for i := 0; i < typ.NumField(); i++ {
+			if name := jsonName(typ.Field(i)); name != "" {
+				fields[name] = typ.Field(i).Type
+			}
+		}
+		for k, v := range data {
+			value, err := canonicalValue(fields[k], v, slices.Contains(unorderedFields, k))
+			if err != nil {
+				return nil, err
+			}
+			result[k] = value
+		}
+		return result, nil
+	default:
+		return data, nil
+	}
+}
+
+func canonicalList(elem reflect.Type, data []any, unordered bool) (any, error) {
+	result := make([]any, len(data))
+	for i, v := range data {
+		value, err := canonicalValue(elem, v, false)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value
+	}
+	if !unordered {
+		return result, nil
+	}
+	encoded := make([]json.RawMessage, len(result))
+	for i, v := range result {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = b
+	}
+	slices.SortFunc(encoded, func(a, b json.RawMessage) int {
+		return bytes.Compare(a, b)
+	})
+	return encoded, nil
+}
@@ -0,0 +1,65 @@
+package condition
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEqual(t *testing.T) {
+	enumRule := func(values string) string {
+		return `{"type":"enum","data":{"opt":"in","x":{"type":"const","data":"a"},"y":{"type":"const","data":` + values + `}}}`
+	}
+	numberRule := func(opt string, value string) string {
+		return `{"type":"number","data":{"opt":"` + opt + `","x":{"type":"field","data":{"name":"price"}},"y":{"type":"const","data":` + value + `}}}`
+	}
+	group := func(opt string, conditions ...string) string {
+		result := `{"type":"group","data":{"Opt":"` + opt + `","Conditions":[`
+		for i, c := range conditions {
+			if i > 0 {
+				result += ","
+			}
+			result += c
+		}
+		return result + `]}}`
+	}
+
+	Convey("group order and enum order are ignored", t, func() {
+		a := parseRule(t, group("and", numberRule("gt", "1"), enumRule(`["x","y","z"]`)))
+		b := parseRule(t, group("and", enumRule(`["z","x","y"]`), numberRule("gt", "1.0")))
+		So(Equal(a, b), ShouldBeTrue)
+
+		ha, err := Hash(a)
+		So(err, ShouldBeNil)
+		hb, err := Hash(b)
+		So(err, ShouldBeNil)
+		So(ha, ShouldEqual, hb)
+	})
+
+	Convey("operators and operand order still matter", t, func() {
+		a := parseRule(t, group("and", numberRule("gt", "1"), numberRule("lt", "5")))
+		So(Equal(a, parseRule(t, group("or", numberRule("gt", "1"), numberRule("lt", "5")))), ShouldBeFalse)
+		So(Equal(a, parseRule(t, group("and", numberRule("gt", "1"), numberRule("lt", "6")))), ShouldBeFalse)
+		So(Equal(a, parseRule(t, group("and", numberRule("lt", "1"), numberRule("gt", "5")))), ShouldBeFalse)
+	})
+
+	Convey("pickers compare structurally", t, func() {
+		a := &CalculatePicker[record]{}
+		b := &CalculatePicker[record]{}
+		So(Equal[Picker[record, float64]](a, b), ShouldBeTrue)
+		So(Equal[Picker[record, float64]](a, ConstFloatPicker[record](1)), ShouldBeFalse)
+	})
+
+	Convey("integers are compared exactly", t, func() {
+		So(Equal[Picker[record, int]](ConstIntPicker[record](9007199254740993), ConstIntPicker[record](9007199254740992)), ShouldBeFalse)
+		So(Equal[Picker[record, int]](ConstIntPicker[record](9007199254740993), ConstIntPicker[record](9007199254740993)), ShouldBeTrue)
+		for _, numbers := range [][]json.Number{{"100", "100.0", "1e2", "1000e-1"}, {"0", "-0", "0.0", "0e999999999"}, {"0.5", "5e-1"}} {
+			for _, n := range numbers {
+				So(canonicalNumber(n), ShouldEqual, canonicalNumber(numbers[0]))
+			}
+		}
+		So(canonicalNumber("9007199254740993"), ShouldEqual, json.Number("9007199254740993"))
+		So(canonicalNumber("1e999999999"), ShouldEqual, json.Number("1e999999999"))
+	})
+}
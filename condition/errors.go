@@ -0,0 +1,108 @@
+package condition
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrInvalidOperator = errors.New("invalid operator")
+	ErrNilOperand      = errors.New("operand is nil")
+	ErrDivideByZero    = errors.New("divide by zero")
+)
+
+// EvalError locates a failure inside a rule tree. Path leads from the root
+// node to the failing node, e.g. ["Conditions[3]", "x", "y"] for the y
+// operand of the picker in x of the fourth condition of a group; "y[i]" in
+// an array condition stands for y evaluated against the i-th item of x.
+type EvalError struct {
+	Path     []string
+	NodeType string
+	Operator string
+	// Operands holds the values picked by the failing node, when known.
+	Operands map[string]any
+	Err      error
+}
+
+func (err *EvalError) PathString() string {
+	if len(err.Path) == 0 {
+		return "$"
+	}
+	return strings.Join(err.Path, ".")
+}
+
+func (err *EvalError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(err.PathString())
+	sb.WriteString(": ")
+	sb.WriteString(err.NodeType)
+	if err.Operator != "" {
+		fmt.Fprintf(&sb, " opt=%q", err.Operator)
+	}
+	keys := make([]string, 0, len(err.Operands))
+	for k := range err.Operands {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, " %s=%v", k, err.Operands[k])
+	}
+	sb.WriteString(": ")
+	if err.Err != nil {
+		sb.WriteString(err.Err.Error())
+	} else {
+		sb.WriteString("unknown error")
+	}
+	return sb.String()
+}
+
+func (err *EvalError) Unwrap() error {
+	return err.Err
+}
+
+func newEvalError(node any, opt string, operands map[string]any, err error) *EvalError {
+	return &EvalError{
+		NodeType: nodeType(node),
+		Operator: opt,
+		Operands: operands,
+		Err:      err,
+	}
+}
+
+// locate prefixes the path of an error raised by child, the node found at
+// segment of its parent. Errors not raised by built-in nodes (e.g. a custom
+// picker) are wrapped into an EvalError for child.
+func locate(err error, segment string, child any) error {
+	var evalErr *EvalError
+	if errors.As(err, &evalErr) {
+		evalErr.Path = append([]string{segment}, evalErr.Path...)
+		return err
+	}
+	return &EvalError{
+		Path:     []string{segment},
+		NodeType: nodeType(child),
+		Err:      err,
+	}
+}
+
+// nodeType returns the type name of node without package and type parameters.
+func nodeType(node any) string {
+	typ := reflect.TypeOf(node)
+	if typ == nil {
+		return "nil"
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	name := typ.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" {
+		return typ.String()
+	}
+	return name
+}
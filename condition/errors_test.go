@@ -0,0 +1,64 @@
+package condition
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvalError(t *testing.T) {
+	const rule = `{"type":"group","data":{"Opt":"or","Conditions":[
+		{"type":"number","data":{"opt":"gt","x":{"type":"field","data":{"name":"price"}},"y":{"type":"const","data":10}}},
+		{"type":"number","data":{"opt":"gt","x":{"type":"calc","data":{"opt":"div","x":{"type":"field","data":{"name":"price"}},"y":{"type":"field","data":{"name":"count"}}}},"y":{"type":"const","data":1}}}
+	]}}`
+	cond := parseRule(t, rule)
+
+	Convey("errors carry the node path and operands", t, func() {
+		_, err := cond.Match(record{"price": 5.0, "count": 0.0})
+		So(errors.Is(err, ErrDivideByZero), ShouldBeTrue)
+		var evalErr *EvalError
+		So(errors.As(err, &evalErr), ShouldBeTrue)
+		So(evalErr.Path, ShouldResemble, []string{"Conditions[1]", "x"})
+		So(evalErr.NodeType, ShouldEqual, "CalculatePicker")
+		So(evalErr.Operator, ShouldEqual, "div")
+		So(evalErr.Operands, ShouldResemble, map[string]any{"x": 5.0, "y": 0.0})
+		So(err.Error(), ShouldEqual, `Conditions[1].x: CalculatePicker opt="div" x=5 y=0: divide by zero`)
+	})
+
+	Convey("custom picker errors are wrapped", t, func() {
+		_, err := cond.Match(record{})
+		var evalErr *EvalError
+		So(errors.As(err, &evalErr), ShouldBeTrue)
+		So(evalErr.PathString(), ShouldEqual, "Conditions[0].x")
+		So(evalErr.NodeType, ShouldEqual, "fieldPicker")
+	})
+
+	Convey("invalid operators", t, func() {
+		_, err := parseRule(t, `{"type":"number","data":{"opt":"between"}}`).Match(record{})
+		So(errors.Is(err, ErrInvalidOperator), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, `$: NumberCondition opt="between" x=0 y=0: invalid operator`)
+	})
+
+	Convey("picker errors as false", t, func() {
+		failed := []string{}
+		scope := NewScope[record](WithErrorPolicy(PickErrorAsFalse), WithPickErrorHandler(func(err *EvalError) {
+			failed = append(failed, err.PathString())
+		}))
+		_, err := scope.Match(cond, record{"count": 0.0})
+		So(err, ShouldBeNil)
+		So(failed, ShouldResemble, []string{"Conditions[0].x", "Conditions[1].x.x"})
+		So(scope.Stats().Failed, ShouldEqual, 2)
+
+		failed = failed[:0]
+		items := parseRule(t, `{"type":"group","data":{"Opt":"and","Conditions":[
+			{"type":"array","data":{"opt":"all","x":{"type":"items","data":{"name":"items"}},"y":`+rule+`}}
+		]}}`)
+		_, err = scope.Match(items, record{"items": []any{map[string]any{"price": 20.0}, map[string]any{"count": 0.0}}})
+		So(err, ShouldBeNil)
+		So(failed, ShouldResemble, []string{"Conditions[0].y[1].Conditions[0].x", "Conditions[0].y[1].Conditions[1].x.x"})
+
+		_, err = scope.Match(parseRule(t, `{"type":"number","data":{"opt":"between"}}`), record{})
+		So(errors.Is(err, ErrInvalidOperator), ShouldBeTrue)
+	})
+}
@@ -1,27 +1,39 @@
 package condition
 
 import (
+	"fmt"
+
 	. "github.com/k0923/go/json"
 )
 
-var _ Condition[any] = (*GroupCondition[any])(nil)
+var _ ScopedCondition[any] = (*GroupCondition[any])(nil)
 
 type GroupCondition[T any] struct {
 	Opt        string
 	Conditions []G[Condition[T]]
 }
 
+func (g *GroupCondition[T]) Operators() []string {
+	return []string{"and", "or"}
+}
+
 func (g *GroupCondition[T]) Match(data T) (bool, error) {
+	return g.MatchScope(nil, data)
+}
+
+func (g *GroupCondition[T]) MatchScope(scope *Scope[T], data T) (bool, error) {
 	if len(g.Conditions) == 0 {
 		return true, nil
 	}
-	for _, condition := range g.Conditions {
+	for i, condition := range g.Conditions {
 		if condition.Value() == nil {
 			continue
 		}
-		result, err := condition.Value().Match(data)
+		mark := scope.pending()
+		result, err := matchIn(scope, condition.Value(), data)
+		scope.locateFailed(mark, "Conditions[%d]", i)
 		if err != nil {
-			return false, err
+			return false, locate(err, fmt.Sprintf("Conditions[%d]", i), condition.Value())
 		}
 		if g.Opt == "and" {
 			if !result {
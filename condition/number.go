@@ -1,12 +1,10 @@
 package condition
 
 import (
-	"fmt"
-
 	. "github.com/k0923/go/json"
 )
 
-var _ Condition[any] = (*NumberCondition[any, float64])(nil)
+var _ ScopedCondition[any] = (*NumberCondition[any, float64])(nil)
 
 type NumberCondition[T any, E float64 | int] struct {
 	X   G[Picker[T, E]] `json:"x"`
@@ -14,20 +12,28 @@ type NumberCondition[T any, E float64 | int] struct {
 	Y   G[Picker[T, E]] `json:"y"`
 }
 
+func (n *NumberCondition[T, E]) Operators() []string {
+	return []string{"gt", "lt", "ge", "le", "eq", "ne"}
+}
+
 func (n *NumberCondition[T, E]) Match(data T) (bool, error) {
+	return n.MatchScope(nil, data)
+}
+
+func (n *NumberCondition[T, E]) MatchScope(scope *Scope[T], data T) (bool, error) {
 	var x E = 0
 	var y E = 0
 	var err error
 	if n.X.Value() != nil {
-		x, err = n.X.Value().Pick(data)
+		x, err = pickIn(scope, n.X.Value(), data)
 		if err != nil {
-			return false, err
+			return scope.pickFailed(locate(err, "x", n.X.Value()))
 		}
 	}
 	if n.Y.Value() != nil {
-		y, err = n.Y.Value().Pick(data)
+		y, err = pickIn(scope, n.Y.Value(), data)
 		if err != nil {
-			return false, err
+			return scope.pickFailed(locate(err, "y", n.Y.Value()))
 		}
 	}
 	switch n.Opt {
@@ -44,7 +50,7 @@ func (n *NumberCondition[T, E]) Match(data T) (bool, error) {
 	case "ne":
 		return x != y, nil
 	default:
-		return false, fmt.Errorf("invalid operator: %v", n.Opt)
+		return false, newEvalError(n, n.Opt, map[string]any{"x": x, "y": y}, ErrInvalidOperator)
 	}
 }
 
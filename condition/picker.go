@@ -9,7 +9,7 @@ import (
 var _ Picker[any, string] = (*ConstStringPicker[any])(nil)
 var _ Picker[any, float64] = (*ConstFloatPicker[any])(nil)
 var _ Picker[any, int] = (*ConstIntPicker[any])(nil)
-var _ Picker[any, float64] = (*CalculatePicker[any])(nil)
+var _ ScopedPicker[any, float64] = (*CalculatePicker[any])(nil)
 
 type ConstStringPicker[T any] string
 
@@ -41,21 +41,29 @@ type CalculatePicker[T any] struct {
 	Y   G[Picker[T, float64]] `json:"y"`
 }
 
+func (c *CalculatePicker[T]) Operators() []string {
+	return []string{"add", "sub", "mul", "div"}
+}
+
 func (c *CalculatePicker[T]) Pick(from T) (float64, error) {
+	return c.PickScope(nil, from)
+}
+
+func (c *CalculatePicker[T]) PickScope(scope *Scope[T], from T) (float64, error) {
 	var x float64 = 0
 	var y float64 = 0
 	var err error
 	if c.X.Value() == nil {
-		return 0, fmt.Errorf("x condition is nil")
+		return 0, newEvalError(c, c.Opt, nil, fmt.Errorf("x %w", ErrNilOperand))
 	}
 	if c.Y.Value() == nil {
-		return 0, fmt.Errorf("y condition is nil")
+		return 0, newEvalError(c, c.Opt, nil, fmt.Errorf("y %w", ErrNilOperand))
 	}
-	if x, err = c.X.Value().Pick(from); err != nil {
-		return 0, err
+	if x, err = pickIn(scope, c.X.Value(), from); err != nil {
+		return 0, locate(err, "x", c.X.Value())
 	}
-	if y, err = c.Y.Value().Pick(from); err != nil {
-		return 0, err
+	if y, err = pickIn(scope, c.Y.Value(), from); err != nil {
+		return 0, locate(err, "y", c.Y.Value())
 	}
 	switch c.Opt {
 	case "add":
@@ -66,10 +74,10 @@ func (c *CalculatePicker[T]) Pick(from T) (float64, error) {
 		return x * y, nil
 	case "div":
 		if y == 0 {
-			return 0, fmt.Errorf("divide by zero")
+			return 0, newEvalError(c, c.Opt, map[string]any{"x": x, "y": y}, ErrDivideByZero)
 		}
 		return x / y, nil
 	default:
-		return 0, fmt.Errorf("invalid operator: %v", c.Opt)
+		return 0, newEvalError(c, c.Opt, map[string]any{"x": x, "y": y}, ErrInvalidOperator)
 	}
 }
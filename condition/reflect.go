@@ -0,0 +1,61 @@
+package condition
+
+import (
+	"reflect"
+	"strings"
+
+	. "github.com/k0923/go/json"
+)
+
+var xjsonPkgPath = reflect.TypeFor[G[any]]().PkgPath()
+
+// boundType returns X for xjson.G[X].
+func boundType(typ reflect.Type) (reflect.Type, bool) {
+	return xjsonInner(typ, "G[", "v")
+}
+
+// optionalType returns X for xjson.Optional[X].
+func optionalType(typ reflect.Type) (reflect.Type, bool) {
+	return xjsonInner(typ, "Optional[", "Value")
+}
+
+func xjsonInner(typ reflect.Type, prefix string, field string) (reflect.Type, bool) {
+	if typ.PkgPath() != xjsonPkgPath || typ.Kind() != reflect.Slice || typ.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	if !strings.HasPrefix(typ.Name(), prefix) {
+		return nil, false
+	}
+	f, ok := typ.Elem().FieldByName(field)
+	if !ok {
+		return nil, false
+	}
+	return f.Type, true
+}
+
+// jsonName returns the json key of a struct field, "" when it is skipped.
+func jsonName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// instance returns a value of typ whose method set includes the pointer
+// receiver methods, so optional interfaces like OperatorLister are found
+// whether a type was registered as a value or a pointer.
+func instance(typ reflect.Type) any {
+	if typ.Kind() == reflect.Pointer {
+		return reflect.Zero(typ).Interface()
+	}
+	return reflect.New(typ).Interface()
+}
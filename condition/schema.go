@@ -0,0 +1,232 @@
+package condition
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	. "github.com/k0923/go/json"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema generates a JSON Schema (draft 2020-12) for rule trees evaluated
+// against T, covering every condition and picker type registered through
+// xjson.Bind. Each bound interface becomes a $defs entry named after what it
+// produces ("condition", "picker_number", "picker_string", ...) holding a
+// oneOf over its registered types; "x-kind" and "x-discriminator" annotate
+// the operand kind and the type/data layout for rule builders.
+func JSONSchema[T any]() (map[string]any, error) {
+	gen := &schemaGen{
+		record: reflect.TypeFor[T](),
+		defs:   make(map[string]any),
+		names:  make(map[reflect.Type]string),
+	}
+	root := reflect.TypeFor[Condition[T]]()
+	if _, ok := LookupBinding(root); !ok {
+		return nil, fmt.Errorf("condition type %v is not binding", root)
+	}
+	rootRef := gen.ref(root)
+	for _, binding := range Bindings() {
+		if gen.kind(binding.Interface) != "" {
+			gen.ref(binding.Interface)
+		}
+	}
+	return map[string]any{
+		"$schema": jsonSchemaDraft,
+		"$ref":    rootRef,
+		"$defs":   gen.defs,
+	}, nil
+}
+
+type schemaGen struct {
+	record reflect.Type
+	defs   map[string]any
+	names  map[reflect.Type]string
+}
+
+// kind names what an interface of the rule tree yields: "condition" for
+// Condition[T], the picked value kind for Picker[T, E], "" for other types.
+func (gen *schemaGen) kind(iface reflect.Type) string {
+	if iface.Kind() != reflect.Interface {
+		return ""
+	}
+	if m, ok := iface.MethodByName("Match"); ok && m.Type.NumIn() == 1 && m.Type.In(0) == gen.record {
+		return "condition"
+	}
+	if m, ok := iface.MethodByName("Pick"); ok && m.Type.NumIn() == 1 && m.Type.In(0) == gen.record && m.Type.NumOut() == 2 {
+		return gen.valueKind(m.Type.Out(0))
+	}
+	return ""
+}
+
+func (gen *schemaGen) valueKind(typ reflect.Type) string {
+	if typ == gen.record {
+		return "record"
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Slice, reflect.Array:
+		return gen.valueKind(typ.Elem()) + "_array"
+	default:
+		return strings.ToLower(typ.Name())
+	}
+}
+
+func (gen *schemaGen) defName(iface reflect.Type) string {
+	name := gen.kind(iface)
+	switch {
+	case name == "":
+		name = strings.ToLower(iface.Name())
+		if i := strings.IndexByte(name, '['); i >= 0 {
+			name = name[:i]
+		}
+	case name != "condition":
+		name = "picker_" + name
+	}
+	unique := name
+	for i := 2; gen.defs[unique] != nil; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	return unique
+}
+
+func (gen *schemaGen) ref(iface reflect.Type) string {
+	if name, ok := gen.names[iface]; ok {
+		return "#/$defs/" + name
+	}
+	name := gen.defName(iface)
+	gen.names[iface] = name
+	// reserve the name before descending, rule trees are recursive
+	gen.defs[name] = map[string]any{}
+
+	def := map[string]any{}
+	if kind := gen.kind(iface); kind != "" {
+		def["x-kind"] = kind
+	}
+	binding, ok := LookupBinding(iface)
+	if !ok || len(binding.Types) == 0 {
+		def["description"] = fmt.Sprintf("%v has no registered types", iface)
+		def["not"] = map[string]any{}
+		gen.defs[name] = def
+		return "#/$defs/" + name
+	}
+	def["x-discriminator"] = map[string]any{
+		"propertyName": binding.TypeKey,
+		"valueKey":     binding.ValueKey,
+		"layout":       binding.Layout.String(),
+	}
+
+	typeNames := make([]string, 0, len(binding.Types))
+	for typeName := range binding.Types {
+		typeNames = append(typeNames, typeName)
+	}
+	slices.Sort(typeNames)
+	variants := []any{map[string]any{"type": "null"}}
+	for _, typeName := range typeNames {
+		variants = append(variants, gen.variant(binding, typeName, binding.Types[typeName]))
+	}
+	def["oneOf"] = variants
+	gen.defs[name] = def
+	return "#/$defs/" + name
+}
+
+func (gen *schemaGen) variant(binding Binding, typeName string, typ reflect.Type) map[string]any {
+	value := gen.value(typ)
+	discriminator := map[string]any{"const": typeName}
+	switch binding.Layout {
+	case LayoutFlat:
+		return map[string]any{
+			"title":      typeName,
+			"type":       "object",
+			"allOf":      []any{value},
+			"properties": map[string]any{binding.TypeKey: discriminator},
+			"required":   []string{binding.TypeKey},
+		}
+	case LayoutWrapped:
+		return map[string]any{
+			"title": typeName,
+			"type":  "object",
+			"properties": map[string]any{
+				binding.TypeKey:  discriminator,
+				binding.ValueKey: value,
+			},
+			"required": []string{binding.TypeKey, binding.ValueKey},
+		}
+	default:
+		return map[string]any{
+			"title":   typeName,
+			"x-value": value,
+		}
+	}
+}
+
+// value describes the data of a registered type.
+func (gen *schemaGen) value(typ reflect.Type) map[string]any {
+	var operators []string
+	if lister, ok := instance(typ).(OperatorLister); ok {
+		operators = lister.Operators()
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return gen.typeSchema(typ)
+	}
+	properties := make(map[string]any)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := jsonName(field)
+		if name == "" {
+			continue
+		}
+		if field.Name == "Opt" && operators != nil {
+			properties[name] = map[string]any{"type": "string", "enum": operators}
+			continue
+		}
+		properties[name] = gen.typeSchema(field.Type)
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func (gen *schemaGen) typeSchema(typ reflect.Type) map[string]any {
+	if inner, ok := boundType(typ); ok {
+		return map[string]any{"$ref": gen.ref(inner)}
+	}
+	if inner, ok := optionalType(typ); ok {
+		return gen.typeSchema(inner)
+	}
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return gen.typeSchema(typ.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": gen.typeSchema(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": gen.typeSchema(typ.Elem())}
+	case reflect.Struct:
+		return gen.value(typ)
+	default:
+		return map[string]any{}
+	}
+}
@@ -0,0 +1,56 @@
+package condition
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONSchema(t *testing.T) {
+	Convey("schema covers registered conditions and pickers", t, func() {
+		schema, err := JSONSchema[record]()
+		So(err, ShouldBeNil)
+		So(schema["$schema"], ShouldEqual, jsonSchemaDraft)
+		So(schema["$ref"], ShouldEqual, "#/$defs/condition")
+
+		data, err := json.Marshal(schema)
+		So(err, ShouldBeNil)
+		var doc struct {
+			Defs map[string]struct {
+				Kind          string         `json:"x-kind"`
+				Discriminator map[string]any `json:"x-discriminator"`
+				OneOf         []struct {
+					Title      string `json:"title"`
+					Properties map[string]struct {
+						Const string `json:"const"`
+						Ref   string `json:"$ref"`
+						Props map[string]struct {
+							Enum []string `json:"enum"`
+							Ref  string   `json:"$ref"`
+						} `json:"properties"`
+					} `json:"properties"`
+				} `json:"oneOf"`
+			} `json:"$defs"`
+		}
+		So(json.Unmarshal(data, &doc), ShouldBeNil)
+
+		cond := doc.Defs["condition"]
+		So(cond.Kind, ShouldEqual, "condition")
+		So(cond.Discriminator["propertyName"], ShouldEqual, "type")
+		So(cond.Discriminator["layout"], ShouldEqual, "wrapped")
+		titles := []string{}
+		for _, v := range cond.OneOf {
+			titles = append(titles, v.Title)
+		}
+		So(titles, ShouldResemble, []string{"", "array", "enum", "group", "number"})
+
+		number := cond.OneOf[4].Properties["data"].Props
+		So(number["opt"].Enum, ShouldResemble, []string{"gt", "lt", "ge", "le", "eq", "ne"})
+		So(number["x"].Ref, ShouldEqual, "#/$defs/picker_number")
+		So(cond.OneOf[1].Properties["data"].Props["x"].Ref, ShouldEqual, "#/$defs/picker_record_array")
+
+		So(doc.Defs["picker_number"].Kind, ShouldEqual, "number")
+		So(len(doc.Defs["picker_number"].OneOf), ShouldEqual, 4)
+	})
+}
@@ -0,0 +1,247 @@
+package condition
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// KeyMode decides how a Scope recognises two pickers as the same value source.
+type KeyMode int
+
+const (
+	// KeyByIdentity caches by the picker value itself: the same pointer, or
+	// equal comparable values, share a cache entry.
+	KeyByIdentity KeyMode = iota
+	// KeyByJSON caches by the canonical JSON of the picker (see Canonical), so
+	// structurally equal pickers unmarshalled into different nodes share a
+	// cache entry. Pickers that cannot be marshalled fall back to identity.
+	KeyByJSON
+)
+
+// ErrorPolicy decides what a condition does when one of its pickers fails.
+type ErrorPolicy int
+
+const (
+	// AbortOnError stops the evaluation and returns the *EvalError.
+	AbortOnError ErrorPolicy = iota
+	// PickErrorAsFalse makes the condition whose picker failed evaluate to
+	// false and continues; structural errors like invalid operators still abort.
+	PickErrorAsFalse
+)
+
+type ScopeOptions struct {
+	KeyMode     KeyMode
+	ErrorPolicy ErrorPolicy
+	// OnPickError, when set, observes the picker errors suppressed by
+	// PickErrorAsFalse once Scope.Match is done; their Path starts at the
+	// condition given to Match.
+	OnPickError func(err *EvalError)
+}
+
+type ScopeOption func(opt *ScopeOptions)
+
+func WithKeyMode(mode KeyMode) ScopeOption {
+	return func(opt *ScopeOptions) { opt.KeyMode = mode }
+}
+
+func WithErrorPolicy(policy ErrorPolicy) ScopeOption {
+	return func(opt *ScopeOptions) { opt.ErrorPolicy = policy }
+}
+
+func WithPickErrorHandler(fn func(err *EvalError)) ScopeOption {
+	return func(opt *ScopeOptions) { opt.OnPickError = fn }
+}
+
+// ScopeStats reports how effective the picker cache was, for tuning rule trees.
+type ScopeStats struct {
+	Matches  int // records evaluated through Scope.Match
+	Hits     int // picks served from the cache
+	Misses   int // picks evaluated and stored in the cache
+	Bypassed int // picks that could not be cached (e.g. non comparable pickers)
+	Failed   int // picker errors turned into false by PickErrorAsFalse
+}
+
+// HitRate returns Hits / (Hits + Misses), or 0 when nothing was cached.
+func (s ScopeStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// ScopedCondition is implemented by conditions that evaluate their pickers
+// and children through a Scope. Conditions that do not implement it are
+// evaluated with plain Match and their pickers are not cached.
+type ScopedCondition[T any] interface {
+	Condition[T]
+	MatchScope(scope *Scope[T], data T) (bool, error)
+}
+
+// ScopedPicker is implemented by pickers composed of other pickers, so the
+// nested pickers are cached as well.
+type ScopedPicker[T any, E any] interface {
+	Picker[T, E]
+	PickScope(scope *Scope[T], from T) (E, error)
+}
+
+// Scope memoizes picker results for the duration of one Match, so a value
+// picked by a dozen conditions of the same rule tree is computed once per
+// record. A Scope can be reused for many records but is not safe for
+// concurrent use, and assumes the rule trees it evaluates are not modified
+// while it is in use.
+type Scope[T any] struct {
+	opt    ScopeOptions
+	canon  map[any]string
+	values map[any]any
+	stats  *ScopeStats
+	// failed holds the suppressed picker errors of a Match for OnPickError,
+	// their paths are prefixed while the Match returns through the parents.
+	failed *[]*EvalError
+}
+
+func NewScope[T any](opts ...ScopeOption) *Scope[T] {
+	opt := ScopeOptions{}
+	for _, f := range opts {
+		f(&opt)
+	}
+	return &Scope[T]{
+		opt:    opt,
+		canon:  make(map[any]string),
+		values: make(map[any]any),
+		stats:  &ScopeStats{},
+		failed: new([]*EvalError),
+	}
+}
+
+// Match evaluates cond against data with a fresh picker cache.
+func (s *Scope[T]) Match(cond Condition[T], data T) (bool, error) {
+	clear(s.values)
+	s.stats.Matches++
+	result, err := matchIn(s, cond, data)
+	failed := *s.failed
+	*s.failed = nil
+	for _, evalErr := range failed {
+		s.opt.OnPickError(evalErr)
+	}
+	return result, err
+}
+
+func (s *Scope[T]) Stats() ScopeStats {
+	return *s.stats
+}
+
+func (s *Scope[T]) ResetStats() {
+	*s.stats = ScopeStats{}
+}
+
+// child returns a scope for evaluating nested records (e.g. array items),
+// sharing options, key memo and stats but caching values separately.
+func (s *Scope[T]) child() *Scope[T] {
+	return &Scope[T]{
+		opt:    s.opt,
+		canon:  s.canon,
+		values: make(map[any]any),
+		stats:  s.stats,
+		failed: s.failed,
+	}
+}
+
+func (s *Scope[T]) reset() {
+	clear(s.values)
+}
+
+// pickFailed applies the error policy to a picker error located by locate.
+// Suppressed errors are kept for OnPickError, the parents of the condition
+// prefix their paths with locateFailed.
+func (s *Scope[T]) pickFailed(err error) (bool, error) {
+	if s == nil || s.opt.ErrorPolicy != PickErrorAsFalse {
+		return false, err
+	}
+	s.stats.Failed++
+	var evalErr *EvalError
+	if s.opt.OnPickError != nil && errors.As(err, &evalErr) {
+		*s.failed = append(*s.failed, evalErr)
+	}
+	return false, nil
+}
+
+// pending returns the number of suppressed errors kept, the mark of
+// locateFailed before evaluating a child.
+func (s *Scope[T]) pending() int {
+	if s == nil {
+		return 0
+	}
+	return len(*s.failed)
+}
+
+// locateFailed prefixes the paths of the errors suppressed since mark with
+// the segment of the child evaluated, formatted like fmt.Sprintf.
+func (s *Scope[T]) locateFailed(mark int, format string, args ...any) {
+	if s == nil || len(*s.failed) == mark {
+		return
+	}
+	segment := fmt.Sprintf(format, args...)
+	for _, evalErr := range (*s.failed)[mark:] {
+		evalErr.Path = append([]string{segment}, evalErr.Path...)
+	}
+}
+
+func matchIn[T any](scope *Scope[T], cond Condition[T], data T) (bool, error) {
+	if scope != nil {
+		if sc, ok := cond.(ScopedCondition[T]); ok {
+			return sc.MatchScope(scope, data)
+		}
+	}
+	return cond.Match(data)
+}
+
+func pickIn[T any, E any](scope *Scope[T], picker Picker[T, E], data T) (E, error) {
+	if scope == nil {
+		return picker.Pick(data)
+	}
+	key, ok := cacheKey(scope, picker)
+	if !ok {
+		scope.stats.Bypassed++
+		return pickUncached(scope, picker, data)
+	}
+	if v, exist := scope.values[key]; exist {
+		scope.stats.Hits++
+		return v.(E), nil
+	}
+	result, err := pickUncached(scope, picker, data)
+	if err != nil {
+		return result, err
+	}
+	scope.stats.Misses++
+	scope.values[key] = result
+	return result, nil
+}
+
+func pickUncached[T any, E any](scope *Scope[T], picker Picker[T, E], data T) (E, error) {
+	if sp, ok := picker.(ScopedPicker[T, E]); ok {
+		return sp.PickScope(scope, data)
+	}
+	return picker.Pick(data)
+}
+
+func cacheKey[T any, E any](scope *Scope[T], picker Picker[T, E]) (any, bool) {
+	if !reflect.ValueOf(picker).Comparable() {
+		return nil, false
+	}
+	if scope.opt.KeyMode != KeyByJSON {
+		return picker, true
+	}
+	key, ok := scope.canon[picker]
+	if !ok {
+		data, err := Canonical(picker)
+		if err == nil {
+			key = reflect.TypeFor[Picker[T, E]]().String() + string(data)
+		}
+		scope.canon[picker] = key
+	}
+	if key == "" {
+		return picker, true
+	}
+	return key, true
+}
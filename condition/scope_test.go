@@ -0,0 +1,130 @@
+package condition
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	. "github.com/k0923/go/json"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type record = map[string]any
+
+var pickCount = map[string]int{}
+
+type fieldPicker struct {
+	Name string `json:"name"`
+}
+
+func (p *fieldPicker) Pick(from record) (float64, error) {
+	pickCount[p.Name]++
+	v, ok := from[p.Name].(float64)
+	if !ok {
+		return 0, fmt.Errorf("field %s is not a number", p.Name)
+	}
+	return v, nil
+}
+
+type itemsPicker struct {
+	Name string `json:"name"`
+}
+
+func (p *itemsPicker) Pick(from record) ([]record, error) {
+	items, _ := from[p.Name].([]any)
+	result := make([]record, 0, len(items))
+	for _, item := range items {
+		if r, ok := item.(map[string]any); ok {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func init() {
+	Bind(map[string]Picker[record, float64]{
+		"field": &fieldPicker{},
+		"const": ConstFloatPicker[record](0),
+		"calc":  &CalculatePicker[record]{},
+	})
+	Bind(map[string]Picker[record, []record]{
+		"items": &itemsPicker{},
+	})
+	Bind(map[string]Picker[record, string]{
+		"const": ConstStringPicker[record](""),
+	})
+	Bind(map[string]Picker[record, []string]{
+		"const": ConstEnumPicker[record, string]{},
+	})
+	Bind(map[string]Condition[record]{
+		"enum":   &EnumCondition[record, string]{},
+		"number": &NumberCondition[record, float64]{},
+		"group":  &GroupCondition[record]{},
+		"array":  &ArrayCondition[record]{},
+	})
+}
+
+const scopeRule = `{"type":"group","data":{"Opt":"and","Conditions":[
+	{"type":"number","data":{"opt":"gt","x":{"type":"calc","data":{"opt":"mul","x":{"type":"field","data":{"name":"price"}},"y":{"type":"const","data":2}}},"y":{"type":"const","data":10}}},
+	{"type":"number","data":{"opt":"lt","x":{"type":"calc","data":{"opt":"mul","x":{"type":"field","data":{"name":"price"}},"y":{"type":"const","data":2}}},"y":{"type":"field","data":{"name":"limit"}}}},
+	{"type":"number","data":{"opt":"gt","x":{"type":"field","data":{"name":"price"}},"y":{"type":"field","data":{"name":"limit"}}}}
+]}}`
+
+func parseRule(t *testing.T, rule string) Condition[record] {
+	var cond G[Condition[record]]
+	if err := json.Unmarshal([]byte(rule), &cond); err != nil {
+		t.Fatal(err)
+	}
+	return cond.Value()
+}
+
+func TestScope(t *testing.T) {
+	cond := parseRule(t, scopeRule)
+	data := record{"price": 10.0, "limit": 100.0}
+
+	Convey("match without scope picks every time", t, func() {
+		clear(pickCount)
+		_, err := cond.Match(data)
+		So(err, ShouldBeNil)
+		So(pickCount["price"], ShouldEqual, 3)
+	})
+
+	Convey("identity keys only share the same node", t, func() {
+		clear(pickCount)
+		scope := NewScope[record]()
+		_, err := scope.Match(cond, data)
+		So(err, ShouldBeNil)
+		So(pickCount["price"], ShouldEqual, 3)
+		// only the two equal const pickers share an entry
+		So(scope.Stats().Hits, ShouldEqual, 1)
+	})
+
+	Convey("json keys share structurally equal pickers", t, func() {
+		clear(pickCount)
+		scope := NewScope[record](WithKeyMode(KeyByJSON))
+		for range 2 {
+			result, err := scope.Match(cond, data)
+			So(err, ShouldBeNil)
+			So(result, ShouldBeFalse)
+		}
+		So(pickCount["price"], ShouldEqual, 2)
+		So(pickCount["limit"], ShouldEqual, 2)
+		stats := scope.Stats()
+		So(stats.Matches, ShouldEqual, 2)
+		So(stats.Hits, ShouldBeGreaterThan, 0)
+		So(stats.HitRate(), ShouldBeGreaterThan, 0)
+	})
+
+	Convey("array items are cached per item", t, func() {
+		clear(pickCount)
+		rule := `{"type":"array","data":{"opt":"any","x":{"type":"items","data":{"name":"items"}},"y":` + scopeRule + `}}`
+		items := record{"items": []any{
+			map[string]any{"price": 6.0, "limit": 20.0},
+			map[string]any{"price": 7.0, "limit": 20.0},
+		}}
+		scope := NewScope[record](WithKeyMode(KeyByJSON))
+		_, err := scope.Match(parseRule(t, rule), items)
+		So(err, ShouldBeNil)
+		So(pickCount["price"], ShouldEqual, 2)
+	})
+}
@@ -1,13 +1,12 @@
 package condition
 
 import (
-	"fmt"
 	"strings"
 
 	. "github.com/k0923/go/json"
 )
 
-var _ Condition[any] = (*StringCondition[any])(nil)
+var _ ScopedCondition[any] = (*StringCondition[any])(nil)
 
 type StringCondition[T any] struct {
 	X   G[Picker[T, string]] `json:"x"`
@@ -15,20 +14,28 @@ type StringCondition[T any] struct {
 	Y   G[Picker[T, string]] `json:"y"`
 }
 
+func (n *StringCondition[T]) Operators() []string {
+	return []string{"eq", "ne", "include", "exclude", "start_with", "end_with"}
+}
+
 func (n *StringCondition[T]) Match(data T) (bool, error) {
+	return n.MatchScope(nil, data)
+}
+
+func (n *StringCondition[T]) MatchScope(scope *Scope[T], data T) (bool, error) {
 	var x string = ""
 	var y string = ""
 	var err error
 	if n.X.Value() != nil {
-		x, err = n.X.Value().Pick(data)
+		x, err = pickIn(scope, n.X.Value(), data)
 		if err != nil {
-			return false, err
+			return scope.pickFailed(locate(err, "x", n.X.Value()))
 		}
 	}
 	if n.Y.Value() != nil {
-		y, err = n.Y.Value().Pick(data)
+		y, err = pickIn(scope, n.Y.Value(), data)
 		if err != nil {
-			return false, err
+			return scope.pickFailed(locate(err, "y", n.Y.Value()))
 		}
 	}
 	switch n.Opt {
@@ -45,6 +52,6 @@ func (n *StringCondition[T]) Match(data T) (bool, error) {
 	case "end_with":
 		return strings.HasSuffix(x, y), nil
 	default:
-		return false, fmt.Errorf("invalid operator: %v", n.Opt)
+		return false, newEvalError(n, n.Opt, map[string]any{"x": x, "y": y}, ErrInvalidOperator)
 	}
 }
@@ -0,0 +1,426 @@
+package formula
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"strconv"
+)
+
+// Inspect traverses expr depth first, calling f for every node. The children
+// of a node are skipped when f returns false.
+func Inspect(expr Expr, f func(Expr) bool) {
+	if expr == nil || !f(expr) {
+		return
+	}
+	switch expr := expr.(type) {
+	case *GroupExpr:
+		Inspect(expr.Expr, f)
+	case *UnaryExpr:
+		Inspect(expr.X, f)
+	case *BinaryExpr:
+		Inspect(expr.X, f)
+		Inspect(expr.Y, f)
+	case *CallerExpr:
+		for _, arg := range expr.Args {
+			Inspect(arg, f)
+		}
+	}
+}
+
+// ASTVersion is the version of the JSON AST schema written by MarshalAST.
+//
+// Every node is an object with a "type" member:
+//
+//	{"type":"const","pos":0,"value":1.5,"src":"1.50"}
+//	{"type":"string","pos":0,"value":"a\"b","src":"\"a\\\"b\""}
+//	{"type":"ref","pos":0,"name":"order.items[0].price"}
+//	{"type":"unary","pos":0,"op":"neg","x":{...}}
+//	{"type":"binary","op":"add","x":{...},"y":{...}}
+//	{"type":"call","pos":0,"name":"SUM","args":[{...}]}
+//	{"type":"group","expr":{...}}
+//
+// Binary operators are add sub mul div mod pow concat eq ne lt le gt ge and
+// or, unary operators are not neg plus.
+const ASTVersion = 1
+
+var ErrASTVersion = errors.New("unsupported formula ast version")
+
+// AST is the versioned JSON document of an expression.
+type AST struct {
+	Version int  `json:"version"`
+	Expr    Expr `json:"expr"`
+}
+
+// UnmarshalJSON decodes the document with its calls resolved from
+// DefaultRegistry and checked, see UnmarshalAST for other registries.
+func (ast *AST) UnmarshalJSON(data []byte) error {
+	expr, err := decodeAST(data)
+	if err != nil {
+		return err
+	}
+	if err := bindCalls(expr, DefaultRegistry); err != nil {
+		return err
+	}
+	ast.Version, ast.Expr = ASTVersion, expr
+	return nil
+}
+
+// decodeAST decodes a versioned JSON AST without resolving its calls.
+func decodeAST(data []byte) (Expr, error) {
+	var doc struct {
+		Version int             `json:"version"`
+		Expr    json.RawMessage `json:"expr"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Version != ASTVersion {
+		return nil, fmt.Errorf("%w: %d", ErrASTVersion, doc.Version)
+	}
+	return UnmarshalExpr(doc.Expr)
+}
+
+// MarshalAST encodes expr as a versioned JSON AST.
+func MarshalAST(expr Expr) ([]byte, error) {
+	return json.Marshal(AST{Version: ASTVersion, Expr: expr})
+}
+
+// UnmarshalAST decodes a versioned JSON AST. Calls are resolved from the
+// registry of opts and checked against their signatures like ParseExpr does.
+func UnmarshalAST(data []byte, opts ...ParseOption) (Expr, error) {
+	expr, err := decodeAST(data)
+	if err != nil {
+		return nil, err
+	}
+	opt := ParseOptions{Registry: DefaultRegistry}
+	for _, f := range opts {
+		f(&opt)
+	}
+	if err := bindCalls(expr, opt.Registry); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// bindCalls resolves the functions of the calls in expr, innermost first so
+// that the result types of nested calls are known to the signature checks.
+func bindCalls(expr Expr, registry *Registry) error {
+	var err error
+	var calls []*CallerExpr
+	Inspect(expr, func(node Expr) bool {
+		if call, ok := node.(*CallerExpr); ok {
+			calls = append(calls, call)
+		}
+		return true
+	})
+	for i := len(calls) - 1; i >= 0 && err == nil; i-- {
+		call := calls[i]
+		def, ok := registry.Lookup(call.Name)
+		if !ok {
+			return fmt.Errorf("function:%s is not existed", call.Name)
+		}
+		call.Name, call.def = def.Name, def
+		if err = def.Signature.check(call.Args); err == nil {
+			err = def.Function.Valid(call.Args)
+		}
+		err = call.locate(err)
+	}
+	return err
+}
+
+var binaryOps = map[token.Token]string{
+	token.ADD:  "add",
+	token.SUB:  "sub",
+	token.MUL:  "mul",
+	token.QUO:  "div",
+	token.REM:  "mod",
+	token.XOR:  "pow",
+	token.AND:  "concat",
+	token.EQL:  "eq",
+	token.NEQ:  "ne",
+	token.LSS:  "lt",
+	token.LEQ:  "le",
+	token.GTR:  "gt",
+	token.GEQ:  "ge",
+	token.LAND: "and",
+	token.LOR:  "or",
+}
+
+var unaryOps = map[token.Token]string{
+	token.NOT: "not",
+	token.SUB: "neg",
+	token.ADD: "plus",
+}
+
+func opName(ops map[token.Token]string, op token.Token) (string, error) {
+	if name, ok := ops[op]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("unsupported operator:%s", op)
+}
+
+func opToken(ops map[token.Token]string, name string) (token.Token, error) {
+	for op, opName := range ops {
+		if opName == name {
+			return op, nil
+		}
+	}
+	return token.ILLEGAL, fmt.Errorf("unsupported operator:%s", name)
+}
+
+// UnmarshalExpr decodes a JSON AST node, see ASTVersion for the schema.
+func UnmarshalExpr(data []byte) (Expr, error) {
+	var node struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	var expr interface {
+		Expr
+		json.Unmarshaler
+	}
+	switch node.Type {
+	case "const":
+		expr = &ConstExpr{}
+	case "string":
+		expr = &StringExpr{}
+	case "ref":
+		expr = &RefExpr{}
+	case "unary":
+		expr = &UnaryExpr{}
+	case "binary":
+		expr = &BinaryExpr{}
+	case "call":
+		expr = &CallerExpr{}
+	case "group":
+		expr = &GroupExpr{}
+	case "":
+		return nil, errors.New("expr type is missing")
+	default:
+		return nil, fmt.Errorf("unknown expr type:%s", node.Type)
+	}
+	if err := expr.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", node.Type, err)
+	}
+	return expr, nil
+}
+
+func (expr ConstExpr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string    `json:"type"`
+		Pos   token.Pos `json:"pos"`
+		Value float64   `json:"value"`
+		Src   string    `json:"src,omitempty"`
+	}{"const", expr.Position, expr.Value, expr.Src})
+}
+
+func (expr *ConstExpr) UnmarshalJSON(data []byte) error {
+	var node struct {
+		Pos   token.Pos `json:"pos"`
+		Value float64   `json:"value"`
+		Src   string    `json:"src"`
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	if node.Src != "" {
+		// the source is evaluated in the decimal mode and formatted, it
+		// has to spell the value
+		if _, err := ParseDecimal(node.Src); err != nil {
+			return err
+		}
+		if value, err := strconv.ParseFloat(node.Src, 64); err != nil || value != node.Value {
+			return fmt.Errorf("const src %q does not spell value %v", node.Src, node.Value)
+		}
+	}
+	*expr = ConstExpr{Position: node.Pos, Value: node.Value, Src: node.Src}
+	return nil
+}
+
+func (expr StringExpr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string    `json:"type"`
+		Pos   token.Pos `json:"pos"`
+		Value string    `json:"value"`
+		Src   string    `json:"src,omitempty"`
+	}{"string", expr.Position, expr.Value, expr.Src})
+}
+
+func (expr *StringExpr) UnmarshalJSON(data []byte) error {
+	var node struct {
+		Pos   token.Pos `json:"pos"`
+		Value string    `json:"value"`
+		Src   string    `json:"src"`
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	if node.Src != "" {
+		// the source is formatted, it has to be the literal of the value
+		if value, err := unquote(node.Src); err != nil || value != node.Value {
+			return fmt.Errorf("string src %s does not spell value %q", node.Src, node.Value)
+		}
+	}
+	*expr = StringExpr{Position: node.Pos, Value: node.Value, Src: node.Src}
+	return nil
+}
+
+func (expr RefExpr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string    `json:"type"`
+		Pos  token.Pos `json:"pos"`
+		Name string    `json:"name"`
+	}{"ref", expr.Postion, expr.Name})
+}
+
+func (expr *RefExpr) UnmarshalJSON(data []byte) error {
+	var node struct {
+		Pos  token.Pos `json:"pos"`
+		Name string    `json:"name"`
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	if node.Name == "" {
+		return errors.New("ref name is missing")
+	}
+	*expr = RefExpr{Postion: node.Pos, Name: node.Name}
+	return nil
+}
+
+func (expr UnaryExpr) MarshalJSON() ([]byte, error) {
+	op, err := opName(unaryOps, expr.Op)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Type string    `json:"type"`
+		Pos  token.Pos `json:"pos"`
+		Op   string    `json:"op"`
+		X    Expr      `json:"x"`
+	}{"unary", expr.Position, op, expr.X})
+}
+
+func (expr *UnaryExpr) UnmarshalJSON(data []byte) error {
+	var node struct {
+		Pos token.Pos       `json:"pos"`
+		Op  string          `json:"op"`
+		X   json.RawMessage `json:"x"`
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	op, err := opToken(unaryOps, node.Op)
+	if err != nil {
+		return err
+	}
+	x, err := UnmarshalExpr(node.X)
+	if err != nil {
+		return err
+	}
+	*expr = UnaryExpr{Position: node.Pos, Op: op, X: x}
+	return nil
+}
+
+func (expr BinaryExpr) MarshalJSON() ([]byte, error) {
+	op, err := opName(binaryOps, expr.Op)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Op   string `json:"op"`
+		X    Expr   `json:"x"`
+		Y    Expr   `json:"y"`
+	}{"binary", op, expr.X, expr.Y})
+}
+
+func (expr *BinaryExpr) UnmarshalJSON(data []byte) error {
+	var node struct {
+		Op string          `json:"op"`
+		X  json.RawMessage `json:"x"`
+		Y  json.RawMessage `json:"y"`
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	op, err := opToken(binaryOps, node.Op)
+	if err != nil {
+		return err
+	}
+	x, err := UnmarshalExpr(node.X)
+	if err != nil {
+		return err
+	}
+	y, err := UnmarshalExpr(node.Y)
+	if err != nil {
+		return err
+	}
+	*expr = BinaryExpr{X: x, Op: op, Y: y}
+	return nil
+}
+
+func (expr CallerExpr) MarshalJSON() ([]byte, error) {
+	args := expr.Args
+	if args == nil {
+		args = []Expr{}
+	}
+	return json.Marshal(struct {
+		Type string    `json:"type"`
+		Pos  token.Pos `json:"pos"`
+		Name string    `json:"name"`
+		Args []Expr    `json:"args"`
+	}{"call", expr.pos, expr.Name, args})
+}
+
+// UnmarshalJSON leaves the function unresolved, it is looked up in
+// DefaultRegistry when calculated. Use UnmarshalAST to resolve and check the
+// calls against a registry.
+func (expr *CallerExpr) UnmarshalJSON(data []byte) error {
+	var node struct {
+		Pos  token.Pos         `json:"pos"`
+		Name string            `json:"name"`
+		Args []json.RawMessage `json:"args"`
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	if node.Name == "" {
+		return errors.New("call name is missing")
+	}
+	args := make([]Expr, len(node.Args))
+	for i, raw := range node.Args {
+		arg, err := UnmarshalExpr(raw)
+		if err != nil {
+			return err
+		}
+		args[i] = arg
+	}
+	*expr = CallerExpr{Name: node.Name, Args: args, pos: node.Pos}
+	return nil
+}
+
+func (expr GroupExpr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Expr Expr   `json:"expr"`
+	}{"group", expr.Expr})
+}
+
+func (expr *GroupExpr) UnmarshalJSON(data []byte) error {
+	var node struct {
+		Expr json.RawMessage `json:"expr"`
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	inner, err := UnmarshalExpr(node.Expr)
+	if err != nil {
+		return err
+	}
+	expr.Expr = inner
+	return nil
+}
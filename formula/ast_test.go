@@ -0,0 +1,109 @@
+package formula
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAST(t *testing.T) {
+	Convey("every node round trips", t, func() {
+		vars := map[string]interface{}{"order": map[string]interface{}{"total": 120.5}, "name": "go"}
+		for _, text := range []string{
+			`-({order.total} - 0.50) * 2 ^ 2 >= 100 && !({name} == "x")`,
+			`IF(LEN({name}) > 1, UPPER({name}) & "\"!", "short")`,
+			`SUM({order.total}, 1.10, -1) % 7`,
+		} {
+			expr, err := ParseExpr(text)
+			So(err, ShouldBeNil)
+			data, err := MarshalAST(expr)
+			So(err, ShouldBeNil)
+
+			decoded, err := UnmarshalAST(data)
+			So(err, ShouldBeNil)
+			So(fmt.Sprint(decoded), ShouldEqual, fmt.Sprint(expr))
+			again, err := MarshalAST(decoded)
+			So(err, ShouldBeNil)
+			So(string(again), ShouldEqual, string(data))
+
+			want, err := Evaluate(context.Background(), expr, MapEnv(vars), WithDecimal(4, RoundHalfUp))
+			So(err, ShouldBeNil)
+			got, err := Evaluate(context.Background(), decoded, MapEnv(vars), WithDecimal(4, RoundHalfUp))
+			So(err, ShouldBeNil)
+			So(convertToText(got), ShouldEqual, convertToText(want))
+		}
+	})
+
+	Convey("ast documents", t, func() {
+		const doc = `{"version":1,"expr":{"type":"call","pos":0,"name":"discount","args":[
+			{"type":"ref","pos":9,"name":"price"},
+			{"type":"binary","op":"mul","x":{"type":"const","pos":17,"value":0.1,"src":"0.10"},"y":{"type":"const","pos":24,"value":2}}
+		]}}`
+		tenant := DefaultRegistry.Clone()
+		So(tenant.RegisterFunc("DISCOUNT", func(price, rate float64) float64 { return price * (1 - rate) }), ShouldBeNil)
+		expr, err := UnmarshalAST([]byte(doc), WithRegistry(tenant))
+		So(err, ShouldBeNil)
+		So(fmt.Sprint(expr), ShouldEqual, "DISCOUNT({price},(0.1*2))")
+		result, err := Evaluate(context.Background(), expr, MapEnv{"price": 50})
+		So(err, ShouldBeNil)
+		So(result, ShouldAlmostEqual, 40.0)
+
+		_, err = UnmarshalAST([]byte(doc))
+		So(err, ShouldNotBeNil)
+
+		// plain decoding resolves and checks the calls from DefaultRegistry
+		var ast AST
+		So(json.Unmarshal([]byte(doc), &ast), ShouldNotBeNil)
+		So(json.Unmarshal([]byte(`{"version":1,"expr":{"type":"call","pos":3,"name":"len","args":[{"type":"string","value":"abc"}]}}`), &ast), ShouldBeNil)
+		So(ast.Expr.Pos(), ShouldEqual, 3)
+		result, err = Evaluate(context.Background(), ast.Expr, nil)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 3.0)
+		So(json.Unmarshal([]byte(`{"version":1,"expr":{"type":"call","name":"LEN","args":[]}}`), &ast), ShouldNotBeNil)
+	})
+
+	Convey("calls built without the parser are checked", t, func() {
+		for _, call := range []*CallerExpr{
+			{Name: "LEN"},
+			{Name: "IF", Args: []Expr{&ConstExpr{Value: 1}}},
+			{Name: "IFS", Args: []Expr{&ConstExpr{Value: 1}, &ConstExpr{Value: 1}, &ConstExpr{Value: 0}}},
+			{Name: "NOPE"},
+		} {
+			_, err := Evaluate(context.Background(), call, nil)
+			So(err, ShouldNotBeNil)
+			_, err = Compile(call)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("invalid documents", t, func() {
+		for _, doc := range []string{
+			`{"version":2,"expr":{"type":"const","value":1}}`,
+			`{"expr":{"type":"const","value":1}}`,
+			`{"version":1,"expr":null}`,
+			`{"version":1,"expr":{"type":"lambda"}}`,
+			`{"version":1,"expr":{"type":"binary","op":"^","x":{"type":"const","value":1},"y":{"type":"const","value":1}}}`,
+			`{"version":1,"expr":{"type":"unary","op":"add","x":{"type":"const","value":1}}}`,
+			`{"version":1,"expr":{"type":"binary","op":"add","x":{"type":"const","value":1}}}`,
+			`{"version":1,"expr":{"type":"ref","name":""}}`,
+			`{"version":1,"expr":{"type":"const","value":1,"src":"x"}}`,
+			`{"version":1,"expr":{"type":"const","value":1,"src":"2"}}`,
+			`{"version":1,"expr":{"type":"const","value":1,"src":"1e999999999"}}`,
+			`{"version":1,"expr":{"type":"string","value":"a","src":"\"b\" & {secret}"}}`,
+			`{"version":1,"expr":{"type":"string","value":"a","src":"\"a\" & \"\""}}`,
+			`{"version":1,"expr":{"type":"string","value":"a","src":"'a'"}}`,
+			`{"version":1,"expr":{"type":"string","value":"a","src":"a"}}`,
+			`{"version":1,"expr":{"type":"call","name":"LEN","args":[{"type":"const","value":1}]}}`,
+			`{"version":1,"expr":{"type":"call","name":"NOPE","args":[]}}`,
+		} {
+			_, err := UnmarshalAST([]byte(doc))
+			So(err, ShouldNotBeNil)
+		}
+		_, err := UnmarshalAST([]byte(`{"version":2}`))
+		So(errors.Is(err, ErrASTVersion), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,239 @@
+package formula
+
+import (
+	"go/token"
+	"sort"
+)
+
+// VarTypes declares the types of variables for Check, e.g.
+// VarTypes{"price": TypeNumber, "tags": ArrayOf(TypeString)}. A reference
+// with a path such as {order.items[*].price} is declared by its full name,
+// it is of any type when only its root variable is declared.
+type VarTypes map[string]Type
+
+// Check parses expression and checks the operands of its operators and the
+// arguments of its calls against the declared types of the variables, so
+// that e.g. {name} * 2 with a string name is rejected when the formula is
+// saved rather than when it is evaluated. It returns the expression and
+// the type of its result.
+//
+// Type errors fail with a *ParserError like syntax errors, the result type
+// is then the best known. Types are checked like signatures: an operand
+// passes when one of its types fits, so variables of TypeAny always pass.
+func Check(expression string, types VarTypes, opts ...ParseOption) (Expr, Type, error) {
+	expr, err := ParseExpr(expression, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	c := &checker{types: types}
+	result := c.check(expr)
+	if len(c.diags) == 0 {
+		return expr, result, nil
+	}
+	var opt ParseOptions
+	for _, f := range opts {
+		f(&opt)
+	}
+	src := []rune(expression)
+	sort.SliceStable(c.diags, func(i, j int) bool { return c.diags[i].Pos < c.diags[j].Pos })
+	for _, diag := range c.diags {
+		diag.locate(src)
+	}
+	return expr, result, &ParserError{
+		Source:      expression,
+		Diagnostics: c.diags,
+		Language:    opt.Language,
+	}
+}
+
+type checker struct {
+	types VarTypes
+	diags []*Diagnostic
+}
+
+func (c *checker) report(code ErrorCode, expr Expr, args ...interface{}) {
+	c.diags = append(c.diags, &Diagnostic{
+		Code: code,
+		Pos:  expr.Pos(),
+		End:  expr.End(),
+		Args: args,
+	})
+}
+
+// check returns the type of expr, reporting the type errors within it.
+func (c *checker) check(expr Expr) Type {
+	switch expr := expr.(type) {
+	case *GroupExpr:
+		return c.check(expr.Expr)
+	case *ConstExpr:
+		return TypeNumber
+	case *StringExpr:
+		return TypeString
+	case *RefExpr:
+		return c.checkRef(expr)
+	case *UnaryExpr:
+		return c.checkUnary(expr)
+	case *BinaryExpr:
+		return c.checkBinary(expr)
+	case *CallerExpr:
+		return c.checkCall(expr)
+	default:
+		return TypeAny
+	}
+}
+
+func (c *checker) checkRef(expr *RefExpr) Type {
+	if typ, ok := c.types[expr.Name]; ok {
+		return typ
+	}
+	if root, path := splitRef(expr.Name); path != "" {
+		if _, ok := c.types[root]; ok {
+			return TypeAny
+		}
+	}
+	c.report(CodeUndeclaredVariable, expr, "{"+expr.Name+"}")
+	return TypeAny
+}
+
+func (c *checker) checkUnary(expr *UnaryExpr) Type {
+	x := c.check(expr.X)
+	if expr.Op == token.NOT {
+		if !(TypeBool | TypeNumber).Accepts(x) {
+			c.report(CodeOperandType, expr, expr.Op, operandsText{x})
+		}
+		return TypeBool
+	}
+	if !TypeNumber.Accepts(x) {
+		c.report(CodeOperandType, expr, expr.Op, operandsText{x})
+	}
+	return TypeNumber
+}
+
+func (c *checker) checkBinary(expr *BinaryExpr) Type {
+	x, y := c.check(expr.X), c.check(expr.Y)
+	var result, fallback Type
+	switch op := expr.Op; {
+	case op == token.AND:
+		return TypeString
+	case op == token.LAND || op == token.LOR:
+		if (TypeBool | TypeNumber).Accepts(x) && (TypeBool | TypeNumber).Accepts(y) {
+			result = TypeBool
+		}
+		fallback = TypeBool
+	case isComparison(op):
+		// operands of the same type, bools are only equal or not
+		comparable := TypeNumber | TypeString | TypeDate
+		if op == token.EQL || op == token.NEQ {
+			comparable |= TypeBool
+		}
+		if x&y&comparable != 0 {
+			result = TypeBool
+		}
+		fallback = TypeBool
+	case op == token.ADD || op == token.SUB:
+		result = dateArithmetic(op, x, y)
+		fallback = TypeNumber
+	default:
+		if TypeNumber.Accepts(x) && TypeNumber.Accepts(y) {
+			result = TypeNumber
+		}
+		fallback = TypeNumber
+	}
+	if result == 0 {
+		c.report(CodeOperandType, expr, expr.Op, operandsText{x, y})
+		return fallback
+	}
+	return result
+}
+
+// dateArithmetic returns the types of adding or subtracting numbers and
+// dates, none when the operands do not fit.
+func dateArithmetic(op token.Token, x, y Type) Type {
+	var result Type
+	if x&TypeNumber != 0 && y&TypeNumber != 0 {
+		result |= TypeNumber
+	}
+	if x&TypeDate != 0 && y&TypeNumber != 0 || op == token.ADD && x&TypeNumber != 0 && y&TypeDate != 0 {
+		result |= TypeDate
+	}
+	if op == token.SUB && x&TypeDate != 0 && y&TypeDate != 0 {
+		result |= TypeNumber
+	}
+	return result
+}
+
+func (c *checker) checkCall(expr *CallerExpr) Type {
+	if isLet(expr) {
+		return c.checkLet(expr)
+	}
+	args := make([]Type, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = c.check(arg)
+	}
+	def := expr.def
+	if def == nil {
+		var ok bool
+		if def, ok = DefaultRegistry.Lookup(expr.Name); !ok {
+			c.report(CodeUnknownFunction, expr, expr.Name)
+			return TypeAny
+		}
+	}
+	sig := def.Signature
+	for i, arg := range args {
+		if param := sig.Param(i); !param.Accepts(arg) {
+			c.report(CodeArgumentType, expr.Args[i], def.Name, i+1, param, arg)
+		}
+	}
+	// the conditional functions result in one of their values
+	var values []Type
+	switch def.Function.(type) {
+	case If:
+		values = args[1:]
+	case Ifs:
+		for i := 1; i < len(args); i += 2 {
+			values = append(values, args[i])
+		}
+	case Switch:
+		for i := 2; i < len(args); i += 2 {
+			values = append(values, args[i])
+		}
+		if len(args)%2 == 0 {
+			values = append(values, args[len(args)-1])
+		}
+	default:
+		return sig.Result
+	}
+	var result Type
+	for _, value := range values {
+		result = joinTypes(result, value)
+	}
+	return result
+}
+
+// checkLet declares the names bound by LET with the types of their values,
+// for the values after them and the body.
+func (c *checker) checkLet(expr *CallerExpr) Type {
+	outer := c.types
+	defer func() { c.types = outer }()
+	c.types = make(VarTypes, len(outer)+len(expr.Args)/2)
+	for name, typ := range outer {
+		c.types[name] = typ
+	}
+	for i := 0; i < len(expr.Args)-1; i += 2 {
+		value := c.check(expr.Args[i+1])
+		if name, err := bindingName(expr.Args[i]); err == nil {
+			c.types[name] = value
+		}
+	}
+	return c.check(expr.Args[len(expr.Args)-1])
+}
+
+// joinTypes returns the union of a and b, the items of arrays are of any
+// type when those of either are.
+func joinTypes(a, b Type) Type {
+	t := a | b
+	if a&TypeArray != 0 && a>>elemShift == 0 || b&TypeArray != 0 && b>>elemShift == 0 {
+		t &= TypeAny
+	}
+	return t
+}
@@ -0,0 +1,98 @@
+package formula
+
+import (
+	"errors"
+	"go/token"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheck(t *testing.T) {
+	types := VarTypes{
+		"name":     TypeString,
+		"price":    TypeNumber,
+		"paid":     TypeBool,
+		"due":      TypeDate,
+		"tags":     ArrayOf(TypeString),
+		"scores":   ArrayOf(TypeNumber),
+		"order":    TypeAny,
+		"anything": TypeAny,
+	}
+
+	Convey("inferred types", t, func() {
+		for expression, want := range map[string]Type{
+			"{price} * 2":                         TypeNumber,
+			`{name} & "!"`:                        TypeString,
+			"{price} > 1 && !{paid}":              TypeBool,
+			"{due} + 1":                           TypeDate,
+			"{due} - {due}":                       TypeNumber,
+			"{anything} + 1":                      TypeNumber | TypeDate,
+			`IF({paid}, {price}, "none")`:         TypeNumber | TypeString,
+			"IF({paid}, {tags}, {scores})":        ArrayOf(TypeString | TypeNumber),
+			"IF({paid}, {tags}, {order.items})":   TypeAny,
+			`IFS({paid}, 1, 1, "a")`:              TypeNumber | TypeString,
+			`SWITCH({price}, 1, "a", {due})`:      TypeString | TypeDate,
+			"SUM({scores}, {order.items[*].qty})": TypeNumber,
+			`DATEADD({due}, 1, "day")`:            TypeDate,
+			"{name} == {anything}":                TypeBool,
+			"{scores}":                            ArrayOf(TypeNumber),
+		} {
+			_, typ, err := Check(expression, types)
+			So(err, ShouldBeNil)
+			So(typ, ShouldEqual, want)
+		}
+		So(ArrayOf(TypeNumber).String(), ShouldEqual, "array<number>")
+		So((TypeString | ArrayOf(TypeNumber|TypeDate)).String(), ShouldEqual, "string|array<number|date>")
+		So(ArrayOf(TypeAny), ShouldEqual, TypeArray)
+	})
+
+	Convey("type errors", t, func() {
+		for expression, want := range map[string]struct {
+			code   ErrorCode
+			pos    token.Pos
+			end    token.Pos
+			result Type
+			msg    string
+		}{
+			"{name} * 2":          {CodeOperandType, 0, 10, TypeNumber, "1:1: operator * does not apply to string and number [F015]"},
+			"1 + -{name}":         {CodeOperandType, 4, 11, TypeNumber, "1:5: operator - does not apply to string [F015]"},
+			`{price} < "10"`:      {CodeOperandType, 0, 14, TypeBool, "1:1: operator < does not apply to number and string [F015]"},
+			"{paid} > {paid}":     {CodeOperandType, 0, 15, TypeBool, "1:1: operator > does not apply to bool and bool [F015]"},
+			"1 - {due}":           {CodeOperandType, 0, 9, TypeNumber, "1:1: operator - does not apply to number and date [F015]"},
+			"SUM(1, {tags})":      {CodeArgumentType, 7, 13, TypeNumber, "1:8: argument 2 of SUM expects number|array<number> but got array<string> [F013]"},
+			"LEN({price}) + 1":    {CodeArgumentType, 4, 11, TypeNumber, "1:5: argument 1 of LEN expects string but got number [F013]"},
+			"{total} * 2":         {CodeUndeclaredVariable, 0, 7, TypeNumber, "1:1: undeclared variable {total} [F016]"},
+			"{customer.name} & 1": {CodeUndeclaredVariable, 0, 15, TypeString, "1:1: undeclared variable {customer.name} [F016]"},
+		} {
+			expr, typ, err := Check(expression, types)
+			So(expr, ShouldNotBeNil)
+			So(typ, ShouldEqual, want.result)
+			var parserErr *ParserError
+			So(errors.As(err, &parserErr), ShouldBeTrue)
+			So(parserErr.Diagnostics, ShouldHaveLength, 1)
+			diag := parserErr.Diagnostics[0]
+			So(diag.Code, ShouldEqual, want.code)
+			So(diag.Pos, ShouldEqual, want.pos)
+			So(diag.End, ShouldEqual, want.end)
+			So(err.Error(), ShouldEqual, want.msg)
+		}
+	})
+
+	Convey("every type error is reported in source order", t, func() {
+		_, _, err := Check("LEN({price})\n  & {name} * 2", types, WithLanguage(Chinese))
+		var parserErr *ParserError
+		So(errors.As(err, &parserErr), ShouldBeTrue)
+		So(parserErr.Format(Chinese), ShouldEqual, "1:5: 函数 LEN 的第 1 个参数应为 string，实际为 number [F013]\n"+
+			"LEN({price})\n    ^~~~~~~\n"+
+			"2:5: 运算符 * 不能用于 string 和 number [F015]\n"+
+			"  & {name} * 2\n    ^~~~~~~~~~")
+	})
+
+	Convey("syntax errors come first", t, func() {
+		_, _, err := Check("{name} *", types)
+		var parserErr *ParserError
+		So(errors.As(err, &parserErr), ShouldBeTrue)
+		So(parserErr.Diagnostics[0].Code, ShouldEqual, CodeMissingOperand)
+	})
+}
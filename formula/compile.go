@@ -0,0 +1,454 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"strconv"
+	"sync"
+)
+
+var ErrNotNumber = errors.New("result is not a number")
+
+// Program is an expression compiled to a tree of closures. It evaluates
+// like the expression, without walking the AST through interface calls and
+// without boxing intermediate numbers, so numeric formulas over an Env
+// holding float64 values evaluate without allocations. Calls of MIN, MAX,
+// SUM, AVG and IF are inlined while their arguments are numbers, other calls
+// box their arguments for the function.
+//
+// A Program is safe for concurrent use. The decimal mode evaluates the
+// expression itself.
+type Program struct {
+	expr Expr
+	run  compiled
+}
+
+// Compile compiles expr for repeated evaluation. Calls built without the
+// parser are resolved from DefaultRegistry.
+func Compile(expr Expr) (*Program, error) {
+	run, err := compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{expr: expr, run: run}, nil
+}
+
+// Expr returns the compiled expression.
+func (p *Program) Expr() Expr {
+	return p.expr
+}
+
+// Eval evaluates the program with its variables resolved from env, like
+// Evaluate does for the expression.
+func (p *Program) Eval(ctx context.Context, env Env, opts ...EvalOption) (interface{}, error) {
+	result, err := p.eval(ctx, env, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.box(), nil
+}
+
+// EvalFloat evaluates a numeric program without boxing its result, results
+// other than numbers, including null, fail with ErrNotNumber.
+func (p *Program) EvalFloat(ctx context.Context, env Env, opts ...EvalOption) (float64, error) {
+	result, err := p.eval(ctx, env, opts)
+	if err != nil {
+		return 0, err
+	}
+	if result.isNum {
+		return result.num, nil
+	}
+	f, err := convertToFloat(result.boxed)
+	if err != nil || result.boxed == nil {
+		return 0, fmt.Errorf("%w: %s", ErrNotNumber, typeName(result.boxed))
+	}
+	return f, nil
+}
+
+func (p *Program) eval(ctx context.Context, env Env, opts []EvalOption) (operand, error) {
+	m := machines.Get().(*machine)
+	m.ctx, m.env, m.done = ctx, env, ctx.Done()
+	for _, f := range opts {
+		f(&m.opt)
+	}
+	var result operand
+	var err error
+	if m.opt.Decimal != nil {
+		var value interface{}
+		value, err = p.expr.Calculate(m.context())
+		result = boxOperand(value)
+	} else {
+		result, err = p.run(m)
+	}
+	m.reset()
+	machines.Put(m)
+	return result, err
+}
+
+// operand is a value of a compiled expression, numbers are kept unboxed.
+// The zero value is null.
+type operand struct {
+	num   float64
+	boxed interface{}
+	isNum bool
+}
+
+func numOperand(f float64) operand {
+	return operand{num: f, isNum: true}
+}
+
+func boxOperand(value interface{}) operand {
+	if f, ok := value.(float64); ok {
+		return numOperand(f)
+	}
+	return operand{boxed: value}
+}
+
+func (v operand) box() interface{} {
+	if v.isNum {
+		return v.num
+	}
+	return v.boxed
+}
+
+func (v operand) bool() (bool, error) {
+	if v.isNum {
+		return v.num != 0, nil
+	}
+	return convertToBool(v.boxed)
+}
+
+func (v operand) text() string {
+	if v.isNum {
+		return strconv.FormatFloat(v.num, 'f', -1, 64)
+	}
+	return convertToText(v.boxed)
+}
+
+// machine is the state of one evaluation, machines are pooled so that
+// evaluating does not allocate.
+type machine struct {
+	ctx context.Context
+	env Env
+	opt EvalOptions
+	// evalCtx carries the evaluation ev to functions, built on first use.
+	evalCtx context.Context
+	ev      *evaluation
+	// ops counts the operations until ev is built, done is ctx.Done().
+	ops  int
+	done <-chan struct{}
+	// stack holds the evaluated arguments of calls.
+	stack []operand
+}
+
+var machines = sync.Pool{
+	New: func() interface{} { return &machine{} },
+}
+
+func (m *machine) context() context.Context {
+	if m.evalCtx == nil {
+		m.ev = &evaluation{env: m.env, opt: m.opt, ops: m.ops}
+		m.evalCtx = context.WithValue(m.ctx, evaluationKey{}, m.ev)
+	}
+	return m.evalCtx
+}
+
+func (m *machine) reset() {
+	clear(m.stack)
+	m.ctx, m.env, m.opt, m.evalCtx, m.stack = nil, nil, EvalOptions{}, nil, m.stack[:0]
+	m.ev, m.ops, m.done = nil, 0, nil
+}
+
+// push evaluates args onto the stack, returning the evaluated values. The
+// caller pops them by truncating the stack to the returned base.
+func (m *machine) push(args []compiled) (values []operand, base int, err error) {
+	base = len(m.stack)
+	for _, arg := range args {
+		value, err := arg(m)
+		if err != nil {
+			m.stack = m.stack[:base]
+			return nil, base, err
+		}
+		m.stack = append(m.stack, value)
+	}
+	return m.stack[base:], base, nil
+}
+
+type compiled func(m *machine) (operand, error)
+
+func compile(expr Expr) (compiled, error) {
+	switch expr := expr.(type) {
+	case *GroupExpr:
+		return compile(expr.Expr)
+	case *ConstExpr:
+		value := numOperand(expr.Value)
+		return func(*machine) (operand, error) { return value, nil }, nil
+	case *StringExpr:
+		value := operand{boxed: expr.Value}
+		return func(*machine) (operand, error) { return value, nil }, nil
+	case *RefExpr:
+		return compileRef(expr), nil
+	case *UnaryExpr:
+		return compileUnary(expr)
+	case *BinaryExpr:
+		return compileBinary(expr)
+	case *CallerExpr:
+		return compileCall(expr)
+	default:
+		// other expressions are calculated by themselves
+		return func(m *machine) (operand, error) {
+			value, err := expr.Calculate(m.context())
+			return boxOperand(value), err
+		}, nil
+	}
+}
+
+func compileRef(expr *RefExpr) compiled {
+	return func(m *machine) (operand, error) {
+		if m.env == nil {
+			// Deprecated: resolving variables from context values.
+			return boxOperand(m.ctx.Value(expr.Name)), nil
+		}
+		value, ok := lookup(m.env, expr.Name)
+		if !ok && m.opt.Undefined == UndefinedAsError {
+			return operand{}, &ReferenceError{
+				Name: expr.Name,
+				Pos:  expr.Pos(),
+				End:  expr.End(),
+				Err:  ErrUndefinedVariable,
+			}
+		}
+		return boxOperand(value), nil
+	}
+}
+
+func compileUnary(expr *UnaryExpr) (compiled, error) {
+	x, err := compile(expr.X)
+	if err != nil {
+		return nil, err
+	}
+	op := expr.Op
+	return func(m *machine) (operand, error) {
+		if err := m.step(expr); err != nil {
+			return operand{}, err
+		}
+		X, err := x(m)
+		if err != nil {
+			return operand{}, err
+		}
+		switch {
+		case op == token.NOT:
+			cond, err := X.bool()
+			return operand{boxed: !cond}, err
+		case X.isNum && op == token.SUB:
+			return numOperand(-X.num), nil
+		case X.isNum:
+			return X, nil
+		}
+		result, err := unaryOperate(op, X.boxed)
+		return boxOperand(result), err
+	}, nil
+}
+
+func compileBinary(expr *BinaryExpr) (compiled, error) {
+	x, err := compile(expr.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := compile(expr.Y)
+	if err != nil {
+		return nil, err
+	}
+	op := expr.Op
+	if op == token.LAND || op == token.LOR {
+		return func(m *machine) (operand, error) {
+			if err := m.step(expr); err != nil {
+				return operand{}, err
+			}
+			X, err := x(m)
+			if err != nil {
+				return operand{}, err
+			}
+			cond, err := X.bool()
+			if err != nil || op == token.LAND && !cond || op == token.LOR && cond {
+				return operand{boxed: cond}, err
+			}
+			Y, err := y(m)
+			if err != nil {
+				return operand{}, err
+			}
+			cond, err = Y.bool()
+			return operand{boxed: cond}, err
+		}, nil
+	}
+	return func(m *machine) (operand, error) {
+		if err := m.step(expr); err != nil {
+			return operand{}, err
+		}
+		X, err := x(m)
+		if err != nil {
+			return operand{}, err
+		}
+		Y, err := y(m)
+		if err != nil {
+			return operand{}, err
+		}
+		switch {
+		case op == token.AND:
+			return operand{boxed: X.text() + Y.text()}, nil
+		case !X.isNum || !Y.isNum:
+			// decimals out of the decimal mode, text and bools
+			result, err := operate(op, X.box(), Y.box(), DecimalOptions{Scale: DefaultDecimalScale}, false)
+			return boxOperand(result), err
+		case isComparison(op):
+			return operand{boxed: compareResult(op, compareFloat(X.num, Y.num))}, nil
+		}
+		result, err := floatArithmetic(op, X.num, Y.num)
+		if err != nil {
+			return operand{}, err
+		}
+		return numOperand(result), nil
+	}, nil
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compileCall(expr *CallerExpr) (compiled, error) {
+	def, err := expr.function()
+	if err != nil {
+		return nil, err
+	}
+	args := make([]compiled, len(expr.Args))
+	for i, arg := range expr.Args {
+		var err error
+		if args[i], err = compile(arg); err != nil {
+			return nil, err
+		}
+	}
+	fn := def.Function
+	switch fn.(type) {
+	case If:
+		return compileIf(expr, args), nil
+	case Min, Max, Sum, Avg:
+		return compileAggregate(expr, fn, args), nil
+	}
+	if lazy, ok := fn.(LazyFunction); ok {
+		return func(m *machine) (operand, error) {
+			if err := m.step(expr); err != nil {
+				return operand{}, err
+			}
+			result, err := lazy.CalculateLazy(m.context(), expr.Args)
+			return boxOperand(result), expr.locate(err)
+		}, nil
+	}
+	return func(m *machine) (operand, error) {
+		if err := m.step(expr); err != nil {
+			return operand{}, err
+		}
+		values, base, err := m.push(args)
+		if err != nil {
+			return operand{}, err
+		}
+		result, err := m.call(expr, fn, values)
+		m.stack = m.stack[:base]
+		return result, err
+	}, nil
+}
+
+// call calls fn with the boxed values.
+func (m *machine) call(expr *CallerExpr, fn Function, values []operand) (operand, error) {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value.box()
+	}
+	var result interface{}
+	var err error
+	if ctxFn, ok := fn.(ContextFunction); ok {
+		result, err = ctxFn.CalculateContext(m.context(), args)
+	} else {
+		result, err = fn.Calculate(args)
+	}
+	if err != nil {
+		return operand{}, expr.locate(err)
+	}
+	return boxOperand(result), nil
+}
+
+func compileIf(expr *CallerExpr, args []compiled) compiled {
+	return func(m *machine) (operand, error) {
+		if err := m.step(expr); err != nil {
+			return operand{}, err
+		}
+		result, err := args[0](m)
+		if err != nil {
+			return operand{}, err
+		}
+		cond, err := result.bool()
+		if err != nil {
+			return operand{}, err
+		}
+		if cond {
+			return args[1](m)
+		}
+		if len(args) > 2 {
+			return args[2](m)
+		}
+		return operand{}, nil
+	}
+}
+
+// compileAggregate folds MIN, MAX, SUM and AVG of numbers, arrays, nulls and
+// decimals are left to fn.
+func compileAggregate(expr *CallerExpr, fn Function, args []compiled) compiled {
+	return func(m *machine) (operand, error) {
+		if err := m.step(expr); err != nil {
+			return operand{}, err
+		}
+		values, base, err := m.push(args)
+		if err != nil {
+			return operand{}, err
+		}
+		result, ok := aggregate(fn, values)
+		if !ok {
+			result, err = m.call(expr, fn, values)
+		}
+		m.stack = m.stack[:base]
+		return result, err
+	}
+}
+
+func aggregate(fn Function, values []operand) (operand, bool) {
+	var result float64
+	for i, value := range values {
+		if !value.isNum {
+			return operand{}, false
+		}
+		switch fn.(type) {
+		case Min:
+			if i == 0 || value.num < result {
+				result = value.num
+			}
+		case Max:
+			if i == 0 || value.num > result {
+				result = value.num
+			}
+		default:
+			result += value.num
+		}
+	}
+	if _, ok := fn.(Avg); ok {
+		result /= float64(len(values))
+	}
+	return numOperand(result), true
+}
@@ -0,0 +1,160 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompile(t *testing.T) {
+	Convey("programs evaluate like the tree", t, func() {
+		vars := map[string]interface{}{
+			"price": 12.5, "qty": 3, "rate": 0.1, "name": "abc", "ok": true,
+			"none": nil, "items": []interface{}{1.0, 2.0, 3.0},
+		}
+		for _, expression := range []string{
+			"{price} * {qty} * (1 - {rate})",
+			"-{price} ^ 2 + 10 % 4",
+			"{price} > 10 && !{ok} || {qty} >= 3",
+			`{name} & "-" & {qty} & {none}`,
+			"{none} + 1",
+			"SUM({price}, {qty}, 1) / AVG(1, 2, 3)",
+			"MIN({price}, {qty}) + MAX({items}) + SUM({items}, 1)",
+			`IF({price} > 100, "high", IF({ok}, {qty} * 2))`,
+			`IFS({qty} > 5, "a", 1, "b")`,
+			`UPPER({name}) & LEN({name})`,
+			`VALUE("1.5") + 1`,
+			"{missing} * 2",
+		} {
+			expr, err := ParseExpr(expression)
+			So(err, ShouldBeNil)
+			program, err := Compile(expr)
+			So(err, ShouldBeNil)
+			want, wantErr := Evaluate(context.Background(), expr, MapEnv(vars))
+			got, err := program.Eval(context.Background(), MapEnv(vars))
+			So(got, ShouldResemble, want)
+			So(err, ShouldResemble, wantErr)
+		}
+
+		for _, expression := range []string{"1 / 0", "{name} * 2", `!"a"`, "SUM({name})", "{missing} + 1"} {
+			expr, _ := ParseExpr(expression)
+			program, err := Compile(expr)
+			So(err, ShouldBeNil)
+			_, wantErr := Evaluate(context.Background(), expr, MapEnv(vars), WithUndefined(UndefinedAsError))
+			_, err = program.Eval(context.Background(), MapEnv(vars), WithUndefined(UndefinedAsError))
+			So(wantErr, ShouldNotBeNil)
+			So(err, ShouldResemble, wantErr)
+		}
+	})
+
+	Convey("decimal mode", t, func() {
+		expr, _ := ParseExpr("{a} + 0.2")
+		program, _ := Compile(expr)
+		result, err := program.Eval(context.Background(), MapEnv{"a": 0.1}, WithDecimal(2, RoundHalfUp))
+		So(err, ShouldBeNil)
+		So(convertToText(result), ShouldEqual, "0.3")
+		f, err := program.EvalFloat(context.Background(), MapEnv{"a": 0.1}, WithDecimal(2, RoundHalfUp))
+		So(err, ShouldBeNil)
+		So(f, ShouldEqual, 0.3)
+	})
+
+	Convey("EvalFloat", t, func() {
+		expr, _ := ParseExpr("{a} * 2")
+		program, _ := Compile(expr)
+		f, err := program.EvalFloat(context.Background(), MapEnv{"a": 1.5})
+		So(err, ShouldBeNil)
+		So(f, ShouldEqual, 3.0)
+		_, err = program.EvalFloat(context.Background(), MapEnv{})
+		So(errors.Is(err, ErrNotNumber), ShouldBeTrue)
+
+		_, err = Compile(&CallerExpr{Name: "NOPE"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("numeric programs do not allocate", t, func() {
+		expr, _ := ParseExpr("IF({price} > 10, SUM({price} * {qty}, -{rate}) / MAX({qty}, 1), 0)")
+		program, _ := Compile(expr)
+		env := MapEnv{"price": 12.5, "qty": 3.0, "rate": 0.1}
+		ctx := context.Background()
+		program.EvalFloat(ctx, env)
+		allocs := testing.AllocsPerRun(100, func() {
+			program.EvalFloat(ctx, env)
+		})
+		So(allocs, ShouldEqual, 0)
+	})
+
+	Convey("programs are safe for concurrent use", t, func() {
+		expr, _ := ParseExpr(`{x} * 2 + LEN("ab")`)
+		program, _ := Compile(expr)
+		results := make(chan float64, 64)
+		for i := 0; i < cap(results); i++ {
+			go func(x float64) {
+				f, _ := program.EvalFloat(context.Background(), MapEnv{"x": x})
+				results <- f - 2*x
+			}(float64(i))
+		}
+		for i := 0; i < cap(results); i++ {
+			So(<-results, ShouldEqual, 2.0)
+		}
+	})
+}
+
+const benchmarkFormula = "IF({price} > 10, SUM({price} * {qty}, -{rate}) / MAX({qty}, 1), 0) * (1 + {rate}) ^ 2"
+
+func benchmarkEnv() MapEnv {
+	return MapEnv{"price": 12.5, "qty": 3.0, "rate": 0.1}
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	expr, err := ParseExpr(benchmarkFormula)
+	if err != nil {
+		b.Fatal(err)
+	}
+	env, ctx := benchmarkEnv(), context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Evaluate(ctx, expr, env); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramEval(b *testing.B) {
+	expr, err := ParseExpr(benchmarkFormula)
+	if err != nil {
+		b.Fatal(err)
+	}
+	program, err := Compile(expr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	env, ctx := benchmarkEnv(), context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := program.EvalFloat(ctx, env); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramEvalParallel(b *testing.B) {
+	expr, err := ParseExpr(benchmarkFormula)
+	if err != nil {
+		b.Fatal(err)
+	}
+	program, err := Compile(expr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	env, ctx := benchmarkEnv(), context.Background()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := program.EvalFloat(ctx, env); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,261 @@
+package formula
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"math"
+	"strings"
+	"time"
+)
+
+// Dates are time.Time values. Date functions and date text are interpreted
+// in the time zone of the evaluation, UTC unless set with WithLocation.
+// Numbers added to or subtracted from a date are days, and the difference of
+// two dates is the number of days between them.
+
+// WithLocation sets the time zone of the evaluation.
+func WithLocation(loc *time.Location) EvalOption {
+	return func(opt *EvalOptions) { opt.Location = loc }
+}
+
+// WithClock sets the clock of NOW and TODAY, e.g. a fixed time in tests.
+func WithClock(clock func() time.Time) EvalOption {
+	return func(opt *EvalOptions) { opt.Clock = clock }
+}
+
+func evalLocation(ctx context.Context) *time.Location {
+	if ev := evaluationFrom(ctx); ev != nil && ev.opt.Location != nil {
+		return ev.opt.Location
+	}
+	return time.UTC
+}
+
+func evalNow(ctx context.Context) time.Time {
+	now := time.Now
+	if ev := evaluationFrom(ctx); ev != nil && ev.opt.Clock != nil {
+		now = ev.opt.Clock
+	}
+	return now().In(evalLocation(ctx))
+}
+
+// dateLayouts are the accepted layouts of date text, the ones without a
+// zone are read in the location of the evaluation.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseDate(text string, loc *time.Location) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", text)
+}
+
+// dateArg returns the date argument at index in loc, date text is parsed.
+func dateArg(args []interface{}, index int, loc *time.Location) (time.Time, error) {
+	switch arg := args[index].(type) {
+	case time.Time:
+		return arg.In(loc), nil
+	case string:
+		t, err := parseDate(arg, loc)
+		if err != nil {
+			return time.Time{}, argError(index, fmt.Errorf("%w: %v", ErrArgumentType, err))
+		}
+		return t.In(loc), nil
+	default:
+		return time.Time{}, argTypeError(index, "date", arg)
+	}
+}
+
+// formatDate formats a date as text, midnight as the date only.
+func formatDate(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// startOfDay returns the midnight of the day of t.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// maxDays is the number of days from year 1 to year 9999, the years of
+// dates.
+const maxDays = 9999 * 366
+
+// dateInRange fails for the dates beyond year 9999 or before year 1.
+func dateInRange(t time.Time) error {
+	if year := t.Year(); year < 1 || year > 9999 {
+		return fmt.Errorf("date should be between years 1 and 9999, got %d", year)
+	}
+	return nil
+}
+
+// addDays adds a number of days to t, the whole days on the calendar so
+// that the time of day is kept across daylight saving changes.
+func addDays(t time.Time, days float64) (time.Time, error) {
+	if math.IsNaN(days) || math.Abs(days) > maxDays {
+		return time.Time{}, fmt.Errorf("days should be between -%d and %d, got %v", maxDays, maxDays, days)
+	}
+	whole := math.Trunc(days)
+	t = t.AddDate(0, 0, int(whole)).Add(time.Duration((days - whole) * float64(24*time.Hour)))
+	return t, dateInRange(t)
+}
+
+// addMonths adds months to t, clamping the day to the end of the month like
+// Excel's EDATE: a month after January 31 is the end of February.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, last)-1)
+}
+
+// wallClock returns the time of the clock on the wall at t as UTC.
+func wallClock(t time.Time) time.Time {
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	return time.Date(year, month, day, hour, minute, second, t.Nanosecond(), time.UTC)
+}
+
+// dateOperate applies an arithmetic operator to a date operand: a date plus
+// or minus days, or the days between two dates.
+func dateOperate(op token.Token, x, y interface{}) (interface{}, error) {
+	X, xIsDate := x.(time.Time)
+	Y, yIsDate := y.(time.Time)
+	switch {
+	case xIsDate && yIsDate && op == token.SUB:
+		// days on the calendar, a day across a daylight saving change is
+		// still one day like addDays
+		return wallClock(X).Sub(wallClock(Y.In(X.Location()))).Hours() / 24, nil
+	case xIsDate && !yIsDate && (op == token.ADD || op == token.SUB):
+		days, err := convertToFloat(y)
+		if err != nil {
+			return nil, ErrArgumentType
+		}
+		if op == token.SUB {
+			days = -days
+		}
+		return addDays(X, days)
+	case yIsDate && !xIsDate && op == token.ADD:
+		return dateOperate(op, y, x)
+	default:
+		return nil, fmt.Errorf("operator %s is not supported for dates", op)
+	}
+}
+
+// dateUnits are the units of DATEDIFF and DATEADD, with the aliases of
+// Excel's DATEDIF.
+var dateUnits = map[string]string{
+	"year": "year", "years": "year", "y": "year", "yyyy": "year",
+	"month": "month", "months": "month", "m": "month",
+	"week": "week", "weeks": "week", "w": "week", "wk": "week",
+	"day": "day", "days": "day", "d": "day",
+	"hour": "hour", "hours": "hour", "h": "hour", "hh": "hour",
+	"minute": "minute", "minutes": "minute", "mi": "minute", "n": "minute",
+	"second": "second", "seconds": "second", "s": "second", "ss": "second",
+}
+
+func unitArg(args []interface{}, index int) (string, error) {
+	text, err := textArg(args, index)
+	if err != nil {
+		return "", err
+	}
+	unit, ok := dateUnits[strings.ToLower(strings.TrimSpace(text))]
+	if !ok {
+		return "", argError(index, fmt.Errorf("unknown date unit %q, use year, month, week, day, hour, minute or second", text))
+	}
+	return unit, nil
+}
+
+var unitDurations = map[string]time.Duration{
+	"hour":   time.Hour,
+	"minute": time.Minute,
+	"second": time.Second,
+}
+
+// dateDiff returns the number of complete units from a to b, negative when
+// b is before a.
+func dateDiff(a, b time.Time, unit string) float64 {
+	if b.Before(a) {
+		return -dateDiff(b, a, unit)
+	}
+	if d, ok := unitDurations[unit]; ok {
+		return float64(b.Sub(a) / d)
+	}
+	switch unit {
+	case "year", "month":
+		months := (b.Year()-a.Year())*12 + int(b.Month()-a.Month())
+		if addMonths(a, months).After(b) {
+			months--
+		}
+		if unit == "year" {
+			return float64(months / 12)
+		}
+		return float64(months)
+	default:
+		days := int(startOfDay(b).Sub(startOfDay(a)).Hours()/24 + 0.5)
+		if a.AddDate(0, 0, days).After(b) {
+			days--
+		}
+		if unit == "week" {
+			return float64(days / 7)
+		}
+		return float64(days)
+	}
+}
+
+// maxUnits bounds the units added by dateAdd to the years of dates.
+var maxUnits = map[string]float64{
+	"year":   9999,
+	"month":  9999 * 12,
+	"week":   maxDays / 7,
+	"day":    maxDays,
+	"hour":   maxDays * 24,
+	"minute": maxDays * 24 * 60,
+	"second": maxDays * 24 * 60 * 60,
+}
+
+// dateAdd adds n units to t, calendar units should be whole.
+func dateAdd(t time.Time, n float64, unit string) (time.Time, error) {
+	if max := maxUnits[unit]; math.IsNaN(n) || math.Abs(n) > max {
+		return time.Time{}, fmt.Errorf("%ss should be between -%.0f and %.0f, got %v", unit, max, max, n)
+	}
+	if d, ok := unitDurations[unit]; ok {
+		// a Duration spans less than 300 years, the whole days are added
+		// in UTC where they are all 24 hours
+		total := n * float64(d)
+		days := math.Trunc(total / float64(24*time.Hour))
+		result := t.UTC().AddDate(0, 0, int(days)).Add(time.Duration(total - days*float64(24*time.Hour)))
+		return result.In(t.Location()), dateInRange(result.In(t.Location()))
+	}
+	if n != math.Trunc(n) {
+		return time.Time{}, fmt.Errorf("%v %ss is not a whole number", n, unit)
+	}
+	var result time.Time
+	switch unit {
+	case "year":
+		result = addMonths(t, int(n)*12)
+	case "month":
+		result = addMonths(t, int(n))
+	case "week":
+		result = t.AddDate(0, 0, int(n)*7)
+	default:
+		result = t.AddDate(0, 0, int(n))
+	}
+	return result, dateInRange(result)
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
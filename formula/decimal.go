@@ -0,0 +1,445 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode decides how a decimal is rounded to fewer fraction digits.
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds to the nearest neighbor, ties away from zero.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds to the nearest neighbor, ties to the even one.
+	RoundHalfEven
+	// RoundDown truncates towards zero.
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+	// RoundCeiling rounds towards positive infinity.
+	RoundCeiling
+	// RoundFloor rounds towards negative infinity.
+	RoundFloor
+)
+
+func (mode RoundingMode) String() string {
+	switch mode {
+	case RoundHalfUp:
+		return "half_up"
+	case RoundHalfEven:
+		return "half_even"
+	case RoundDown:
+		return "down"
+	case RoundUp:
+		return "up"
+	case RoundCeiling:
+		return "ceiling"
+	case RoundFloor:
+		return "floor"
+	default:
+		return fmt.Sprintf("RoundingMode(%d)", int(mode))
+	}
+}
+
+// DefaultDecimalScale is the scale of decimals mixed into a float evaluation.
+const DefaultDecimalScale = 16
+
+// DecimalOptions configures the exact decimal mode of an evaluation. Sums,
+// differences and products are exact, Scale bounds the fraction digits of
+// the results that are not, such as quotients, averages and negative powers.
+type DecimalOptions struct {
+	Scale    int
+	Rounding RoundingMode
+}
+
+// WithDecimal evaluates numbers as exact decimals instead of float64.
+func WithDecimal(scale int, rounding RoundingMode) EvalOption {
+	return func(opt *EvalOptions) {
+		opt.Decimal = &DecimalOptions{Scale: scale, Rounding: rounding}
+	}
+}
+
+// decimalOptions returns the decimal settings of the evaluation, ok is false
+// when the evaluation runs in float mode.
+func decimalOptions(ctx context.Context) (opt DecimalOptions, ok bool) {
+	if ev := evaluationFrom(ctx); ev != nil && ev.opt.Decimal != nil {
+		return *ev.opt.Decimal, true
+	}
+	return DecimalOptions{Scale: DefaultDecimalScale, Rounding: RoundHalfUp}, false
+}
+
+var ErrInvalidDecimal = errors.New("invalid decimal")
+
+// Decimal is an arbitrary precision decimal number, coef * 10^-scale. The
+// zero value is 0. Decimals are immutable, operations return new values.
+type Decimal struct {
+	coef  *big.Int
+	scale int
+}
+
+var bigTen = big.NewInt(10)
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// NewDecimal returns unscaled * 10^-scale.
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return newDecimal(big.NewInt(unscaled), scale)
+}
+
+func newDecimal(coef *big.Int, scale int) Decimal {
+	if scale < 0 {
+		return Decimal{coef: new(big.Int).Mul(coef, pow10(-scale))}
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// maxDecimalDigits bounds the digits of the coefficient and the scale of
+// decimals, so that a literal or an operation cannot exhaust time and
+// memory, e.g. 1e999999999 or ((10^1024)^1024)^1024.
+const maxDecimalDigits = 4096
+
+// ParseDecimal parses a decimal literal such as "-12.50" or "1.5e-3" exactly.
+// Literals of more than 4096 digits, or with more fraction digits, are
+// invalid.
+func ParseDecimal(s string) (Decimal, error) {
+	text := strings.TrimSpace(s)
+	exp := 0
+	if i := strings.IndexAny(text, "eE"); i >= 0 {
+		e, err := strconv.Atoi(text[i+1:])
+		if err != nil || e > maxDecimalDigits || e < -maxDecimalDigits {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+		}
+		exp, text = e, text[:i]
+	}
+	intPart, fracPart, _ := strings.Cut(text, ".")
+	digits := strings.TrimLeft(intPart, "+-") + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" || strings.LastIndexAny(intPart, "+-") > 0 {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	if scale := len(fracPart) - exp; scale > maxDecimalDigits || len(digits)+max(0, -scale) > maxDecimalDigits {
+		return Decimal{}, fmt.Errorf("%w: %q exceeds %d digits", ErrInvalidDecimal, s, maxDecimalDigits)
+	}
+	coef, _ := new(big.Int).SetString(digits, 10)
+	if strings.HasPrefix(intPart, "-") {
+		coef.Neg(coef)
+	}
+	return newDecimal(coef, len(fracPart)-exp), nil
+}
+
+// DecimalFromFloat converts f by its shortest decimal representation, so
+// 0.1 becomes exactly 0.1.
+func DecimalFromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("%w: %v", ErrInvalidDecimal, f)
+	}
+	return ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+func (d Decimal) bigCoef() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// Scale returns the number of fraction digits.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// digits returns about the number of digits of the coefficient, one more at
+// most.
+func (d Decimal) digits() int {
+	return int(float64(d.bigCoef().BitLen())*math.Log10(2)) + 1
+}
+
+func (d Decimal) Sign() int {
+	return d.bigCoef().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// IsInteger reports whether d has no fraction part.
+func (d Decimal) IsInteger() bool {
+	if d.scale == 0 {
+		return true
+	}
+	return new(big.Int).Rem(d.bigCoef(), pow10(d.scale)).Sign() == 0
+}
+
+// rescale returns the coefficient of d at a larger scale.
+func (d Decimal) rescale(scale int) *big.Int {
+	if scale == d.scale {
+		return d.bigCoef()
+	}
+	return new(big.Int).Mul(d.bigCoef(), pow10(scale-d.scale))
+}
+
+func (d Decimal) Cmp(y Decimal) int {
+	scale := max(d.scale, y.scale)
+	return d.rescale(scale).Cmp(y.rescale(scale))
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.bigCoef()), scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{coef: new(big.Int).Abs(d.bigCoef()), scale: d.scale}
+}
+
+func (d Decimal) Add(y Decimal) Decimal {
+	scale := max(d.scale, y.scale)
+	return Decimal{coef: new(big.Int).Add(d.rescale(scale), y.rescale(scale)), scale: scale}
+}
+
+func (d Decimal) Sub(y Decimal) Decimal {
+	scale := max(d.scale, y.scale)
+	return Decimal{coef: new(big.Int).Sub(d.rescale(scale), y.rescale(scale)), scale: scale}
+}
+
+func (d Decimal) Mul(y Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.bigCoef(), y.bigCoef()), scale: d.scale + y.scale}
+}
+
+// Quo returns d / y rounded to scale fraction digits, trailing zeros of the
+// fraction are dropped. y must not be zero.
+func (d Decimal) Quo(y Decimal, scale int, mode RoundingMode) Decimal {
+	num, den := d.bigCoef(), y.bigCoef()
+	if e := scale - d.scale + y.scale; e >= 0 {
+		num = new(big.Int).Mul(num, pow10(e))
+	} else {
+		den = new(big.Int).Mul(den, pow10(-e))
+	}
+	return Decimal{coef: roundQuo(num, den, mode), scale: scale}.trim()
+}
+
+// Mod returns the remainder of d / y with the sign of d, like math.Mod. y
+// must not be zero.
+func (d Decimal) Mod(y Decimal) Decimal {
+	scale := max(d.scale, y.scale)
+	return Decimal{coef: new(big.Int).Rem(d.rescale(scale), y.rescale(scale)), scale: scale}
+}
+
+// PowInt returns d^n, negative powers are rounded to scale fraction digits.
+func (d Decimal) PowInt(n int, scale int, mode RoundingMode) Decimal {
+	if n < 0 {
+		return NewDecimal(1, 0).Quo(d.PowInt(-n, scale, mode), scale, mode)
+	}
+	return Decimal{coef: new(big.Int).Exp(d.bigCoef(), big.NewInt(int64(n)), nil), scale: d.scale * n}
+}
+
+// Round rounds d to scale fraction digits, a negative scale rounds to tens,
+// hundreds and so on. d is returned unchanged when it has no more digits.
+func (d Decimal) Round(scale int, mode RoundingMode) Decimal {
+	if d.scale <= scale {
+		return d
+	}
+	return newDecimal(roundQuo(d.bigCoef(), pow10(d.scale-scale), mode), scale)
+}
+
+// roundQuo returns num / den rounded to an integer.
+func roundQuo(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 || mode == RoundDown {
+		return q
+	}
+	sign := int64(num.Sign() * den.Sign())
+	switch {
+	case mode == RoundUp, mode == RoundCeiling && sign > 0, mode == RoundFloor && sign < 0:
+		return q.Add(q, big.NewInt(sign))
+	case mode == RoundCeiling, mode == RoundFloor:
+		return q
+	}
+	half := new(big.Int).Abs(r)
+	half.Lsh(half, 1)
+	switch half.CmpAbs(den) {
+	case 1:
+		q.Add(q, big.NewInt(sign))
+	case 0:
+		if mode == RoundHalfUp || q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(sign))
+		}
+	}
+	return q
+}
+
+// trim drops the trailing zeros of the fraction.
+func (d Decimal) trim() Decimal {
+	coef, scale := d.bigCoef(), d.scale
+	r := new(big.Int)
+	for scale > 0 {
+		q, _ := new(big.Int).QuoRem(coef, bigTen, r)
+		if r.Sign() != 0 {
+			break
+		}
+		coef, scale = q, scale-1
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Int64 returns the integer part of d, ok is false when it overflows.
+func (d Decimal) Int64() (n int64, ok bool) {
+	i := d.Round(0, RoundDown).bigCoef()
+	return i.Int64(), i.IsInt64()
+}
+
+// String formats d in plain notation keeping its scale, e.g. "1.50".
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.bigCoef()).String()
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// StringFixed formats d with exactly places fraction digits.
+func (d Decimal) StringFixed(places int, mode RoundingMode) string {
+	rounded := d.Round(places, mode)
+	return Decimal{coef: rounded.rescale(places), scale: places}.String()
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	result, err := ParseDecimal(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*d = result
+	return nil
+}
+
+// convertToDecimal converts a number value, floats by their shortest
+// representation.
+func convertToDecimal(data interface{}) (Decimal, error) {
+	switch result := data.(type) {
+	case Decimal:
+		return result, nil
+	case int:
+		return NewDecimal(int64(result), 0), nil
+	case float64:
+		return DecimalFromFloat(result)
+	default:
+		return Decimal{}, errors.New("类型转换错误")
+	}
+}
+
+// toDecimalValue converts the numbers of a value, including the items of
+// arrays, to decimals and keeps other values as they are.
+func toDecimalValue(data interface{}) interface{} {
+	switch result := data.(type) {
+	case int, float64:
+		if d, err := convertToDecimal(result); err == nil {
+			return d
+		}
+	case []interface{}:
+		items := make([]interface{}, len(result))
+		for i, item := range result {
+			items[i] = toDecimalValue(item)
+		}
+		return items
+	}
+	return data
+}
+
+// hasDecimal reports whether any of args, or of their items, is a decimal.
+func hasDecimal(args []interface{}) bool {
+	for _, arg := range args {
+		switch result := arg.(type) {
+		case Decimal:
+			return true
+		case []interface{}:
+			if hasDecimal(result) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decimalArithmetic applies an arithmetic operator to decimals.
+func decimalArithmetic(op token.Token, X, Y Decimal, opt DecimalOptions) (interface{}, error) {
+	switch op {
+	case token.ADD:
+		return X.Add(Y), nil
+	case token.SUB:
+		return X.Sub(Y), nil
+	case token.MUL:
+		if err := checkDecimalSize(op, X.digits()+Y.digits(), X.scale+Y.scale); err != nil {
+			return nil, err
+		}
+		return X.Mul(Y), nil
+	case token.QUO:
+		if Y.IsZero() {
+			return nil, errors.New("被除数不能为0")
+		}
+		return X.Quo(Y, opt.Scale, opt.Rounding), nil
+	case token.REM:
+		if Y.IsZero() {
+			return nil, errors.New("被除数不能为0")
+		}
+		return X.Mod(Y), nil
+	case token.XOR:
+		if n, ok := Y.Int64(); ok && Y.IsInteger() && n >= -maxDecimalPower && n <= maxDecimalPower {
+			if X.IsZero() && n < 0 {
+				return nil, fmt.Errorf("power %v^%v is not a finite number", X, Y)
+			}
+			// a negative power divides by the positive one
+			m := int(max(n, -n))
+			if err := checkDecimalSize(op, X.digits()*m, X.scale*m); err != nil {
+				return nil, err
+			}
+			return X.PowInt(int(n), opt.Scale, opt.Rounding), nil
+		}
+		result := math.Pow(X.Float64(), Y.Float64())
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return nil, fmt.Errorf("power %v^%v is not a finite number", X, Y)
+		}
+		d, err := DecimalFromFloat(result)
+		if err != nil {
+			return nil, err
+		}
+		return d.Round(opt.Scale, opt.Rounding), nil
+	default:
+		return 0, errors.New("不支持的操作符")
+	}
+}
+
+// checkDecimalSize fails an operation before it computes a result of about
+// digits coefficient digits and scale fraction digits beyond
+// maxDecimalDigits.
+func checkDecimalSize(op token.Token, digits, scale int) error {
+	if digits > maxDecimalDigits || scale > maxDecimalDigits {
+		return fmt.Errorf("decimal result of %s exceeds %d digits", op, maxDecimalDigits)
+	}
+	return nil
+}
+
+// maxDecimalPower bounds exact integer powers, larger exponents go through
+// float64.
+const maxDecimalPower = 1024
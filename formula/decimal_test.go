@@ -0,0 +1,136 @@
+package formula
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecimal(t *testing.T) {
+	evaluate := func(expression string, vars map[string]interface{}, opts ...EvalOption) (interface{}, error) {
+		expr, err := ParseExpr(expression)
+		if err != nil {
+			return nil, err
+		}
+		return Evaluate(context.Background(), expr, MapEnv(vars), opts...)
+	}
+	text := func(value interface{}) string {
+		return convertToText(value)
+	}
+
+	Convey("decimal arithmetic", t, func() {
+		vars := map[string]interface{}{"price": 0.1, "qty": 3, "items": []float64{0.1, 0.2, 0.3}}
+		cases := []struct {
+			expr   string
+			result string
+		}{
+			{"0.1 + 0.2", "0.3"},
+			{"{price} * {qty}", "0.3"},
+			{"1.10 + 2.205", "3.305"},
+			{"1.50 * 2", "3.00"},
+			{"10 / 4", "2.5"},
+			{"2 / 3", "0.6667"},
+			{"-2 / 3", "-0.6667"},
+			{"7.5 % 2", "1.5"},
+			{"1.1 ^ 2", "1.21"},
+			{"2 ^ -2", "0.25"},
+			{"4 ^ 0.5", "2"},
+			{"SUM({items})", "0.6"},
+			{"AVG({items}, 0.4)", "0.25"},
+			{"MAX({items}) - MIN({items})", "0.2"},
+			{"LEN(\"abc\") / 4", "0.75"},
+			{"VALUE(\"0.30000000000000001\")", "0.30000000000000001"},
+			{"TEXT(2.675, \"0.00\")", "2.68"},
+			{"0.1 + 0.2 & \"\"", "0.3"},
+		}
+		for _, c := range cases {
+			result, err := evaluate(c.expr, vars, WithDecimal(4, RoundHalfUp))
+			So(err, ShouldBeNil)
+			So(text(result), ShouldEqual, c.result)
+		}
+
+		result, err := evaluate("0.1 + 0.2 == 0.3", vars, WithDecimal(4, RoundHalfUp))
+		So(err, ShouldBeNil)
+		So(result, ShouldBeTrue)
+		result, err = evaluate("IF({price} * 3 == 0.3, 1, 0)", vars, WithDecimal(4, RoundHalfUp))
+		So(err, ShouldBeNil)
+		So(text(result), ShouldEqual, "1")
+
+		result, err = evaluate("0.1 + 0.2", vars)
+		So(err, ShouldBeNil)
+		So(result, ShouldHaveSameTypeAs, 0.0)
+
+		_, err = evaluate("1 / (0.5 - 0.5)", vars, WithDecimal(4, RoundHalfUp))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("rounding modes", t, func() {
+		cases := []struct {
+			expr     string
+			rounding RoundingMode
+			result   string
+		}{
+			{"5 / 8", RoundHalfUp, "0.63"},
+			{"5 / 8", RoundHalfEven, "0.62"},
+			{"7 / 8", RoundHalfEven, "0.88"},
+			{"5 / 8", RoundDown, "0.62"},
+			{"-5 / 8", RoundHalfUp, "-0.63"},
+			{"-5 / 8", RoundDown, "-0.62"},
+			{"2 / 3", RoundDown, "0.66"},
+		}
+		for _, c := range cases {
+			result, err := evaluate(c.expr, nil, WithDecimal(2, c.rounding))
+			So(err, ShouldBeNil)
+			So(text(result), ShouldEqual, c.result)
+		}
+	})
+
+	Convey("decimal values", t, func() {
+		d, err := ParseDecimal("-12.3450")
+		So(err, ShouldBeNil)
+		So(d.String(), ShouldEqual, "-12.3450")
+		So(d.Scale(), ShouldEqual, 4)
+		So(d.Round(2, RoundHalfUp).String(), ShouldEqual, "-12.35")
+		So(d.Round(2, RoundHalfEven).String(), ShouldEqual, "-12.34")
+		So(d.Round(-1, RoundHalfUp).String(), ShouldEqual, "-10")
+		So(d.StringFixed(6, RoundHalfUp), ShouldEqual, "-12.345000")
+
+		d, err = ParseDecimal("1.5e-3")
+		So(err, ShouldBeNil)
+		So(d.String(), ShouldEqual, "0.0015")
+		d, err = ParseDecimal("12e2")
+		So(err, ShouldBeNil)
+		So(d.String(), ShouldEqual, "1200")
+		for _, s := range []string{"", "-", "1.2.3", "1-2", "abc", "1e", "1e999999999", "1e-5000", "1e99999999999999999999", strings.Repeat("9", 5000)} {
+			_, err = ParseDecimal(s)
+			So(errors.Is(err, ErrInvalidDecimal), ShouldBeTrue)
+		}
+
+		// results are bounded rather than exhausting time and memory
+		for _, expression := range []string{`VALUE("1e999999999")`, "((10^1024)^1024)^1024", "(10^1024)^-1024", "(10^1024*10^1024)*(10^1024*10^1024)*10"} {
+			_, err := evaluate(expression, nil, WithDecimal(4, RoundHalfUp))
+			So(err, ShouldNotBeNil)
+		}
+		result, err := evaluate("0.5^1024 > 0 && 10^1024 > 10^1023", nil, WithDecimal(4, RoundHalfUp))
+		So(err, ShouldBeNil)
+		So(result, ShouldBeTrue)
+
+		So(NewDecimal(5, 1).Cmp(NewDecimal(50, 2)), ShouldEqual, 0)
+		data, err := json.Marshal(map[string]interface{}{"v": NewDecimal(1050, 2)})
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"v":10.50}`)
+		var v struct{ V Decimal }
+		So(json.Unmarshal([]byte(`{"V":"0.10"}`), &v), ShouldBeNil)
+		So(v.V.String(), ShouldEqual, "0.10")
+
+		// decimals from the environment are kept exact in float mode
+		one, _ := ParseDecimal("0.1")
+		result, err = evaluate("{a} + {a} + {a}", map[string]interface{}{"a": one})
+		So(err, ShouldBeNil)
+		So(text(result), ShouldEqual, "0.3")
+	})
+}
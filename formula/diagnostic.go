@@ -0,0 +1,245 @@
+package formula
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// ErrorCode identifies the kind of a parse diagnostic, codes are stable and
+// independent of the message language.
+type ErrorCode string
+
+const (
+	CodeUnexpectedToken  ErrorCode = "F001"
+	CodeEmptyExpression  ErrorCode = "F002"
+	CodeMissingOperand   ErrorCode = "F003"
+	CodeMissingOperator  ErrorCode = "F004"
+	CodeUnclosedParen    ErrorCode = "F005"
+	CodeInvalidNumber    ErrorCode = "F006"
+	CodeInvalidString    ErrorCode = "F007"
+	CodeInvalidReference ErrorCode = "F008"
+	CodeUnknownFunction  ErrorCode = "F009"
+	CodeMissingCallParen ErrorCode = "F010"
+	CodeMissingArgument  ErrorCode = "F011"
+	CodeArgumentCount    ErrorCode = "F012"
+	CodeArgumentType     ErrorCode = "F013"
+	CodeInvalidCall      ErrorCode = "F014"
+	// The codes of Check.
+	CodeOperandType        ErrorCode = "F015"
+	CodeUndeclaredVariable ErrorCode = "F016"
+)
+
+// Language selects the message catalog of diagnostics.
+type Language string
+
+const (
+	English Language = "en"
+	Chinese Language = "zh"
+)
+
+// messages are the fmt templates of the diagnostic messages, the arguments
+// of a code are the same in every language.
+var messages = map[Language]map[ErrorCode]string{
+	English: {
+		CodeUnexpectedToken:    "unexpected %s",
+		CodeEmptyExpression:    "expression is empty",
+		CodeMissingOperand:     "missing operand before %s",
+		CodeMissingOperator:    "missing operator before %s",
+		CodeUnclosedParen:      "missing closing parenthesis",
+		CodeInvalidNumber:      "invalid number %s",
+		CodeInvalidString:      "invalid string literal %s",
+		CodeInvalidReference:   "invalid reference %s",
+		CodeUnknownFunction:    "unknown function %s",
+		CodeMissingCallParen:   "missing ( after function %s",
+		CodeMissingArgument:    "missing argument %[2]d of %[1]s",
+		CodeArgumentCount:      "%s expects %s arguments but got %d",
+		CodeArgumentType:       "argument %[2]d of %[1]s expects %[3]s but got %[4]s",
+		CodeInvalidCall:        "invalid call of %s: %v",
+		CodeOperandType:        "operator %s does not apply to %s",
+		CodeUndeclaredVariable: "undeclared variable %s",
+	},
+	Chinese: {
+		CodeUnexpectedToken:    "意外的 %s",
+		CodeEmptyExpression:    "表达式为空",
+		CodeMissingOperand:     "%s 之前缺少操作数",
+		CodeMissingOperator:    "%s 之前缺少运算符",
+		CodeUnclosedParen:      "缺少右括号",
+		CodeInvalidNumber:      "无效的数字 %s",
+		CodeInvalidString:      "无效的字符串 %s",
+		CodeInvalidReference:   "无效的变量引用 %s",
+		CodeUnknownFunction:    "函数 %s 不存在",
+		CodeMissingCallParen:   "函数 %s 之后缺少左括号",
+		CodeMissingArgument:    "函数 %[1]s 缺少第 %[2]d 个参数",
+		CodeArgumentCount:      "函数 %s 需要 %s 个参数，实际为 %d 个",
+		CodeArgumentType:       "函数 %[1]s 的第 %[2]d 个参数应为 %[3]s，实际为 %[4]s",
+		CodeInvalidCall:        "函数 %s 调用无效: %v",
+		CodeOperandType:        "运算符 %s 不能用于 %s",
+		CodeUndeclaredVariable: "变量 %s 未声明",
+	},
+}
+
+// localized is a message argument worded by language.
+type localized interface {
+	text(lang Language) string
+}
+
+// arityText describes a number of arguments for CodeArgumentCount.
+type arityText struct {
+	min, max int
+}
+
+func (arity arityText) text(lang Language) string {
+	switch {
+	case arity.max < 0 && lang == Chinese:
+		return fmt.Sprintf("至少 %d", arity.min)
+	case arity.max < 0:
+		return fmt.Sprintf("at least %d", arity.min)
+	case arity.min == arity.max:
+		return fmt.Sprintf("%d", arity.min)
+	case lang == Chinese:
+		return fmt.Sprintf("%d 到 %d", arity.min, arity.max)
+	default:
+		return fmt.Sprintf("%d to %d", arity.min, arity.max)
+	}
+}
+
+// operandsText lists the operand types for CodeOperandType.
+type operandsText []Type
+
+func (operands operandsText) text(lang Language) string {
+	names := make([]string, len(operands))
+	for i, operand := range operands {
+		names[i] = operand.String()
+	}
+	if lang == Chinese {
+		return strings.Join(names, " 和 ")
+	}
+	return strings.Join(names, " and ")
+}
+
+// Diagnostic is a problem found while parsing or checking. Pos and End are character
+// offsets, Line and Column are 1 based.
+type Diagnostic struct {
+	Code   ErrorCode
+	Pos    token.Pos
+	End    token.Pos
+	Line   int
+	Column int
+	// Args are the arguments of the message template.
+	Args []interface{}
+	// Err is the underlying error, e.g. an *ArgumentError.
+	Err error
+}
+
+// Message returns the message in lang, English when lang has no catalog.
+func (diag *Diagnostic) Message(lang Language) string {
+	catalog, ok := messages[lang]
+	if !ok {
+		lang, catalog = English, messages[English]
+	}
+	args := make([]interface{}, len(diag.Args))
+	for i, arg := range diag.Args {
+		if arg, ok := arg.(localized); ok {
+			args[i] = arg.text(lang)
+			continue
+		}
+		args[i] = arg
+	}
+	return fmt.Sprintf(catalog[diag.Code], args...)
+}
+
+func (diag *Diagnostic) Error() string {
+	return fmt.Sprintf("%d:%d: %s [%s]", diag.Line, diag.Column, diag.Message(English), diag.Code)
+}
+
+func (diag *Diagnostic) Unwrap() error {
+	return diag.Err
+}
+
+// Snippet returns the source line of the diagnostic with a caret line
+// underlining it:
+//
+//	SUM(1, LEN(2))
+//	           ^
+func (diag *Diagnostic) Snippet(source string) string {
+	lines := strings.Split(source, "\n")
+	if diag.Line < 1 || diag.Line > len(lines) {
+		return ""
+	}
+	line := []rune(strings.TrimRight(lines[diag.Line-1], "\r"))
+	start := min(diag.Column-1, len(line))
+	width := max(int(diag.End-diag.Pos), 1)
+	width = max(min(width, len(line)-start), 1)
+	sb := strings.Builder{}
+	sb.WriteString(string(line))
+	sb.WriteByte('\n')
+	for _, ch := range line[:start] {
+		// keep tabs so that the caret lines up
+		if ch == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	sb.WriteByte('^')
+	sb.WriteString(strings.Repeat("~", width-1))
+	return sb.String()
+}
+
+// locate fills in the line and the column of pos.
+func (diag *Diagnostic) locate(src []rune) {
+	diag.Line, diag.Column = 1, 1
+	for i := 0; i < int(diag.Pos) && i < len(src); i++ {
+		if src[i] == '\n' {
+			diag.Line++
+			diag.Column = 1
+		} else {
+			diag.Column++
+		}
+	}
+}
+
+// ParserError holds the diagnostics of a failed parse or Check, in source
+// order.
+type ParserError struct {
+	Source      string
+	Diagnostics []*Diagnostic
+	// Language of Error, English by default.
+	Language Language
+}
+
+func (err *ParserError) Error() string {
+	if len(err.Diagnostics) == 0 {
+		return "unknow error"
+	}
+	diag := err.Diagnostics[0]
+	msg := fmt.Sprintf("%d:%d: %s [%s]", diag.Line, diag.Column, diag.Message(err.Language), diag.Code)
+	if more := len(err.Diagnostics) - 1; more > 0 {
+		if err.Language == Chinese {
+			return fmt.Sprintf("%s (另有 %d 个错误)", msg, more)
+		}
+		return fmt.Sprintf("%s (and %d more errors)", msg, more)
+	}
+	return msg
+}
+
+func (err *ParserError) Unwrap() []error {
+	errs := make([]error, len(err.Diagnostics))
+	for i, diag := range err.Diagnostics {
+		errs[i] = diag
+	}
+	return errs
+}
+
+// Format reports every diagnostic in lang with its source snippet.
+func (err *ParserError) Format(lang Language) string {
+	sb := strings.Builder{}
+	for i, diag := range err.Diagnostics {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		fmt.Fprintf(&sb, "%d:%d: %s [%s]\n%s", diag.Line, diag.Column, diag.Message(lang), diag.Code, diag.Snippet(err.Source))
+	}
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func parseDiagnostics(expression string, opts ...ParseOption) *ParserError {
+	_, err := ParseExpr(expression, opts...)
+	var parseErr *ParserError
+	So(errors.As(err, &parseErr), ShouldBeTrue)
+	return parseErr
+}
+
+func TestDiagnostics(t *testing.T) {
+	Convey("positions and snippets", t, func() {
+		src := "SUM(1,\n  2 +, 3)"
+		parseErr := parseDiagnostics(src)
+		So(parseErr.Diagnostics, ShouldHaveLength, 1)
+		diag := parseErr.Diagnostics[0]
+		So(diag.Code, ShouldEqual, CodeMissingOperand)
+		So(diag.Line, ShouldEqual, 2)
+		So(diag.Column, ShouldEqual, 6)
+		So(parseErr.Error(), ShouldEqual, `2:6: missing operand before "," [F003]`)
+		So(diag.Snippet(src), ShouldEqual, "  2 +, 3)\n     ^")
+
+		parseErr = parseDiagnostics(`LEN("abc", 1)`)
+		So(parseErr.Diagnostics[0].Code, ShouldEqual, CodeArgumentCount)
+		So(parseErr.Format(English), ShouldEqual, "1:1: LEN expects 1 arguments but got 2 [F012]\nLEN(\"abc\", 1)\n^~~~~~~~~~~~~")
+	})
+
+	Convey("several errors per parse", t, func() {
+		parseErr := parseDiagnostics(`NOPE(1) + (2 * ) + UPPER(1) + {a.b[} + "x`)
+		codes := make([]ErrorCode, 0)
+		for _, diag := range parseErr.Diagnostics {
+			codes = append(codes, diag.Code)
+		}
+		So(codes, ShouldResemble, []ErrorCode{CodeUnknownFunction, CodeMissingOperand, CodeArgumentType, CodeInvalidReference, CodeInvalidString})
+		So(parseErr.Error(), ShouldEndWith, "(and 4 more errors)")
+		var argErr *ArgumentError
+		So(errors.As(parseErr, &argErr), ShouldBeTrue)
+		So(argErr.Fn, ShouldEqual, "UPPER")
+
+		for expression, code := range map[string]ErrorCode{
+			"":          CodeEmptyExpression,
+			"()":        CodeEmptyExpression,
+			"1 2":       CodeMissingOperator,
+			"1)":        CodeUnexpectedToken,
+			"1 = 2":     CodeUnexpectedToken,
+			"(1 + 2":    CodeUnclosedParen,
+			"1.2.3":     CodeInvalidNumber,
+			"SUM 1":     CodeMissingCallParen,
+			"SUM(1,,2)": CodeMissingArgument,
+		} {
+			So(parseDiagnostics(expression).Diagnostics[0].Code, ShouldEqual, code)
+		}
+	})
+
+	Convey("chinese messages", t, func() {
+		parseErr := parseDiagnostics(`MID("abc") & NOPE(1)`, WithLanguage(Chinese))
+		So(parseErr.Error(), ShouldEqual, "1:1: 函数 MID 需要 3 个参数，实际为 1 个 [F012] (另有 1 个错误)")
+		So(parseErr.Diagnostics[1].Message(Chinese), ShouldEqual, "函数 NOPE 不存在")
+		So(parseErr.Diagnostics[1].Message("fr"), ShouldEqual, "unknown function NOPE")
+	})
+
+	Convey("calls without arguments", t, func() {
+		registry := DefaultRegistry.Clone()
+		So(registry.RegisterFunc("ANSWER", func() int { return 42 }), ShouldBeNil)
+		expr, err := ParseExpr("ANSWER() + 1", WithRegistry(registry))
+		So(err, ShouldBeNil)
+		result, err := expr.Calculate(context.Background())
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 43.0)
+
+		parseErr := parseDiagnostics("LEN()")
+		So(parseErr.Diagnostics[0].Code, ShouldEqual, CodeArgumentCount)
+	})
+}
@@ -0,0 +1,414 @@
+package formula
+
+import (
+	"go/token"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenKind classifies tokens for highlighting.
+type TokenKind int
+
+const (
+	TokenNumber TokenKind = iota + 1
+	TokenString
+	// TokenVariable is a reference such as {price}, with its braces.
+	TokenVariable
+	// TokenFunction is the name of a registered function.
+	TokenFunction
+	// TokenIdent is any other name.
+	TokenIdent
+	TokenOperator
+	TokenParen
+	TokenComma
+	// TokenInvalid is a character or literal that is not valid.
+	TokenInvalid
+)
+
+func (kind TokenKind) String() string {
+	switch kind {
+	case TokenNumber:
+		return "number"
+	case TokenString:
+		return "string"
+	case TokenVariable:
+		return "variable"
+	case TokenFunction:
+		return "function"
+	case TokenIdent:
+		return "ident"
+	case TokenOperator:
+		return "operator"
+	case TokenParen:
+		return "paren"
+	case TokenComma:
+		return "comma"
+	case TokenInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// Token is a token of a formula source, Start and End are byte offsets.
+type Token struct {
+	Kind  TokenKind
+	Tok   token.Token
+	Start int
+	End   int
+	Text  string
+}
+
+// Editor answers the questions of a formula editor about its source:
+// tokens to highlight, completions and signature help at the cursor, and
+// hover docs. It is tolerant of incomplete input, such as an unclosed call
+// or reference being typed, and never fails. Offsets are byte offsets of the
+// source, a cursor is the offset of the character after it.
+type Editor struct {
+	// Registry provides the functions, DefaultRegistry when nil.
+	Registry *Registry
+	// Vars are the variables offered by completion, with their types.
+	Vars VarTypes
+}
+
+func (e *Editor) registry() *Registry {
+	if e.Registry == nil {
+		return DefaultRegistry
+	}
+	return e.Registry
+}
+
+// source is a formula split into tokens, with the byte offsets of its
+// characters.
+type source struct {
+	text    string
+	offsets []int
+	tokens  []Token
+	// closed reports whether each variable token has its closing brace.
+	closed map[int]bool
+}
+
+func (e *Editor) scan(expression string) *source {
+	src := &source{text: expression, closed: make(map[int]bool)}
+	src.offsets = make([]int, 0, len(expression)+1)
+	for i := range expression {
+		src.offsets = append(src.offsets, i)
+	}
+	src.offsets = append(src.offsets, len(expression))
+
+	registry := e.registry()
+	scanner := NewFormulaScanner(expression)
+	for {
+		pos, tok, lit := scanner.Scan()
+		if tok == token.EOF {
+			break
+		}
+		kind := tokenKind(tok, lit)
+		if tok == token.LBRACE {
+			_, ok := scanner.scanUntil('}')
+			kind = TokenVariable
+			src.closed[len(src.tokens)] = ok
+		}
+		if kind == TokenIdent {
+			if _, ok := registry.Lookup(lit); ok {
+				kind = TokenFunction
+			}
+		}
+		start, end := src.offsets[pos], src.offsets[scanner.offset]
+		src.tokens = append(src.tokens, Token{
+			Kind:  kind,
+			Tok:   tok,
+			Start: start,
+			End:   end,
+			Text:  expression[start:end],
+		})
+	}
+	return src
+}
+
+func tokenKind(tok token.Token, lit string) TokenKind {
+	switch {
+	case tok == token.INT || tok == token.FLOAT:
+		return TokenNumber
+	case tok == token.STRING:
+		return TokenString
+	case tok == token.IDENT:
+		return TokenIdent
+	case tok == token.LPAREN || tok == token.RPAREN:
+		return TokenParen
+	case tok == token.COMMA:
+		return TokenComma
+	case tok == token.ILLEGAL && strings.HasPrefix(lit, `"`):
+		// a string being typed
+		return TokenString
+	case isUnaryOperator(tok) || isBinaryOperator(tok):
+		return TokenOperator
+	default:
+		return TokenInvalid
+	}
+}
+
+// Tokens returns the tokens of expression in source order, white space is
+// left out.
+func (e *Editor) Tokens(expression string) []Token {
+	return e.scan(expression).tokens
+}
+
+// cursorAt returns a cursor within the source, at the start of the
+// character it falls into.
+func (src *source) cursorAt(cursor int) int {
+	cursor = max(0, min(cursor, len(src.text)))
+	for cursor > 0 && cursor < len(src.text) && !utf8.RuneStart(src.text[cursor]) {
+		cursor--
+	}
+	return cursor
+}
+
+// before returns the index of the last token starting before the cursor, -1
+// when there is none.
+func (src *source) before(cursor int) int {
+	return sort.Search(len(src.tokens), func(i int) bool { return src.tokens[i].Start >= cursor }) - 1
+}
+
+// at returns the index of the token covering the cursor, -1 when there is
+// none. A cursor at the end of a token is at that token.
+func (src *source) at(cursor int) int {
+	i := src.before(cursor)
+	if i < 0 || cursor > src.tokens[i].End {
+		if i+1 < len(src.tokens) && src.tokens[i+1].Start == cursor {
+			return i + 1
+		}
+		return -1
+	}
+	return i
+}
+
+// CompletionKind is the kind of a completion.
+type CompletionKind int
+
+const (
+	CompletionFunction CompletionKind = iota + 1
+	CompletionVariable
+)
+
+// Completion is a suggestion replacing the bytes from Start to End with
+// Insert.
+type Completion struct {
+	Kind  CompletionKind
+	Label string
+	// Detail is the signature of a function or the type of a variable.
+	Detail string
+	Doc    string
+	Insert string
+	Start  int
+	End    int
+}
+
+// Complete returns the completions at the cursor: the variables matching a
+// reference being typed, the functions matching a name being typed, or all
+// of them where an operand is expected. Variables come before functions,
+// each sorted by name.
+func (e *Editor) Complete(expression string, cursor int) []Completion {
+	src := e.scan(expression)
+	cursor = src.cursorAt(cursor)
+	i := src.before(cursor)
+	if i >= 0 && cursor <= src.tokens[i].End {
+		tok := src.tokens[i]
+		switch {
+		case tok.Kind == TokenVariable && (cursor < tok.End || !src.closed[i]):
+			return e.completeVariable(src, i, cursor)
+		case tok.Tok == token.IDENT:
+			return e.completeFunction(src, i, expression[tok.Start:cursor])
+		case tok.Kind == TokenString, tok.Kind == TokenNumber, cursor == tok.End && expectOperator(tok):
+			return nil
+		}
+	}
+	if i >= 0 && expectOperator(src.tokens[i]) {
+		return nil
+	}
+	completions := e.variables("", cursor, cursor, "{", "}")
+	return append(completions, e.functions("", cursor, cursor, src.nextIs(cursor, token.LPAREN))...)
+}
+
+// expectOperator reports whether an operator follows tok rather than an
+// operand.
+func expectOperator(tok Token) bool {
+	switch tok.Kind {
+	case TokenNumber, TokenString, TokenVariable, TokenFunction, TokenIdent:
+		return true
+	default:
+		return tok.Tok == token.RPAREN
+	}
+}
+
+// nextIs reports whether the first token from offset is tok.
+func (src *source) nextIs(offset int, tok token.Token) bool {
+	i := src.before(offset) + 1
+	return i < len(src.tokens) && src.tokens[i].Tok == tok
+}
+
+func (e *Editor) completeVariable(src *source, i, cursor int) []Completion {
+	tok := src.tokens[i]
+	start := tok.Start + 1
+	for start < cursor && src.text[start] == ' ' {
+		start++
+	}
+	closing := "}"
+	if src.closed[i] {
+		closing = ""
+	}
+	return e.variables(src.text[start:cursor], start, cursor, "", closing)
+}
+
+func (e *Editor) completeFunction(src *source, i int, prefix string) []Completion {
+	tok := src.tokens[i]
+	return e.functions(prefix, tok.Start, tok.End, src.nextIs(tok.End, token.LPAREN))
+}
+
+// variables returns the variables starting with prefix, inserted between
+// the braces missing around them.
+func (e *Editor) variables(prefix string, start, end int, opening, closing string) []Completion {
+	names := make([]string, 0, len(e.Vars))
+	for name := range e.Vars {
+		if hasPrefixFold(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	completions := make([]Completion, len(names))
+	for i, name := range names {
+		completions[i] = Completion{
+			Kind:   CompletionVariable,
+			Label:  name,
+			Detail: e.Vars[name].String(),
+			Insert: opening + name + closing,
+			Start:  start,
+			End:    end,
+		}
+	}
+	return completions
+}
+
+// functions returns the functions starting with prefix, with the opening
+// parenthesis to insert unless called already.
+func (e *Editor) functions(prefix string, start, end int, called bool) []Completion {
+	registry := e.registry()
+	var completions []Completion
+	for _, name := range registry.Names() {
+		def, ok := registry.Lookup(name)
+		if !ok || !hasPrefixFold(name, prefix) {
+			continue
+		}
+		insert := name
+		if !called {
+			insert += "("
+		}
+		completions = append(completions, Completion{
+			Kind:   CompletionFunction,
+			Label:  name,
+			Detail: signatureLabel(def),
+			Doc:    def.Doc,
+			Insert: insert,
+			Start:  start,
+			End:    end,
+		})
+	}
+	return completions
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// signatureLabel formats a function like "LEFT(string, [number]) string".
+func signatureLabel(def *FunctionDef) string {
+	return def.Name + def.Signature.String()
+}
+
+// SignatureHelp describes the call around a cursor.
+type SignatureHelp struct {
+	Function *FunctionDef
+	// Label is the signature, like "LEFT(string, [number]) string".
+	Label string
+	// Arg is the index of the argument at the cursor, Param its type.
+	Arg   int
+	Param Type
+}
+
+// SignatureHelp returns the innermost call of a registered function around
+// the cursor, whose closing parenthesis may still be missing.
+func (e *Editor) SignatureHelp(expression string, cursor int) (*SignatureHelp, bool) {
+	src := e.scan(expression)
+	cursor = src.cursorAt(cursor)
+	type frame struct {
+		def *FunctionDef
+		arg int
+	}
+	var frames []frame
+	registry := e.registry()
+	for i, tok := range src.tokens {
+		if tok.Start >= cursor {
+			break
+		}
+		switch tok.Tok {
+		case token.LPAREN:
+			var def *FunctionDef
+			if i > 0 && src.tokens[i-1].Tok == token.IDENT {
+				def, _ = registry.Lookup(src.tokens[i-1].Text)
+			}
+			frames = append(frames, frame{def: def})
+		case token.RPAREN:
+			if len(frames) > 0 {
+				frames = frames[:len(frames)-1]
+			}
+		case token.COMMA:
+			if len(frames) > 0 {
+				frames[len(frames)-1].arg++
+			}
+		}
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		if def := frames[i].def; def != nil {
+			return &SignatureHelp{
+				Function: def,
+				Label:    signatureLabel(def),
+				Arg:      frames[i].arg,
+				Param:    def.Signature.Param(frames[i].arg),
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// Hover is the description of the token at a cursor.
+type Hover struct {
+	// Start and End are the bytes of the token.
+	Start int
+	End   int
+	// Title is the signature of a function, or a variable with its type
+	// like "{price} number".
+	Title string
+	Doc   string
+}
+
+// Hover describes the function or the declared variable at the cursor.
+func (e *Editor) Hover(expression string, cursor int) (*Hover, bool) {
+	src := e.scan(expression)
+	i := src.at(src.cursorAt(cursor))
+	if i < 0 {
+		return nil, false
+	}
+	tok := src.tokens[i]
+	switch tok.Kind {
+	case TokenFunction:
+		def, _ := e.registry().Lookup(tok.Text)
+		return &Hover{Start: tok.Start, End: tok.End, Title: signatureLabel(def), Doc: def.Doc}, true
+	case TokenVariable:
+		name := strings.TrimSpace(strings.TrimSuffix(tok.Text[1:], "}"))
+		if typ, ok := e.Vars[name]; ok {
+			return &Hover{Start: tok.Start, End: tok.End, Title: "{" + name + "} " + typ.String()}, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,137 @@
+package formula
+
+import (
+	"go/token"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEditor(t *testing.T) {
+	editor := &Editor{Vars: VarTypes{"price": TypeNumber, "profit": TypeNumber, "name": TypeString, "价格": TypeNumber}}
+
+	Convey("tokens", t, func() {
+		type tok struct {
+			Kind       TokenKind
+			Start, End int
+			Text       string
+		}
+		var tokens []tok
+		for _, token := range editor.Tokens(`SUM({价格}, 1.5) & foo ? "a`) {
+			tokens = append(tokens, tok{token.Kind, token.Start, token.End, token.Text})
+		}
+		So(tokens, ShouldResemble, []tok{
+			{TokenFunction, 0, 3, "SUM"},
+			{TokenParen, 3, 4, "("},
+			{TokenVariable, 4, 12, "{价格}"},
+			{TokenComma, 12, 13, ","},
+			{TokenNumber, 14, 17, "1.5"},
+			{TokenParen, 17, 18, ")"},
+			{TokenOperator, 19, 20, "&"},
+			{TokenIdent, 21, 24, "foo"},
+			{TokenInvalid, 25, 26, "?"},
+			{TokenString, 27, 29, `"a`},
+		})
+		So(editor.Tokens("{price"), ShouldResemble, []Token{{Kind: TokenVariable, Tok: token.LBRACE, Start: 0, End: 6, Text: "{price"}})
+		So(editor.Tokens(" "), ShouldBeEmpty)
+	})
+
+	Convey("completions", t, func() {
+		labels := func(completions []Completion) []string {
+			var labels []string
+			for _, completion := range completions {
+				labels = append(labels, completion.Label)
+			}
+			return labels
+		}
+		completions := editor.Complete("1 + su", 6)
+		So(labels(completions), ShouldResemble, []string{"SUBSTITUTE", "SUM", "SUMIF", "SUMPRODUCT"})
+		So(completions[1], ShouldResemble, Completion{
+			Kind:   CompletionFunction,
+			Label:  "SUM",
+			Detail: "SUM(number|array<number>...) number",
+			Doc:    builtinDocs["SUM"],
+			Insert: "SUM(",
+			Start:  4,
+			End:    6,
+		})
+		completions = editor.Complete("sux(1)", 2)
+		So(labels(completions), ShouldResemble, []string{"SUBSTITUTE", "SUM", "SUMIF", "SUMPRODUCT"})
+		So(completions[1].Insert, ShouldEqual, "SUM")
+		So(completions[1].End, ShouldEqual, 3)
+
+		completions = editor.Complete("1 + {pr", 7)
+		So(labels(completions), ShouldResemble, []string{"price", "profit"})
+		So(completions[0], ShouldResemble, Completion{Kind: CompletionVariable, Label: "price", Detail: "number", Insert: "price}", Start: 5, End: 7})
+		completions = editor.Complete("{ pri}", 5)
+		So(completions, ShouldResemble, []Completion{{Kind: CompletionVariable, Label: "price", Detail: "number", Insert: "price", Start: 2, End: 5}})
+		So(labels(editor.Complete("{价", 4)), ShouldResemble, []string{"价格"})
+
+		for _, expression := range []string{"", "1 + ", "IF(", "SUM(1, ", "-"} {
+			completions = editor.Complete(expression, len(expression))
+			So(completions, ShouldHaveLength, 4+len(DefaultRegistry.Names()))
+			So(completions[0].Insert, ShouldEqual, "{name}")
+			So(completions[4].Insert, ShouldEqual, completions[4].Label+"(")
+		}
+		for _, expression := range []string{"1 + 2", "{price} ", "SUM(1)", `"SU`, "1 + 2"} {
+			So(editor.Complete(expression, len(expression)), ShouldBeEmpty)
+		}
+		So(editor.Complete("{price}", 7), ShouldBeEmpty)
+		So(labels(editor.Complete("{price}", 3)), ShouldResemble, []string{"price", "profit"})
+	})
+
+	Convey("signature help", t, func() {
+		help, ok := editor.SignatureHelp(`LEFT("a, b", `, 12)
+		So(ok, ShouldBeTrue)
+		So(help.Function.Name, ShouldEqual, "LEFT")
+		So(help.Label, ShouldEqual, "LEFT(string, [number]) string")
+		So(help.Arg, ShouldEqual, 1)
+		So(help.Param, ShouldEqual, TypeNumber)
+
+		for expression, arg := range map[string]int{
+			`SUM(1, LEFT("a", 2), `: 2,
+			"SUM(1, (2":             1,
+			"sum(":                  0,
+			"SUM(1, foo(2, ":        1,
+		} {
+			help, ok = editor.SignatureHelp(expression, len(expression))
+			So(ok, ShouldBeTrue)
+			So(help.Function.Name, ShouldEqual, "SUM")
+			So(help.Arg, ShouldEqual, arg)
+		}
+		help, ok = editor.SignatureHelp("SUM(1, 2)", 5)
+		So(ok, ShouldBeTrue)
+		So(help.Arg, ShouldEqual, 0)
+		for _, expression := range []string{"1 + 2", "SUM(1) + ", "SUM"} {
+			_, ok = editor.SignatureHelp(expression, len(expression))
+			So(ok, ShouldBeFalse)
+		}
+	})
+
+	Convey("hover", t, func() {
+		hover, ok := editor.Hover("SUM({price})", 1)
+		So(ok, ShouldBeTrue)
+		So(hover, ShouldResemble, &Hover{Start: 0, End: 3, Title: "SUM(number|array<number>...) number", Doc: builtinDocs["SUM"]})
+		hover, ok = editor.Hover("SUM({price})", 3)
+		So(ok, ShouldBeTrue)
+		So(hover.Start, ShouldEqual, 0)
+		hover, ok = editor.Hover("SUM({ price })", 8)
+		So(ok, ShouldBeTrue)
+		So(hover, ShouldResemble, &Hover{Start: 4, End: 13, Title: "{price} number"})
+		hover, ok = editor.Hover("1+{价格}", 5)
+		So(ok, ShouldBeTrue)
+		So(hover.Title, ShouldEqual, "{价格} number")
+
+		for _, cursor := range []int{5, 20} {
+			_, ok = editor.Hover("1 + {total} + 2", cursor)
+			So(ok, ShouldBeFalse)
+		}
+		registry := DefaultRegistry.Clone()
+		So(registry.SetDoc("sum", "Adds."), ShouldBeTrue)
+		So(registry.SetDoc("nothing", "None."), ShouldBeFalse)
+		hover, _ = (&Editor{Registry: registry}).Hover("SUM(1)", 0)
+		So(hover.Doc, ShouldEqual, "Adds.")
+		hover, _ = editor.Hover("SUM(1)", 0)
+		So(hover.Doc, ShouldEqual, builtinDocs["SUM"])
+	})
+}
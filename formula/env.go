@@ -0,0 +1,432 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	xjson "github.com/k0923/go/json"
+)
+
+// Env resolves the variables referenced as {name} in a formula. ok is false
+// when the variable is not defined, a defined variable may still be null.
+type Env interface {
+	Lookup(name string) (value interface{}, ok bool)
+}
+
+// UndefinedPolicy decides what a reference to an undefined variable yields.
+type UndefinedPolicy int
+
+const (
+	// UndefinedAsNull evaluates undefined variables to null.
+	UndefinedAsNull UndefinedPolicy = iota
+	// UndefinedAsError fails the evaluation with a *ReferenceError.
+	UndefinedAsError
+)
+
+type EvalOptions struct {
+	Undefined UndefinedPolicy
+	// Decimal enables the exact decimal mode when not nil, see WithDecimal.
+	Decimal *DecimalOptions
+	// Location is the time zone of dates, UTC when nil.
+	Location *time.Location
+	// Clock returns the current time of NOW and TODAY, time.Now when nil.
+	Clock func() time.Time
+	// MaxOperations bounds the operators and calls evaluated, see
+	// WithMaxOperations.
+	MaxOperations int
+	// MaxCallDepth bounds the nested calls of user functions, see
+	// WithMaxCallDepth.
+	MaxCallDepth int
+}
+
+type EvalOption func(opt *EvalOptions)
+
+func WithUndefined(policy UndefinedPolicy) EvalOption {
+	return func(opt *EvalOptions) { opt.Undefined = policy }
+}
+
+var ErrUndefinedVariable = errors.New("undefined variable")
+
+// ReferenceError reports a variable reference that cannot be resolved.
+type ReferenceError struct {
+	Name string
+	Pos  token.Pos
+	End  token.Pos
+	Err  error
+}
+
+func (err *ReferenceError) Error() string {
+	return fmt.Sprintf("%v {%s},pos:%v,end:%v", err.Err, err.Name, err.Pos, err.End)
+}
+
+func (err *ReferenceError) Unwrap() error {
+	return err.Err
+}
+
+type evaluationKey struct{}
+
+// evaluation is the state of one Evaluate call, carried by the context.
+type evaluation struct {
+	env Env
+	opt EvalOptions
+	// ops counts the operations evaluated.
+	ops int
+}
+
+func evaluationFrom(ctx context.Context) *evaluation {
+	ev, _ := ctx.Value(evaluationKey{}).(*evaluation)
+	return ev
+}
+
+// WithEnv returns a context evaluating expressions against env.
+func WithEnv(ctx context.Context, env Env, opts ...EvalOption) context.Context {
+	ev := &evaluation{env: env}
+	for _, f := range opts {
+		f(&ev.opt)
+	}
+	return context.WithValue(ctx, evaluationKey{}, ev)
+}
+
+// Evaluate calculates expr with its variables resolved from env.
+func Evaluate(ctx context.Context, expr Expr, env Env, opts ...EvalOption) (interface{}, error) {
+	return expr.Calculate(WithEnv(ctx, env, opts...))
+}
+
+// PathEnv is implemented by environments that resolve nested references such
+// as {order.items[0].price} themselves. ok reports whether the root variable
+// (order) is defined.
+type PathEnv interface {
+	Env
+	LookupPath(name string) (value interface{}, ok bool)
+}
+
+// splitRef splits a reference into its root variable and the xjson path
+// selecting from it: "order.items[0]" yields "order" and ".items[0]".
+func splitRef(name string) (root, path string) {
+	if i := strings.IndexAny(name, ".["); i >= 0 {
+		return name[:i], name[i:]
+	}
+	return name, ""
+}
+
+// lookup resolves a reference from env, selecting nested values through the
+// xjson path engine. A path that selects nothing yields null.
+// The fields of structs are named like StructEnv names them.
+func lookup(env Env, name string) (interface{}, bool) {
+	root, path := splitRef(name)
+	if path == "" {
+		return env.Lookup(name)
+	}
+	if pathEnv, ok := env.(PathEnv); ok {
+		return pathEnv.LookupPath(name)
+	}
+	value, ok := env.Lookup(root)
+	if !ok || value == nil {
+		return nil, ok
+	}
+	return selectPath(reflect.ValueOf(value), path), true
+}
+
+// selectPath selects the value at path from value. Members and indexes are
+// walked with reflection, the rest of the path (e.g. from [*] or a slice on)
+// is applied by xjson to the tree of the value selected so far.
+func selectPath(value reflect.Value, path string) interface{} {
+	for path != "" {
+		for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+			value = value.Elem()
+		}
+		if !value.IsValid() {
+			return nil
+		}
+		var ok bool
+		if name, rest := pathMember(path); name != "" {
+			value, ok = member(value, name)
+			path = rest
+		} else if index, rest := pathIndex(path); index >= 0 {
+			value, ok = element(value, index)
+			path = rest
+		} else {
+			break
+		}
+		if !ok {
+			return nil
+		}
+	}
+	tree := treeOf(value)
+	if path == "" {
+		return tree
+	}
+	return normalizeValue(xjson.NewJSONObject(tree).Get(path).Value())
+}
+
+// pathMember splits ".name" off path, name is empty when path does not start
+// with a member.
+func pathMember(path string) (name, rest string) {
+	if !strings.HasPrefix(path, ".") {
+		return "", path
+	}
+	end := strings.IndexFunc(path[1:], func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if end < 0 {
+		return path[1:], ""
+	}
+	return path[1 : end+1], path[end+1:]
+}
+
+// pathIndex splits "[n]" off path, index is -1 when path does not start with
+// a non negative index.
+func pathIndex(path string) (index int, rest string) {
+	end := strings.IndexByte(path, ']')
+	if !strings.HasPrefix(path, "[") || end < 0 {
+		return -1, path
+	}
+	digits := path[1:end]
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return -1, path
+	}
+	index, err := strconv.Atoi(digits)
+	if err != nil {
+		return -1, path
+	}
+	return index, path[end+1:]
+}
+
+// member returns the field or map entry named name of value.
+func member(value reflect.Value, name string) (reflect.Value, bool) {
+	switch value.Kind() {
+	case reflect.Struct:
+		index, ok := fieldsOf(value.Type())[name]
+		if !ok {
+			return reflect.Value{}, false
+		}
+		field, err := value.FieldByIndexErr(index)
+		return field, err == nil
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		entry := value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+		return entry, entry.IsValid()
+	default:
+		return reflect.Value{}, false
+	}
+}
+
+// element returns the item at index of a slice or an array.
+func element(value reflect.Value, index int) (reflect.Value, bool) {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		if index >= value.Len() {
+			return reflect.Value{}, false
+		}
+		return value.Index(index), true
+	default:
+		return reflect.Value{}, false
+	}
+}
+
+// treeOf converts value to the maps and slices xjson selects from, structs
+// become maps of their fields named like StructEnv names them.
+func treeOf(value reflect.Value) interface{} {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	if !value.IsValid() || !value.CanInterface() {
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		if v, ok := value.Interface().(time.Time); ok {
+			return v
+		}
+		if v, ok := value.Interface().(Decimal); ok {
+			return v
+		}
+		fields := fieldsOf(value.Type())
+		tree := make(map[string]interface{}, len(fields))
+		for name, index := range fields {
+			if field, err := value.FieldByIndexErr(index); err == nil {
+				tree[name] = treeOf(field)
+			}
+		}
+		return tree
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		tree := make(map[string]interface{}, value.Len())
+		for iter := value.MapRange(); iter.Next(); {
+			tree[fmt.Sprint(iter.Key().Interface())] = treeOf(iter.Value())
+		}
+		return tree
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		tree := make([]interface{}, value.Len())
+		for i := range tree {
+			tree[i] = treeOf(value.Index(i))
+		}
+		return tree
+	default:
+		return normalizeValue(value.Interface())
+	}
+}
+
+// MapEnv resolves variables from a map.
+type MapEnv map[string]interface{}
+
+func (env MapEnv) Lookup(name string) (interface{}, bool) {
+	value, ok := env[name]
+	if !ok {
+		return nil, false
+	}
+	return normalizeValue(value), true
+}
+
+// StructEnv resolves variables from the exported fields of a struct (or a
+// pointer to it). A field is named by its `formula` tag, then its `json` tag,
+// then its Go name.
+func StructEnv(v interface{}) Env {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	return structEnv{value: value}
+}
+
+type structEnv struct {
+	value reflect.Value
+}
+
+var structFields sync.Map // reflect.Type -> map[string][]int
+
+func fieldsOf(typ reflect.Type) map[string][]int {
+	if fields, ok := structFields.Load(typ); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	for _, field := range reflect.VisibleFields(typ) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name := field.Name
+		for _, key := range []string{"formula", "json"} {
+			if tag, ok := field.Tag.Lookup(key); ok {
+				tagName, _, _ := strings.Cut(tag, ",")
+				if tagName == "-" {
+					name = ""
+				} else if tagName != "" {
+					name = tagName
+				}
+				break
+			}
+		}
+		if name != "" {
+			fields[name] = field.Index
+		}
+	}
+	structFields.Store(typ, fields)
+	return fields
+}
+
+func (env structEnv) Lookup(name string) (interface{}, bool) {
+	if env.value.Kind() != reflect.Struct {
+		return nil, false
+	}
+	index, ok := fieldsOf(env.value.Type())[name]
+	if !ok {
+		return nil, false
+	}
+	field, err := env.value.FieldByIndexErr(index)
+	if err != nil {
+		// embedded nil pointer
+		return nil, true
+	}
+	return normalizeValue(field.Interface()), true
+}
+
+// JSONEnv resolves variables from the members of a JSON object.
+func JSONEnv(obj xjson.JSONObject) Env {
+	return jsonEnv{obj: obj}
+}
+
+type jsonEnv struct {
+	obj xjson.JSONObject
+}
+
+func (env jsonEnv) Lookup(name string) (interface{}, bool) {
+	if env.obj == nil {
+		return nil, false
+	}
+	data, ok := env.obj.Value().(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	value, ok := data[name]
+	if !ok {
+		return nil, false
+	}
+	return normalizeValue(value), true
+}
+
+func (env jsonEnv) LookupPath(name string) (interface{}, bool) {
+	root, _ := splitRef(name)
+	if _, ok := env.Lookup(root); !ok {
+		return nil, false
+	}
+	return normalizeValue(env.obj.Get(name).Value()), true
+}
+
+// normalizeValue converts Go values to the value types of formulas: numbers
+// become float64, slices become []interface{}, and pointers are dereferenced.
+func normalizeValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil, float64, int, string, bool, time.Time:
+		return value
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = normalizeValue(item)
+		}
+		return result
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalizeValue(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = normalizeValue(rv.Index(i).Interface())
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -0,0 +1,159 @@
+package formula
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	xjson "github.com/k0923/go/json"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEnv(t *testing.T) {
+	type Item struct {
+		Price    float32 `json:"price"`
+		Count    int64   `formula:"qty" json:"count"`
+		Discount *float64
+		Skipped  int `json:"-"`
+	}
+	discount := 0.5
+	item := &Item{Price: 10, Count: 3, Discount: &discount}
+	expr, err := ParseExpr("{price} * {qty} * {Discount}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("struct env", t, func() {
+		result, err := Evaluate(context.Background(), expr, StructEnv(item))
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 15.0)
+
+		_, ok := StructEnv(item).Lookup("Skipped")
+		So(ok, ShouldBeFalse)
+		_, ok = StructEnv(item).Lookup("count")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("json env", t, func() {
+		obj, err := xjson.NewJSONObjectByString(`{"price": 2, "qty": 4, "Discount": null}`)
+		So(err, ShouldBeNil)
+		result, err := Evaluate(context.Background(), expr, JSONEnv(obj), WithUndefined(UndefinedAsError))
+		So(err, ShouldBeNil)
+		So(result, ShouldBeNil)
+	})
+
+	Convey("undefined variables", t, func() {
+		env := MapEnv{"price": 1, "qty": nil}
+		result, err := Evaluate(context.Background(), expr, env)
+		So(err, ShouldBeNil)
+		So(result, ShouldBeNil)
+
+		_, err = Evaluate(context.Background(), expr, env, WithUndefined(UndefinedAsError))
+		So(errors.Is(err, ErrUndefinedVariable), ShouldBeTrue)
+		var refErr *ReferenceError
+		So(errors.As(err, &refErr), ShouldBeTrue)
+		So(refErr.Name, ShouldEqual, "Discount")
+		So(refErr.Pos, ShouldEqual, 18)
+	})
+}
+
+func TestRefPath(t *testing.T) {
+	const order = `{"order": {"id": "A1", "items": [
+		{"price": 10, "qty": 2},
+		{"price": 5.5, "qty": 1},
+		{"price": null, "qty": 3}
+	]}}`
+	obj, err := xjson.NewJSONObjectByString(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(order), &data); err != nil {
+		t.Fatal(err)
+	}
+	type Item struct {
+		Price float64 `json:"price"`
+	}
+	envs := map[string]Env{
+		"json": JSONEnv(obj),
+		"map":  MapEnv(data),
+		"struct": MapEnv{"order": map[string]interface{}{
+			"id":    "A1",
+			"items": []*Item{{Price: 10}, {Price: 5.5}, nil},
+		}},
+	}
+	cases := []struct {
+		expr   string
+		result interface{}
+	}{
+		{"{order.id}", "A1"},
+		{"{order.items[0].price} * 2", 20.0},
+		{"{ order.items[1].price }", 5.5},
+		{"{order.items[5].price}", nil},
+		{"SUM({order.items[*].price})", 15.5},
+		{"AVG({order.items[*].price})", 7.75},
+		{"MAX({order.items[*].price}, 12)", 12.0},
+		{"SUM({order.items[0:2].price}, 1)", 16.5},
+	}
+
+	Convey("nested references", t, func() {
+		for _, env := range envs {
+			for _, c := range cases {
+				expr, err := ParseExpr(c.expr)
+				So(err, ShouldBeNil)
+				result, err := Evaluate(context.Background(), expr, env)
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, c.result)
+			}
+		}
+	})
+
+	Convey("nested fields are named like struct env fields", t, func() {
+		type Customer struct {
+			Name  string    `formula:"name" json:"full_name"`
+			Since time.Time `json:"since"`
+			Tags  map[string]int
+		}
+		env := MapEnv{"order": struct {
+			Customer *Customer `formula:"customer"`
+		}{&Customer{Name: "Ann", Since: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC), Tags: map[string]int{"vip": 1}}}}
+		for expression, want := range map[string]interface{}{
+			"{order.customer.name}":           "Ann",
+			"{order.customer.full_name}":      nil,
+			"{order.Customer.name}":           nil,
+			"YEAR({order.customer.since})":    2020.0,
+			"{order.customer.Tags.vip} + 1":   2.0,
+			"COUNT({order.customer.Tags[*]})": 1.0,
+			"{order.customer.name[0]}":        nil,
+		} {
+			expr, err := ParseExpr(expression)
+			So(err, ShouldBeNil)
+			result, err := Evaluate(context.Background(), expr, env)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, want)
+		}
+	})
+
+	Convey("undefined root", t, func() {
+		expr, err := ParseExpr("{customer.name}")
+		So(err, ShouldBeNil)
+		_, err = Evaluate(context.Background(), expr, JSONEnv(obj), WithUndefined(UndefinedAsError))
+		So(errors.Is(err, ErrUndefinedVariable), ShouldBeTrue)
+		_, err = Evaluate(context.Background(), expr, MapEnv(data), WithUndefined(UndefinedAsError))
+		So(errors.Is(err, ErrUndefinedVariable), ShouldBeTrue)
+	})
+
+	Convey("invalid references", t, func() {
+		for _, expr := range []string{"{}", "{ }", "{.a}", "{a[0}", "{a[*x]}", "{a"} {
+			_, err := ParseExpr(expr)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("aggregates reject non numeric items", t, func() {
+		_, err := calculate("SUM({names})", map[string]interface{}{"names": []string{"a"}})
+		So(errors.Is(err, ErrArgumentType), ShouldBeTrue)
+	})
+}
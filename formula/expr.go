@@ -2,11 +2,13 @@ package formula
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"go/token"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Node interface {
@@ -25,7 +27,27 @@ type RefExpr struct {
 }
 
 func (expr *RefExpr) Calculate(ctx context.Context) (interface{}, error) {
-	return ctx.Value(expr.Name), nil
+	if value, ok := scopeFrom(ctx).lookup(expr.Name); ok {
+		return value, nil
+	}
+	ev := evaluationFrom(ctx)
+	if ev == nil || ev.env == nil {
+		// Deprecated: resolving variables from context values, use Evaluate or WithEnv.
+		return ctx.Value(expr.Name), nil
+	}
+	value, ok := lookup(ev.env, expr.Name)
+	if !ok && ev.opt.Undefined == UndefinedAsError {
+		return nil, &ReferenceError{
+			Name: expr.Name,
+			Pos:  expr.Pos(),
+			End:  expr.End(),
+			Err:  ErrUndefinedVariable,
+		}
+	}
+	if ev.opt.Decimal != nil {
+		return toDecimalValue(value), nil
+	}
+	return value, nil
 }
 
 func (expr *RefExpr) Pos() token.Pos {
@@ -33,7 +55,8 @@ func (expr *RefExpr) Pos() token.Pos {
 }
 
 func (expr *RefExpr) End() token.Pos {
-	return expr.Postion + token.Pos(len(expr.Name)) + 1
+	// the name and its braces
+	return expr.Postion + token.Pos(len([]rune(expr.Name))) + 2
 }
 
 func (expr *RefExpr) String() string {
@@ -51,12 +74,22 @@ type ConstExpr struct {
 }
 
 func (expr *ConstExpr) Calculate(ctx context.Context) (interface{}, error) {
+	if _, ok := decimalOptions(ctx); ok {
+		// keep the precision of the source, 0.1 is exactly 0.1
+		if expr.Src != "" {
+			if d, err := ParseDecimal(expr.Src); err == nil {
+				return d, nil
+			}
+		}
+		return convertToDecimal(expr.Value)
+	}
 	return expr.Value, nil
 }
 
+// String returns the shortest decimal of the value, without an exponent
+// that the scanner would not read.
 func (expr *ConstExpr) String() string {
-	value := fmt.Sprintf("%f", expr.Value)
-	return strings.TrimRight(strings.TrimRight(value, "0"), ".")
+	return strconv.FormatFloat(expr.Value, 'f', -1, 64)
 }
 
 func (expr *ConstExpr) Pos() token.Pos {
@@ -67,6 +100,31 @@ func (expr *ConstExpr) End() token.Pos {
 	return expr.Position + token.Pos(len(expr.Src))
 }
 
+type StringExpr struct {
+	Position token.Pos `json:"pos"`
+	Value    string    `json:"value"`
+	Src      string    `json:"src"`
+}
+
+func (expr *StringExpr) Calculate(ctx context.Context) (interface{}, error) {
+	return expr.Value, nil
+}
+
+func (expr *StringExpr) String() string {
+	if expr.Src != "" {
+		return expr.Src
+	}
+	return strconv.Quote(expr.Value)
+}
+
+func (expr *StringExpr) Pos() token.Pos {
+	return expr.Position
+}
+
+func (expr *StringExpr) End() token.Pos {
+	return expr.Position + token.Pos(len([]rune(expr.String())))
+}
+
 type BinaryExpr struct {
 	X  Expr
 	Y  Expr
@@ -74,19 +132,55 @@ type BinaryExpr struct {
 }
 
 func (expr *BinaryExpr) Calculate(ctx context.Context) (interface{}, error) {
+	if err := step(ctx, expr); err != nil {
+		return nil, err
+	}
 	x, err := expr.X.Calculate(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if expr.Op == token.LAND || expr.Op == token.LOR {
+		return expr.logical(ctx, x)
+	}
 	y, err := expr.Y.Calculate(ctx)
 	if err != nil {
 		return nil, err
 	}
+	opt, decimal := decimalOptions(ctx)
+	return operate(expr.Op, x, y, opt, decimal)
+}
+
+// operate applies a binary operator other than && and || to its operands,
+// decimal selects the exact decimal mode.
+func operate(op token.Token, x, y interface{}, opt DecimalOptions, decimal bool) (interface{}, error) {
+	if op == token.AND {
+		return convertToText(x) + convertToText(y), nil
+	}
 
 	if x == nil || y == nil {
 		return nil, nil
 	}
 
+	if isComparison(op) {
+		return compare(op, x, y)
+	}
+
+	if isDate(x) || isDate(y) {
+		return dateOperate(op, x, y)
+	}
+
+	if decimal || isDecimalValue(x) || isDecimalValue(y) {
+		X, err := convertToDecimal(x)
+		if err != nil {
+			return nil, errors.New("参数类型错误")
+		}
+		Y, err := convertToDecimal(y)
+		if err != nil {
+			return nil, errors.New("参数类型错误")
+		}
+		return decimalArithmetic(op, X, Y, opt)
+	}
+
 	X, err := convertToFloat(x)
 	if err != nil {
 		return nil, errors.New("参数类型错误")
@@ -95,8 +189,15 @@ func (expr *BinaryExpr) Calculate(ctx context.Context) (interface{}, error) {
 	if err != nil {
 		return nil, errors.New("参数类型错误")
 	}
+	result, err := floatArithmetic(op, X, Y)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-	switch expr.Op {
+func floatArithmetic(op token.Token, X, Y float64) (float64, error) {
+	switch op {
 	case token.ADD:
 		return X + Y, nil
 	case token.SUB:
@@ -105,24 +206,57 @@ func (expr *BinaryExpr) Calculate(ctx context.Context) (interface{}, error) {
 		return X * Y, nil
 	case token.QUO:
 		if Y == 0 {
-			return nil, errors.New("被除数不能为0")
+			return 0, errors.New("被除数不能为0")
 		}
 		return X / Y, nil
+	case token.REM:
+		if Y == 0 {
+			return 0, errors.New("被除数不能为0")
+		}
+		return math.Mod(X, Y), nil
+	case token.XOR:
+		result := math.Pow(X, Y)
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return 0, fmt.Errorf("power %v^%v is not a finite number", X, Y)
+		}
+		return result, nil
 	default:
 		return 0, errors.New("不支持的操作符")
 	}
 }
 
-func (expr BinaryExpr) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
-		"x":  expr.X,
-		"y":  expr.Y,
-		"op": expr.Op.String(),
-	})
+// logical evaluates && and || with short circuit, y is only calculated when
+// x does not decide the result.
+func (expr *BinaryExpr) logical(ctx context.Context, x interface{}) (interface{}, error) {
+	X, err := convertToBool(x)
+	if err != nil {
+		return nil, err
+	}
+	if expr.Op == token.LAND && !X || expr.Op == token.LOR && X {
+		return X, nil
+	}
+	y, err := expr.Y.Calculate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return convertToBool(y)
 }
 
 func (expr *BinaryExpr) String() string {
-	return fmt.Sprintf("(%s%s%s)", expr.X, expr.Op, expr.Y)
+	return fmt.Sprintf("(%s%s%s)", operandString(expr.X, expr.Op), expr.Op, expr.Y)
+}
+
+// operandString keeps a unary left operand of a tighter binding operator in
+// parentheses, (-2)^2 would read as -(2^2) otherwise.
+func operandString(expr Expr, op token.Token) string {
+	inner := expr
+	if grp, ok := inner.(*GroupExpr); ok {
+		inner = grp.Expr
+	}
+	if _, ok := inner.(*UnaryExpr); ok && precedence(op) > unaryPrecedence {
+		return fmt.Sprintf("(%s)", expr)
+	}
+	return fmt.Sprintf("%s", expr)
 }
 
 func (expr *BinaryExpr) Pos() token.Pos {
@@ -133,27 +267,303 @@ func (expr *BinaryExpr) End() token.Pos {
 	return expr.Y.End()
 }
 
+func isComparison(op token.Token) bool {
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return true
+	default:
+		return false
+	}
+}
+
+func compare(op token.Token, x, y interface{}) (interface{}, error) {
+	if X, ok := x.(string); ok {
+		Y, ok := y.(string)
+		if !ok {
+			return nil, errors.New("cannot compare string with non string value")
+		}
+		return compareResult(op, strings.Compare(X, Y)), nil
+	}
+	if X, ok := x.(bool); ok {
+		Y, ok := y.(bool)
+		if !ok {
+			return nil, errors.New("cannot compare bool with non bool value")
+		}
+		switch op {
+		case token.EQL:
+			return X == Y, nil
+		case token.NEQ:
+			return X != Y, nil
+		default:
+			return nil, fmt.Errorf("operator %s is not supported for bool", op)
+		}
+	}
+	if isDate(x) || isDate(y) {
+		X, xok := x.(time.Time)
+		Y, yok := y.(time.Time)
+		if !xok || !yok {
+			return nil, errors.New("cannot compare date with non date value")
+		}
+		return compareResult(op, X.Compare(Y)), nil
+	}
+	if isDecimalValue(x) || isDecimalValue(y) {
+		X, err := convertToDecimal(x)
+		if err != nil {
+			return nil, errors.New("参数类型错误")
+		}
+		Y, err := convertToDecimal(y)
+		if err != nil {
+			return nil, errors.New("参数类型错误")
+		}
+		return compareResult(op, X.Cmp(Y)), nil
+	}
+	X, err := convertToFloat(x)
+	if err != nil {
+		return nil, errors.New("参数类型错误")
+	}
+	Y, err := convertToFloat(y)
+	if err != nil {
+		return nil, errors.New("参数类型错误")
+	}
+	switch {
+	case X < Y:
+		return compareResult(op, -1), nil
+	case X > Y:
+		return compareResult(op, 1), nil
+	default:
+		return compareResult(op, 0), nil
+	}
+}
+
+// compareResult applies a comparison operator to the result of a three way
+// comparison.
+func compareResult(op token.Token, result int) bool {
+	switch op {
+	case token.EQL:
+		return result == 0
+	case token.NEQ:
+		return result != 0
+	case token.LSS:
+		return result < 0
+	case token.LEQ:
+		return result <= 0
+	case token.GTR:
+		return result > 0
+	default:
+		return result >= 0
+	}
+}
+
+// convertToText converts a value for concatenation, null is empty text.
+func convertToText(data interface{}) string {
+	switch result := data.(type) {
+	case nil:
+		return ""
+	case string:
+		return result
+	case bool:
+		if result {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int:
+		return strconv.Itoa(result)
+	case float64:
+		return strconv.FormatFloat(result, 'f', -1, 64)
+	case Decimal:
+		return result.String()
+	case time.Time:
+		return formatDate(result)
+	default:
+		return fmt.Sprintf("%v", result)
+	}
+}
+
+// typeName names the formula type of a value in error messages.
+func typeName(data interface{}) string {
+	switch data.(type) {
+	case nil:
+		return "null"
+	case int, float64, Decimal:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	default:
+		return fmt.Sprintf("%T", data)
+	}
+}
+
+// convertToBool converts a condition value, numbers are true when not 0 and
+// null is false.
+func convertToBool(data interface{}) (bool, error) {
+	switch result := data.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return result, nil
+	case int:
+		return result != 0, nil
+	case float64:
+		return result != 0, nil
+	case Decimal:
+		return !result.IsZero(), nil
+	default:
+		return false, errors.New("参数不是布尔类型")
+	}
+}
+
 func convertToFloat(data interface{}) (float64, error) {
 	switch result := data.(type) {
 	case int:
 		return float64(result), nil
 	case float64:
 		return result, nil
+	case Decimal:
+		return result.Float64(), nil
 	default:
 		return 0, errors.New("类型转换错误")
 	}
 }
 
+func isDecimalValue(data interface{}) bool {
+	_, ok := data.(Decimal)
+	return ok
+}
+
+func isDate(data interface{}) bool {
+	_, ok := data.(time.Time)
+	return ok
+}
+
+type UnaryExpr struct {
+	Position token.Pos
+	Op       token.Token
+	X        Expr
+}
+
+func (expr *UnaryExpr) Calculate(ctx context.Context) (interface{}, error) {
+	if err := step(ctx, expr); err != nil {
+		return nil, err
+	}
+	x, err := expr.X.Calculate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return unaryOperate(expr.Op, x)
+}
+
+func unaryOperate(op token.Token, x interface{}) (interface{}, error) {
+	switch op {
+	case token.NOT:
+		X, err := convertToBool(x)
+		if err != nil {
+			return nil, err
+		}
+		return !X, nil
+	case token.ADD, token.SUB:
+		if x == nil {
+			return nil, nil
+		}
+		if X, ok := x.(Decimal); ok {
+			if op == token.SUB {
+				return X.Neg(), nil
+			}
+			return X, nil
+		}
+		X, err := convertToFloat(x)
+		if err != nil {
+			return nil, errors.New("参数类型错误")
+		}
+		if op == token.SUB {
+			return -X, nil
+		}
+		return X, nil
+	default:
+		return nil, errors.New("不支持的操作符")
+	}
+}
+
+func (expr *UnaryExpr) String() string {
+	return fmt.Sprintf("%s%s", expr.Op, expr.X)
+}
+
+func (expr *UnaryExpr) Pos() token.Pos {
+	return expr.Position
+}
+
+func (expr *UnaryExpr) End() token.Pos {
+	return expr.X.End()
+}
+
+func isUnaryOperator(tok token.Token) bool {
+	return tok == token.NOT || tok == token.ADD || tok == token.SUB
+}
+
+func isBinaryOperator(tok token.Token) bool {
+	switch tok {
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.XOR, token.AND, token.LAND, token.LOR:
+		return true
+	default:
+		return isComparison(tok)
+	}
+}
+
+// unaryPrecedence binds prefix operators tighter than * / % but looser than
+// ^, so -2^2 is -(2^2).
+const unaryPrecedence = 7
+
+// precedence of binary operators, ^ (token.XOR) is the power operator and
+// & (token.AND) concatenates text.
+func precedence(tok token.Token) int {
+	switch tok {
+	case token.LOR:
+		return 1
+	case token.LAND:
+		return 2
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return 3
+	case token.AND:
+		return 4
+	case token.ADD, token.SUB:
+		return 5
+	case token.MUL, token.QUO, token.REM:
+		return 6
+	case token.XOR:
+		return 8
+	default:
+		return 0
+	}
+}
+
+func isRightAssociative(tok token.Token) bool {
+	return tok == token.XOR
+}
+
 type CallerExpr struct {
 	Name string
 	Args []Expr
 	pos  token.Pos
+	// def is the function resolved by the parser, calls built otherwise are
+	// resolved from DefaultRegistry.
+	def *FunctionDef
 }
 
 func (expr *CallerExpr) Calculate(ctx context.Context) (interface{}, error) {
-	fn := fns[expr.Name]
-	if fn == nil {
-		return nil, errors.New("函数不存在")
+	def, err := expr.function()
+	if err != nil {
+		return nil, err
+	}
+	if err := step(ctx, expr); err != nil {
+		return nil, err
+	}
+	fn := def.Function
+	if lazy, ok := fn.(LazyFunction); ok {
+		result, err := lazy.CalculateLazy(ctx, expr.Args)
+		return result, expr.locate(err)
 	}
 
 	args := make([]interface{}, len(expr.Args), len(expr.Args))
@@ -164,7 +574,58 @@ func (expr *CallerExpr) Calculate(ctx context.Context) (interface{}, error) {
 			args[i] = result
 		}
 	}
-	return fn.Calculate(args)
+	var result interface{}
+	if ctxFn, ok := fn.(ContextFunction); ok {
+		result, err = ctxFn.CalculateContext(ctx, args)
+	} else {
+		result, err = fn.Calculate(args)
+	}
+	if err != nil {
+		return nil, expr.locate(err)
+	}
+	if _, ok := decimalOptions(ctx); ok {
+		// functions computing numbers from text, e.g. LEN, return float64
+		return toDecimalValue(result), nil
+	}
+	return result, nil
+}
+
+// function returns the function called. Calls built without the parser are
+// resolved from DefaultRegistry and checked like the parser checks them, so
+// that functions never get arguments their signature rejects.
+func (expr *CallerExpr) function() (*FunctionDef, error) {
+	if expr.def != nil {
+		return expr.def, nil
+	}
+	def, ok := DefaultRegistry.Lookup(expr.Name)
+	if !ok {
+		return nil, fmt.Errorf("function:%s is not existed", expr.Name)
+	}
+	err := def.Signature.check(expr.Args)
+	if err == nil {
+		err = def.Function.Valid(expr.Args)
+	}
+	return def, expr.locate(err)
+}
+
+// locate completes an ArgumentError raised by the function with its name and
+// the source position of the argument, and a LimitError of the call depth
+// with the position of the call.
+func (expr *CallerExpr) locate(err error) error {
+	var argErr *ArgumentError
+	if errors.As(err, &argErr) && argErr.Fn == "" {
+		argErr.Fn = expr.Name
+		if argErr.Index >= 0 && argErr.Index < len(expr.Args) {
+			argErr.Pos = expr.Args[argErr.Index].Pos()
+			argErr.End = expr.Args[argErr.Index].End()
+		}
+	}
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) && limitErr.Limit == LimitCallDepth {
+		// the calls around set it in turn, up to the outermost one
+		limitErr.Pos = expr.Pos()
+	}
+	return err
 }
 
 func (expr *CallerExpr) Pos() token.Pos {
@@ -196,27 +657,41 @@ type GroupExpr struct {
 	Expr
 }
 
-func (expr GroupExpr) MarshalJSON() ([]byte, error) {
-	return json.Marshal(expr.Expr)
+func (expr *GroupExpr) String() string {
+	return fmt.Sprintf("%s", expr.Expr)
 }
 
 type ExprGroup struct {
 	expr Expr
 	cur  *BinaryExpr
+	// unary operators waiting for their operand, outermost first
+	unary []*UnaryExpr
 }
 
 func (grp *ExprGroup) Valid() error {
 	if grp.expr == nil {
 		return errors.New("formular is not completed 1")
 	}
-	if b, ok := grp.expr.(*BinaryExpr); ok {
-		if b.X == nil || b.Y == nil {
-			return errors.New("formular is not completed 2")
-		}
+	if len(grp.unary) > 0 || grp.cur != nil && grp.cur.Y == nil {
+		return errors.New("formular is not completed 2")
 	}
 	return nil
 }
 
+// expectOperand reports whether the next token has to start an operand.
+func (grp *ExprGroup) expectOperand() bool {
+	return grp.expr == nil || grp.cur != nil && grp.cur.Y == nil
+}
+
+// AddUnary adds a prefix operator, it applies to the next operand.
+func (grp *ExprGroup) AddUnary(pos token.Pos, tok token.Token) error {
+	if !grp.expectOperand() {
+		return errors.New("unary operator should be in front of express")
+	}
+	grp.unary = append(grp.unary, &UnaryExpr{Position: pos, Op: tok})
+	return nil
+}
+
 func (grp *ExprGroup) Expr() Expr {
 	return &GroupExpr{
 		Expr: grp.expr,
@@ -235,6 +710,11 @@ func (grp *ExprGroup) AddOperator(token token.Token) error {
 }
 
 func (grp *ExprGroup) AddExpr(expr Expr) error {
+	for i := len(grp.unary) - 1; i >= 0; i-- {
+		grp.unary[i].X = expr
+		expr = grp.unary[i]
+	}
+	grp.unary = grp.unary[:0]
 	if grp.expr == nil {
 		grp.expr = expr
 	} else {
@@ -249,11 +729,17 @@ func (grp *ExprGroup) AddExpr(expr Expr) error {
 	return nil
 }
 
-func (grp *ExprGroup) getExpr(expr Expr, token token.Token) *BinaryExpr {
-	if b, ok := expr.(*BinaryExpr); ok {
-		if token.Precedence() > b.Op.Precedence() {
-			b.Y = grp.getExpr(b.Y, token)
-			return b
+func (grp *ExprGroup) getExpr(expr Expr, token token.Token) Expr {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		if precedence(token) > precedence(e.Op) || precedence(token) == precedence(e.Op) && isRightAssociative(token) {
+			e.Y = grp.getExpr(e.Y, token)
+			return e
+		}
+	case *UnaryExpr:
+		if precedence(token) > unaryPrecedence {
+			e.X = grp.getExpr(e.X, token)
+			return e
 		}
 	}
 	result := &BinaryExpr{
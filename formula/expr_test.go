@@ -0,0 +1,118 @@
+package formula
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func calculate(expression string, vars map[string]interface{}) (interface{}, error) {
+	expr, err := ParseExpr(expression)
+	if err != nil {
+		return nil, err
+	}
+	return Evaluate(context.Background(), expr, MapEnv(vars))
+}
+
+func TestLogical(t *testing.T) {
+	vars := map[string]interface{}{"score": 75, "base": 100.0}
+	cases := []struct {
+		expr   string
+		result interface{}
+	}{
+		{"{score} >= 60", true},
+		{"{score} < 60 || {base} == 100", true},
+		{"1 + 2 * 3 > 6 && 2 != 2", false},
+		{"!({score} > 60)", false},
+		{"!!1", true},
+		{"IF({score} >= 60, {base} * 2, {base})", 200.0},
+		{"IF({score} >= 80, 1, 2) + 1", 3.0},
+		{"IFS({score} > 80, 1, {score} > 70, 2)", 2.0},
+		{"SWITCH({score}, 60, 1, 75, 2, 3)", 2.0},
+		{"SWITCH({score}, 60, 1, 3)", 3.0},
+	}
+	Convey("comparison and logical operators", t, func() {
+		for _, c := range cases {
+			result, err := calculate(c.expr, vars)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, c.result)
+		}
+	})
+
+	Convey("only the taken branch is calculated", t, func() {
+		result, err := calculate("IF({score} > 60, 1, 1/0)", vars)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 1.0)
+
+		result, err = calculate("{score} < 60 && 1/0 > 1", vars)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, false)
+
+		_, err = calculate("IF({score} < 60, 1, 1/0)", vars)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("precedence", t, func() {
+		expr, err := ParseExpr("1 + 2 > 2 && !(3 < 1) || 0")
+		So(err, ShouldBeNil)
+		So(expr.(*GroupExpr).String(), ShouldEqual, "((((1+2)>2)&&!(3<1))||0)")
+	})
+
+	Convey("invalid expressions", t, func() {
+		for _, expr := range []string{"1 >", "1 = 2", "1 | 2", "1 !", "IF(1)"} {
+			_, err := ParseExpr(expr)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestArithmetic(t *testing.T) {
+	vars := map[string]interface{}{"x": 4}
+	cases := []struct {
+		expr   string
+		result interface{}
+		str    string
+	}{
+		{"-{x}", -4.0, "-{x}"},
+		{"2 * -3", -6.0, "(2*-3)"},
+		{"+{x} - -1", 5.0, "(+{x}--1)"},
+		{"-2^2", -4.0, "-(2^2)"},
+		{"(-2)^2", 4.0, "((-2)^2)"},
+		{"2^3^2", 512.0, "(2^(3^2))"},
+		{"2^-1", 0.5, "(2^-1)"},
+		{"7 % 3 * 2", 2.0, "((7%3)*2)"},
+		{"1 + 7 % 4", 4.0, "(1+(7%4))"},
+		{"-{x} > -5 && !({x} % 2)", true, "((-{x}>-5)&&!({x}%2))"},
+	}
+	Convey("unary, modulo and power operators", t, func() {
+		for _, c := range cases {
+			expr, err := ParseExpr(c.expr)
+			So(err, ShouldBeNil)
+			So(fmt.Sprintf("%s", expr), ShouldEqual, c.str)
+			result, err := calculate(c.expr, vars)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, c.result)
+		}
+	})
+
+	Convey("json keeps unary operators", t, func() {
+		expr, err := ParseExpr("-2^2")
+		So(err, ShouldBeNil)
+		data, err := json.Marshal(expr)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"type":"group","expr":{"type":"unary","pos":0,"op":"neg","x":{"type":"binary","op":"pow",`+
+			`"x":{"type":"const","pos":1,"value":2,"src":"2"},"y":{"type":"const","pos":3,"value":2,"src":"2"}}}}`)
+	})
+
+	Convey("invalid operands", t, func() {
+		_, err := calculate("1 % 0", vars)
+		So(err, ShouldNotBeNil)
+		_, err = calculate("(-8)^0.5", vars)
+		So(err, ShouldNotBeNil)
+		_, err = ParseExpr("* 3")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -1,68 +1,138 @@
 package formula
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"reflect"
-	"strings"
+	"go/token"
 )
 
-type functions map[string]Function
+type Function interface {
+	Valid(args []Expr) error
+	Calculate(args []interface{}) (interface{}, error)
+}
 
-func (fs functions) register(fn Function) error {
-	fnName := strings.ToUpper(reflect.TypeOf(fn).Name())
-	if _, exist := fs[fnName]; exist {
-		return fmt.Errorf("duplicate function name:%s found", fnName)
-	}
-	fs[fnName] = fn
-	return nil
+// LazyFunction receives its arguments unevaluated, so it only calculates
+// the ones it needs (e.g. the taken branch of IF).
+type LazyFunction interface {
+	Function
+	CalculateLazy(ctx context.Context, args []Expr) (interface{}, error)
 }
 
-func (fs functions) hasFn(name string) bool {
-	return fs[name] != nil
+// ContextFunction receives the evaluation context along with its evaluated
+// arguments, e.g. to follow the decimal settings of the evaluation.
+type ContextFunction interface {
+	Function
+	CalculateContext(ctx context.Context, args []interface{}) (interface{}, error)
 }
 
-var fns functions = functions{}
+// ArgumentError reports an invalid argument of a function call, Index is 0
+// based. Functions only set Index and Err, the caller expression fills in
+// the function name and the source position of the argument.
+type ArgumentError struct {
+	Fn    string
+	Index int
+	Pos   token.Pos
+	End   token.Pos
+	Err   error
+}
 
-func Register(fn Function) error {
-	return fns.register(fn)
+func (err *ArgumentError) Error() string {
+	return fmt.Sprintf("%s argument %d: %v,pos:%v,end:%v", err.Fn, err.Index+1, err.Err, err.Pos, err.End)
 }
 
-type Function interface {
-	Valid(args []Expr) error
-	Calculate(args []interface{}) (interface{}, error)
+func (err *ArgumentError) Unwrap() error {
+	return err.Err
 }
 
+var ErrArgumentType = errors.New("参数类型错误")
+
+var errNoNumbers = errors.New("没有可计算的数值")
+
+func argError(index int, err error) error {
+	return &ArgumentError{Index: index, Err: err}
+}
+
+func argTypeError(index int, expected string, actual interface{}) error {
+	return argError(index, fmt.Errorf("%w: expect %s but got %s", ErrArgumentType, expected, typeName(actual)))
+}
+
+// processFloatArgs calls handler with every number in args. Array arguments,
+// e.g. the result of {items[*].price}, are flattened, and nulls are skipped
+// like Excel skips blank cells.
 func processFloatArgs(args []interface{}, handler func(float64) error) (int, error) {
+	return processNumberArgs(args, func(index int, arg interface{}) error {
+		f, err := convertToFloat(arg)
+		if err != nil {
+			return argTypeError(index, "number", arg)
+		}
+		return handler(f)
+	})
+}
+
+// processDecimalArgs is processFloatArgs for the decimal path, floats are
+// converted by their shortest representation.
+func processDecimalArgs(args []interface{}, handler func(Decimal) error) (int, error) {
+	return processNumberArgs(args, func(index int, arg interface{}) error {
+		d, err := convertToDecimal(arg)
+		if err != nil {
+			return argTypeError(index, "number", arg)
+		}
+		return handler(d)
+	})
+}
+
+func processNumberArgs(args []interface{}, handler func(index int, arg interface{}) error) (int, error) {
 	for i, arg := range args {
-		switch para := arg.(type) {
-		case int:
-			if err := handler(float64(para)); err != nil {
-				return i, err
-			}
-			break
-		case float64:
-			if err := handler(float64(para)); err != nil {
-				return i, err
-			}
-			break
-		default:
-			return i, errors.New("参数类型不是数字类型")
+		if err := processNumberArg(i, arg, handler); err != nil {
+			return i, err
 		}
 	}
 	return -1, nil
 }
 
+func processNumberArg(index int, arg interface{}, handler func(index int, arg interface{}) error) error {
+	switch para := arg.(type) {
+	case []interface{}:
+		for _, item := range para {
+			if err := processNumberArg(index, item, handler); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		return nil
+	}
+	return handler(index, arg)
+}
+
+// extremeDecimal returns the smallest (sign -1) or the largest (sign 1)
+// decimal of args.
+func extremeDecimal(args []interface{}, sign int) (interface{}, error) {
+	var result Decimal
+	hasSetResult := false
+	if _, err := processDecimalArgs(args, func(d Decimal) error {
+		if !hasSetResult || d.Cmp(result) == sign {
+			hasSetResult = true
+			result = d
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 type Min int
 
 func (m Min) Valid(args []Expr) error {
-	if len(args) < 2 {
-		return errors.New("函数的参数不能少于2个")
-	}
 	return nil
 }
 
 func (m Min) Calculate(args []interface{}) (interface{}, error) {
+	if hasDecimal(args) {
+		return extremeDecimal(args, -1)
+	}
 	var result float64 = 0
 	hasSetResult := false
 	if _, err := processFloatArgs(args, func(f float64) error {
@@ -84,13 +154,13 @@ func (m Min) Calculate(args []interface{}) (interface{}, error) {
 type Max int
 
 func (m Max) Valid(args []Expr) error {
-	if len(args) < 2 {
-		return errors.New("函数的参数不能少于2个")
-	}
 	return nil
 }
 
 func (m Max) Calculate(args []interface{}) (interface{}, error) {
+	if hasDecimal(args) {
+		return extremeDecimal(args, 1)
+	}
 	var result float64 = 0
 	hasSetResult := false
 	if _, err := processFloatArgs(args, func(f float64) error {
@@ -112,33 +182,63 @@ func (m Max) Calculate(args []interface{}) (interface{}, error) {
 type Avg int
 
 func (Avg) Valid(args []Expr) error {
-	if len(args) < 2 {
-		return errors.New("函数的参数不能少于2个")
-	}
 	return nil
 }
 
-func (Avg) Calculate(args []interface{}) (interface{}, error) {
+func (avg Avg) Calculate(args []interface{}) (interface{}, error) {
+	return avg.CalculateContext(context.Background(), args)
+}
+
+// CalculateContext divides with the scale and rounding of the evaluation in
+// decimal mode.
+func (Avg) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if opt, ok := decimalOptions(ctx); ok || hasDecimal(args) {
+		var result Decimal
+		count := 0
+		if _, err := processDecimalArgs(args, func(d Decimal) error {
+			result = result.Add(d)
+			count++
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, argError(0, errNoNumbers)
+		}
+		return result.Quo(NewDecimal(int64(count), 0), opt.Scale, opt.Rounding), nil
+	}
 	var result float64
+	count := 0
 	if _, err := processFloatArgs(args, func(f float64) error {
 		result += f
+		count++
 		return nil
 	}); err != nil {
 		return nil, err
 	}
-	return result / float64(len(args)), nil
+	if count == 0 {
+		return nil, argError(0, errNoNumbers)
+	}
+	return result / float64(count), nil
 }
 
 type Sum int
 
 func (Sum) Valid(args []Expr) error {
-	if len(args) < 2 {
-		return errors.New("函数的参数不能少于2个")
-	}
 	return nil
 }
 
 func (Sum) Calculate(args []interface{}) (interface{}, error) {
+	if hasDecimal(args) {
+		var result Decimal
+		if _, err := processDecimalArgs(args, func(d Decimal) error {
+			result = result.Add(d)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
 	var result float64
 	if _, err := processFloatArgs(args, func(f float64) error {
 		result += f
@@ -0,0 +1,309 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Now returns the current time of the evaluation clock.
+type Now int
+
+func (Now) Valid(args []Expr) error {
+	return nil
+}
+
+func (now Now) Calculate(args []interface{}) (interface{}, error) {
+	return now.CalculateContext(context.Background(), args)
+}
+
+func (Now) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return evalNow(ctx), nil
+}
+
+// Today returns the midnight of the current day in the evaluation time
+// zone.
+type Today int
+
+func (Today) Valid(args []Expr) error {
+	return nil
+}
+
+func (today Today) Calculate(args []interface{}) (interface{}, error) {
+	return today.CalculateContext(context.Background(), args)
+}
+
+func (Today) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return startOfDay(evalNow(ctx)), nil
+}
+
+// Date returns the date of a year, month and day. Months and days out of
+// range carry over like Excel, DATE(2024, 13, 1) is 2025-01-01.
+type Date int
+
+func (Date) Valid(args []Expr) error {
+	return nil
+}
+
+func (date Date) Calculate(args []interface{}) (interface{}, error) {
+	return date.CalculateContext(context.Background(), args)
+}
+
+func (Date) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	parts := make([]int, len(args))
+	for i := range args {
+		n, err := numberArg(args, i)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0 && !(n >= 1 && n < 10000):
+			return nil, argError(0, fmt.Errorf("year should be between 1 and 9999, got %v", n))
+		case i == 1 && !(math.Abs(n) <= 9999*12):
+			return nil, argError(1, fmt.Errorf("month should be between -%d and %d, got %v", 9999*12, 9999*12, n))
+		case i == 2 && !(math.Abs(n) <= maxDays):
+			return nil, argError(2, fmt.Errorf("day should be between -%d and %d, got %v", maxDays, maxDays, n))
+		}
+		parts[i] = int(n)
+	}
+	result := time.Date(parts[0], time.Month(parts[1]), parts[2], 0, 0, 0, 0, evalLocation(ctx))
+	if err := dateInRange(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DateDiff returns the number of complete units (year, month, week, day,
+// hour, minute or second) from the first date to the second one, negative
+// when the second date is earlier.
+type DateDiff int
+
+func (DateDiff) Valid(args []Expr) error {
+	return nil
+}
+
+func (diff DateDiff) Calculate(args []interface{}) (interface{}, error) {
+	return diff.CalculateContext(context.Background(), args)
+}
+
+func (DateDiff) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	loc := evalLocation(ctx)
+	a, err := dateArg(args, 0, loc)
+	if err != nil {
+		return nil, err
+	}
+	b, err := dateArg(args, 1, loc)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := unitArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return dateDiff(a, b, unit), nil
+}
+
+// DateAdd adds a number of units to a date. Adding months keeps the day
+// within the month, a month after January 31 is the end of February.
+type DateAdd int
+
+func (DateAdd) Valid(args []Expr) error {
+	return nil
+}
+
+func (add DateAdd) Calculate(args []interface{}) (interface{}, error) {
+	return add.CalculateContext(context.Background(), args)
+}
+
+func (DateAdd) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	t, err := dateArg(args, 0, evalLocation(ctx))
+	if err != nil {
+		return nil, err
+	}
+	n, err := numberArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := unitArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	result, err := dateAdd(t, n, unit)
+	if err != nil {
+		return nil, argError(1, err)
+	}
+	return result, nil
+}
+
+// datePart returns a number of the date argument in the evaluation time
+// zone.
+func datePart(ctx context.Context, args []interface{}, part func(t time.Time) int) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	t, err := dateArg(args, 0, evalLocation(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return float64(part(t)), nil
+}
+
+type Year int
+
+func (Year) Valid(args []Expr) error {
+	return nil
+}
+
+func (year Year) Calculate(args []interface{}) (interface{}, error) {
+	return year.CalculateContext(context.Background(), args)
+}
+
+func (Year) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return datePart(ctx, args, time.Time.Year)
+}
+
+// Month returns the month of a date, 1 to 12.
+type Month int
+
+func (Month) Valid(args []Expr) error {
+	return nil
+}
+
+func (month Month) Calculate(args []interface{}) (interface{}, error) {
+	return month.CalculateContext(context.Background(), args)
+}
+
+func (Month) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return datePart(ctx, args, func(t time.Time) int { return int(t.Month()) })
+}
+
+// Day returns the day of the month of a date.
+type Day int
+
+func (Day) Valid(args []Expr) error {
+	return nil
+}
+
+func (day Day) Calculate(args []interface{}) (interface{}, error) {
+	return day.CalculateContext(context.Background(), args)
+}
+
+func (Day) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return datePart(ctx, args, time.Time.Day)
+}
+
+// Weekday returns the day of the week of a date, numbered like Excel by the
+// optional return type: 1 (default) counts Sunday 1 to Saturday 7, 2 counts
+// Monday 1 to Sunday 7, and 3 counts Monday 0 to Sunday 6.
+type Weekday int
+
+func (Weekday) Valid(args []Expr) error {
+	return nil
+}
+
+func (weekday Weekday) Calculate(args []interface{}) (interface{}, error) {
+	return weekday.CalculateContext(context.Background(), args)
+}
+
+func (Weekday) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	returnType := 1.0
+	if len(args) > 1 && args[1] != nil {
+		var err error
+		if returnType, err = numberArg(args, 1); err != nil {
+			return nil, err
+		}
+	}
+	var number func(t time.Time) int
+	switch returnType {
+	case 1:
+		number = func(t time.Time) int { return int(t.Weekday()) + 1 }
+	case 2:
+		number = func(t time.Time) int { return (int(t.Weekday())+6)%7 + 1 }
+	case 3:
+		number = func(t time.Time) int { return (int(t.Weekday()) + 6) % 7 }
+	default:
+		return nil, argError(1, fmt.Errorf("return type should be 1, 2 or 3, got %v", returnType))
+	}
+	return datePart(ctx, args[:1], number)
+}
+
+// Workday returns the date a number of working days before or after a
+// date, skipping weekends and the optional holidays, a date or an array of
+// dates.
+type Workday int
+
+func (Workday) Valid(args []Expr) error {
+	return nil
+}
+
+func (workday Workday) Calculate(args []interface{}) (interface{}, error) {
+	return workday.CalculateContext(context.Background(), args)
+}
+
+func (Workday) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	loc := evalLocation(ctx)
+	start, err := dateArg(args, 0, loc)
+	if err != nil {
+		return nil, err
+	}
+	days, err := numberArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(days) || math.Abs(days) > maxDays {
+		return nil, argError(1, fmt.Errorf("days should be between -%d and %d, got %v", maxDays, maxDays, days))
+	}
+	holidays := make(map[time.Time]bool)
+	if len(args) > 2 {
+		for _, item := range itemsArg(args[2]) {
+			if item == nil {
+				continue
+			}
+			holiday, err := dateArg([]interface{}{item}, 0, loc)
+			if err != nil {
+				return nil, argError(2, errors.Unwrap(err))
+			}
+			holidays[startOfDay(holiday)] = true
+		}
+	}
+	step := 1
+	if days < 0 {
+		step = -1
+	}
+	// any 7 days in a row have 5 working days, skip whole weeks and walk the
+	// rest along with the holidays skipped
+	from := startOfDay(start)
+	n := int(days) * step
+	weeks := max(n-1, 0) / 5
+	result := from.AddDate(0, 0, 7*weeks*step)
+	n -= 5 * weeks
+	for holiday := range holidays {
+		if !isWeekend(holiday) && holiday.Compare(from) == step && holiday.Compare(result) != step {
+			n++
+		}
+	}
+	for n > 0 {
+		result = result.AddDate(0, 0, step)
+		if !isWeekend(result) && !holidays[result] {
+			n--
+		}
+	}
+	if err := dateInRange(result); err != nil {
+		return nil, argError(1, err)
+	}
+	return result, nil
+}
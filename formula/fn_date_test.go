@@ -0,0 +1,157 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDate(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	clock := func() time.Time { return time.Date(2024, 3, 10, 1, 30, 0, 0, time.UTC) }
+	vars := MapEnv{
+		"stamp":    time.Date(2024, 3, 10, 3, 0, 0, 0, time.UTC),
+		"holidays": []interface{}{"2024-03-11", nil, time.Date(2024, 3, 13, 0, 0, 0, 0, newYork)},
+		"none":     nil,
+	}
+	evaluate := func(expression string, opts ...EvalOption) (interface{}, error) {
+		expr, err := ParseExpr(expression)
+		if err != nil {
+			return nil, err
+		}
+		opts = append([]EvalOption{WithClock(clock), WithLocation(newYork)}, opts...)
+		return Evaluate(context.Background(), expr, vars, opts...)
+	}
+
+	Convey("dates", t, func() {
+		for expression, want := range map[string]string{
+			"NOW()":                                     "2024-03-09 20:30:00",
+			"TODAY()":                                   "2024-03-09",
+			"TODAY() + 1":                               "2024-03-10",
+			"1 + TODAY()":                               "2024-03-10",
+			"TODAY() - 0.5":                             "2024-03-08 12:00:00",
+			"DATE(2024, 13, 1)":                         "2025-01-01",
+			"DATE(2024, 3, 0)":                          "2024-02-29",
+			`DATEADD("2024-01-31", 1, "month")`:         "2024-02-29",
+			`DATEADD("2024-02-29", 1, "year")`:          "2025-02-28",
+			`DATEADD("2024-02-29", -2, "weeks")`:        "2024-02-15",
+			`DATEADD("2024-03-09 12:00", 1, "day")`:     "2024-03-10 12:00:00",
+			`DATEADD("2024-03-09 12:00", 24, "hour")`:   "2024-03-10 13:00:00",
+			`DATEADD("2024-03-09 12:00", 90, "mi")`:     "2024-03-09 13:30:00",
+			`WORKDAY("2024-03-08", 1)`:                  "2024-03-11",
+			`WORKDAY("2024-03-08 15:00", 1)`:            "2024-03-11",
+			`WORKDAY("2024-03-08", 3, {holidays})`:      "2024-03-15",
+			`WORKDAY("2024-03-12", -1, {holidays})`:     "2024-03-08",
+			`WORKDAY("2024-03-09", 0)`:                  "2024-03-09",
+			`WORKDAY("2024-03-08", 1, "2024-03-11")`:    "2024-03-12",
+			`WORKDAY("2024-03-08", 10)`:                 "2024-03-22",
+			`WORKDAY("2024-03-09", 5)`:                  "2024-03-15",
+			`WORKDAY("2024-03-08", -10)`:                "2024-02-23",
+			`WORKDAY("2024-03-08", 10, {holidays})`:     "2024-03-26",
+			`WORKDAY("2024-03-22", -10, {holidays})`:    "2024-03-06",
+			`WORKDAY("2024-01-01", 2609)`:               "2033-12-30",
+			`"due " & DATE(2024, 1, 2)`:                 "due 2024-01-02",
+			`DATEADD("2024-03-10T07:00:00Z", 0, "day")`: "2024-03-10 03:00:00",
+		} {
+			result, err := evaluate(expression)
+			So(err, ShouldBeNil)
+			So(convertToText(result), ShouldEqual, want)
+		}
+	})
+
+	Convey("numbers of dates", t, func() {
+		for expression, want := range map[string]interface{}{
+			`DATEDIFF("2024-01-15", "2024-03-14", "month")`:     1.0,
+			`DATEDIFF("2020-02-29", "2024-02-28", "year")`:      3.0,
+			`DATEDIFF("2024-03-01", "2024-01-01", "d")`:         -60.0,
+			`DATEDIFF("2024-01-01", "2024-01-15", "week")`:      2.0,
+			`DATEDIFF("2024-03-10", "2024-03-11", "hour")`:      23.0,
+			`DATEDIFF("2024-03-09 23:00", "2024-03-10", "day")`: 0.0,
+			"DATE(2024, 3, 11) - DATE(2024, 3, 9)":              2.0,
+			"YEAR(TODAY())":                                     2024.0,
+			`MONTH("2024-03-09")`:                               3.0,
+			`DAY("2024-03-09")`:                                 9.0,
+			"DAY({stamp})":                                      9.0,
+			`WEEKDAY("2024-03-10")`:                             1.0,
+			`WEEKDAY("2024-03-10", 2)`:                          7.0,
+			`WEEKDAY("2024-03-10", 3)`:                          6.0,
+			`WEEKDAY("2024-03-11", 2)`:                          1.0,
+			`WEEKDAY("2024-03-11", 3)`:                          0.0,
+		} {
+			result, err := evaluate(expression)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, want)
+		}
+	})
+
+	Convey("time zones", t, func() {
+		result, err := evaluate("DAY({stamp})", WithLocation(time.UTC))
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 10.0)
+		result, err = evaluate("TODAY()", WithLocation(time.UTC))
+		So(err, ShouldBeNil)
+		So(convertToText(result), ShouldEqual, "2024-03-10")
+		result, err = evaluate("{stamp} < TODAY() + 1")
+		So(err, ShouldBeNil)
+		So(result, ShouldBeTrue)
+		result, err = evaluate("DATE(2024, 1, 1) == DATE(2024, 1, 1)")
+		So(err, ShouldBeNil)
+		So(result, ShouldBeTrue)
+	})
+
+	Convey("nulls", t, func() {
+		for _, expression := range []string{"YEAR({none})", "DATEADD({none}, 1, \"day\")", "WORKDAY({none}, 1)", "DATE(2024, {none}, 1)"} {
+			result, err := evaluate(expression)
+			So(err, ShouldBeNil)
+			So(result, ShouldBeNil)
+		}
+	})
+
+	Convey("errors", t, func() {
+		for expression, msg := range map[string]string{
+			"DATE(0, 1, 1)":                                  "year should be between 1 and 9999",
+			`DATEADD("2024-01-01", 1.5, "month")`:            "is not a whole number",
+			`DATEDIFF("2024-01-01", TODAY(), "q")`:           "unknown date unit",
+			`YEAR("tomorrow")`:                               `invalid date "tomorrow"`,
+			`WEEKDAY(TODAY(), 4)`:                            "return type should be 1, 2 or 3",
+			`WORKDAY(TODAY(), 1, "soon")`:                    `invalid date "soon"`,
+			`WORKDAY(DATE(2024,1,1), 1000000000000)`:         "days should be between",
+			`WORKDAY(DATE(9999,1,1), 1000)`:                  "date should be between years 1 and 9999",
+			`TODAY() + ((10^300*10^300)-(10^300*10^300))`:    "days should be between",
+			`TODAY() + 10^300*10^300`:                        "days should be between",
+			`TODAY() - 1000000000`:                           "days should be between",
+			`TODAY() + 3000000`:                              "date should be between years 1 and 9999",
+			`DATEADD(TODAY(), 1000000000, "hour")`:           "hours should be between",
+			`DATEADD(TODAY(), 100000000, "year")`:            "years should be between",
+			`DATEADD(TODAY(), 8000, "year")`:                 "date should be between years 1 and 9999",
+			`DATEADD(TODAY(), -24*366*2030, "hour")`:         "date should be between years 1 and 9999",
+			`DATE(2024, (10^300*10^300)-(10^300*10^300), 1)`: "month should be between",
+			`DATE(2024, 100000000000, 1)`:                    "month should be between",
+			`DATE(2024, 1, 10^12)`:                           "day should be between",
+			`DATE(9999, 13, 1)`:                              "date should be between years 1 and 9999",
+			`TODAY() < 1`:                                    "cannot compare date with non date value",
+			`TODAY() * 2`:                                    "operator * is not supported for dates",
+		} {
+			_, err := evaluate(expression)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, msg)
+		}
+		_, err := evaluate(`TODAY() + "soon"`)
+		So(errors.Is(err, ErrArgumentType), ShouldBeTrue)
+	})
+
+	Convey("compiled", t, func() {
+		expr, _ := ParseExpr(`DATEDIFF(TODAY(), DATE(2024, 12, 25), "day")`)
+		program, err := Compile(expr)
+		So(err, ShouldBeNil)
+		result, err := program.EvalFloat(context.Background(), vars, WithClock(clock), WithLocation(newYork))
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 291)
+	})
+}
@@ -0,0 +1,73 @@
+package formula
+
+// builtinDocs are the docs of the built-in functions shown by editors.
+var builtinDocs = map[string]string{
+	"MIN":        "Returns the smallest of the numbers, arrays are flattened and nulls skipped.",
+	"MAX":        "Returns the largest of the numbers, arrays are flattened and nulls skipped.",
+	"AVG":        "Returns the average of the numbers, arrays are flattened and nulls skipped.",
+	"SUM":        "Returns the sum of the numbers, arrays are flattened and nulls skipped.",
+	"IF":         "Returns the second argument when the condition is true, otherwise the third one or null.",
+	"IFS":        "Takes condition/value pairs and returns the value of the first true condition.",
+	"SWITCH":     "Compares the value with case/value pairs and returns the value of the first equal case, or the trailing default.",
+	"LET":        "Binds names written like {x} to values, each visible to the values after it and to the body, the last argument.",
+	"CONCAT":     "Joins the text of the arguments.",
+	"LEN":        "Returns the number of characters of the text.",
+	"UPPER":      "Converts the text to upper case.",
+	"LOWER":      "Converts the text to lower case.",
+	"TRIM":       "Removes the leading and trailing spaces of the text and collapses the spaces between words.",
+	"LEFT":       "Returns the first characters of the text, one by default.",
+	"RIGHT":      "Returns the last characters of the text, one by default.",
+	"MID":        "Returns the characters of the text from a 1 based start, up to the count.",
+	"SUBSTITUTE": "Replaces the old text with the new one, every occurrence or only the given instance.",
+	"TEXT":       "Formats the number with a pattern such as \"#,##0.00\" or \"0.0%\".",
+	"VALUE":      "Converts text such as \"1,234.5\" or \"50%\" to a number.",
+	"COUNT":      "Returns how many numbers the arguments hold.",
+	"MEDIAN":     "Returns the middle of the sorted numbers.",
+	"MODE":       "Returns the number occurring most often, the first one among ties.",
+	"VAR":        "Returns the variance of a sample of the numbers.",
+	"VARP":       "Returns the variance of the whole population of the numbers.",
+	"STDEV":      "Returns the standard deviation of a sample of the numbers.",
+	"STDEVP":     "Returns the standard deviation of the whole population of the numbers.",
+	"PERCENTILE": "Returns the k-th percentile of the numbers, k between 0 and 1, interpolating between them.",
+	"LARGE":      "Returns the k-th largest of the numbers.",
+	"SMALL":      "Returns the k-th smallest of the numbers.",
+	"SUMPRODUCT": "Multiplies the items of arrays of the same length and returns the sum of the products.",
+	"COUNTIF":    "Counts the items matching the criteria, such as 4, \">=5\", \"a*\" or \"<>\".",
+	"SUMIF":      "Sums the items matching the criteria, or the items at the same index of the sum array.",
+	"ABS":        "Returns the absolute value of the number.",
+	"ROUND":      "Rounds the number half away from zero to the digits.",
+	"ROUNDUP":    "Rounds the number away from zero to the digits.",
+	"ROUNDDOWN":  "Rounds the number toward zero to the digits.",
+	"TRUNC":      "Truncates the number toward zero to the digits, 0 by default.",
+	"FLOOR":      "Rounds the number down to a multiple of the significance, 1 by default.",
+	"CEIL":       "Rounds the number up to a multiple of the significance, 1 by default.",
+	"CEILING":    "Rounds the number up to a multiple of the significance, 1 by default.",
+	"MOD":        "Returns the remainder of the division, with the sign of the divisor.",
+	"SIGN":       "Returns 1 for positive numbers, -1 for negative ones and 0 for zero.",
+	"POW":        "Raises the number to the power.",
+	"POWER":      "Raises the number to the power.",
+	"SQRT":       "Returns the square root of the number.",
+	"EXP":        "Returns e raised to the number.",
+	"LN":         "Returns the natural logarithm of the number.",
+	"LOG10":      "Returns the base 10 logarithm of the number.",
+	"PI":         "Returns the number π.",
+	"SIN":        "Returns the sine of the angle in radians.",
+	"COS":        "Returns the cosine of the angle in radians.",
+	"TAN":        "Returns the tangent of the angle in radians.",
+	"ASIN":       "Returns the arcsine of the number in radians.",
+	"ACOS":       "Returns the arccosine of the number in radians.",
+	"ATAN":       "Returns the arctangent of the number in radians.",
+	"ATAN2":      "Returns the angle in radians of the point (x, y).",
+	"DEGREES":    "Converts radians to degrees.",
+	"RADIANS":    "Converts degrees to radians.",
+	"NOW":        "Returns the current time.",
+	"TODAY":      "Returns the current date at midnight.",
+	"DATE":       "Returns the date of a year, month and day, months and days out of range carry over.",
+	"DATEDIFF":   "Returns the number of complete units from the first date to the second: year, month, week, day, hour, minute or second.",
+	"DATEADD":    "Adds a number of units to the date: year, month, week, day, hour, minute or second.",
+	"YEAR":       "Returns the year of the date.",
+	"MONTH":      "Returns the month of the date, 1 to 12.",
+	"DAY":        "Returns the day of the month of the date.",
+	"WEEKDAY":    "Returns the day of the week of the date, Sunday 1 to Saturday 7 by default, return type 2 counts Monday 1 to Sunday 7 and 3 Monday 0 to Sunday 6.",
+	"WORKDAY":    "Returns the date a number of working days after the date, before it when negative, skipping weekends and the holidays.",
+}
@@ -0,0 +1,237 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Let binds names to values for its body, LET({x}, 2, {y}, {x} + 1, {x} * {y})
+// is 6. A name is written like a variable, it hides the variable of the same
+// name within the values following it and the body.
+type Let int
+
+func (Let) Valid(args []Expr) error {
+	if len(args)%2 == 0 {
+		return errors.New("LET requires name and value pairs followed by the body")
+	}
+	for i := 0; i < len(args)-1; i += 2 {
+		if _, err := bindingName(args[i]); err != nil {
+			return argError(i, err)
+		}
+	}
+	return nil
+}
+
+func (Let) Calculate(args []interface{}) (interface{}, error) {
+	return nil, errors.New("LET binds names of unevaluated arguments")
+}
+
+func (Let) CalculateLazy(ctx context.Context, args []Expr) (interface{}, error) {
+	outer := scopeFrom(ctx)
+	s := &scope{vars: make(map[string]interface{}, len(args)/2), parent: outer, depth: outer.callDepth()}
+	ctx = context.WithValue(ctx, scopeKey{}, s)
+	for i := 0; i < len(args)-1; i += 2 {
+		name, err := bindingName(args[i])
+		if err != nil {
+			return nil, argError(i, err)
+		}
+		value, err := args[i+1].Calculate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.vars[name] = value
+	}
+	return args[len(args)-1].Calculate(ctx)
+}
+
+// isLet reports whether expr calls LET.
+func isLet(expr *CallerExpr) bool {
+	def := expr.def
+	if def == nil {
+		def, _ = DefaultRegistry.Lookup(expr.Name)
+	}
+	if def == nil {
+		return false
+	}
+	_, ok := def.Function.(Let)
+	return ok
+}
+
+// lambda is LAMBDA, it only parses the definitions of Registry.Define.
+type lambda int
+
+func (lambda) Valid(args []Expr) error {
+	seen := make(map[string]bool, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		name, err := bindingName(arg)
+		if err != nil {
+			return argError(i, err)
+		}
+		if seen[name] {
+			return argError(i, fmt.Errorf("duplicate parameter {%s}", name))
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func (lambda) Calculate(args []interface{}) (interface{}, error) {
+	return nil, errors.New("LAMBDA defines functions with Registry.Define")
+}
+
+var lambdaSignature = Signature{Params: []Type{TypeAny}, Variadic: true, Result: TypeAny}
+
+// bindingName returns the name bound by a LET or a parameter of LAMBDA.
+func bindingName(expr Expr) (string, error) {
+	ref, ok := unwrapGroup(expr).(*RefExpr)
+	if !ok {
+		return "", fmt.Errorf("expect a name like {x} but got %s", expr)
+	}
+	if _, path := splitRef(ref.Name); path != "" {
+		return "", fmt.Errorf("name {%s} should not have a path", ref.Name)
+	}
+	return ref.Name, nil
+}
+
+// UserFunction is a function defined by a LAMBDA formula, see
+// Registry.Define.
+type UserFunction struct {
+	Name   string
+	Params []string
+	Body   Expr
+	// Source is the LAMBDA formula defining the function.
+	Source string
+}
+
+func (fn *UserFunction) Valid(args []Expr) error {
+	return nil
+}
+
+func (fn *UserFunction) Calculate(args []interface{}) (interface{}, error) {
+	return fn.CalculateContext(context.Background(), args)
+}
+
+// CalculateContext calculates the body with the parameters bound to args,
+// in a scope of its own: the names bound by the caller are not visible.
+func (fn *UserFunction) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if len(args) != len(fn.Params) {
+		return nil, fmt.Errorf("%s requires %d arguments, got %d", fn.Name, len(fn.Params), len(args))
+	}
+	max := DefaultMaxCallDepth
+	if ev := evaluationFrom(ctx); ev != nil && ev.opt.MaxCallDepth > 0 {
+		max = ev.opt.MaxCallDepth
+	}
+	depth := scopeFrom(ctx).callDepth() + 1
+	if depth > max {
+		return nil, &LimitError{Limit: LimitCallDepth, Max: max}
+	}
+	s := &scope{vars: make(map[string]interface{}, len(args)), depth: depth}
+	for i, name := range fn.Params {
+		s.vars[name] = args[i]
+	}
+	return fn.Body.Calculate(context.WithValue(ctx, scopeKey{}, s))
+}
+
+// Define registers the function name defined by a LAMBDA formula, whose
+// last argument is the body and the others the parameters, e.g.
+//
+//	registry.Define("NET", "LAMBDA({price}, {rate}, {price} * (1 - {rate}))")
+//
+// so that formulas parsed with the registry may call NET({price}, 0.2).
+// Calls are checked against the number of parameters. Scoping is lexical:
+// the body sees its parameters and the variables of the evaluation, but not
+// the names bound by the LET around a call. The body may call the function
+// itself, recursion fails with a *LimitError beyond the MaxCallDepth of the
+// evaluation. The function is a *UserFunction keeping the source, to store
+// it along with the formulas calling it.
+func (r *Registry) Define(name, source string, opts ...ParseOption) error {
+	if !isFunctionName(name) {
+		return fmt.Errorf("invalid function name:%s", name)
+	}
+	if _, exist := r.Lookup(name); exist {
+		return fmt.Errorf("duplicate function name:%s found", strings.ToUpper(name))
+	}
+	fn := &UserFunction{Name: strings.ToUpper(name), Source: source}
+	if err := r.parseLambda(fn, AnySignature, opts); err != nil {
+		return err
+	}
+	// parse again to check the recursive calls against the parameters
+	sig := Signature{Params: make([]Type, len(fn.Params)), Result: TypeAny}
+	for i := range sig.Params {
+		sig.Params[i] = TypeAny
+	}
+	if err := r.parseLambda(fn, sig, opts); err != nil {
+		return err
+	}
+	return r.Register(name, fn, sig)
+}
+
+// parseLambda parses the definition of fn, with fn registered under sig so
+// that its body may call it.
+func (r *Registry) parseLambda(fn *UserFunction, sig Signature, opts []ParseOption) error {
+	defs := r.Clone()
+	defs.Unregister("LAMBDA")
+	if err := defs.Register("LAMBDA", lambda(1), lambdaSignature); err != nil {
+		return err
+	}
+	if err := defs.Register(fn.Name, fn, sig); err != nil {
+		return err
+	}
+	expr, err := ParseExpr(fn.Source, append(opts[:len(opts):len(opts)], WithRegistry(defs))...)
+	if err != nil {
+		return err
+	}
+	call, ok := unwrapGroup(expr).(*CallerExpr)
+	if !ok || call.Name != "LAMBDA" {
+		return fmt.Errorf("definition of %s should be a LAMBDA", fn.Name)
+	}
+	params := call.Args[:len(call.Args)-1]
+	fn.Params = make([]string, len(params))
+	for i, param := range params {
+		fn.Params[i], _ = bindingName(param)
+	}
+	fn.Body = call.Args[len(call.Args)-1]
+	return nil
+}
+
+type scopeKey struct{}
+
+// scope holds the names bound by LET and by the parameters of a user
+// function, parent is the scope around a LET. depth is the number of user
+// function calls the scope is in.
+type scope struct {
+	vars   map[string]interface{}
+	parent *scope
+	depth  int
+}
+
+func scopeFrom(ctx context.Context) *scope {
+	s, _ := ctx.Value(scopeKey{}).(*scope)
+	return s
+}
+
+func (s *scope) callDepth() int {
+	if s == nil {
+		return 0
+	}
+	return s.depth
+}
+
+// lookup resolves a reference whose root variable is bound in s or its
+// parents, selecting nested values like variables of the environment.
+func (s *scope) lookup(name string) (interface{}, bool) {
+	root, path := splitRef(name)
+	for ; s != nil; s = s.parent {
+		value, ok := s.vars[root]
+		if !ok {
+			continue
+		}
+		if path == "" {
+			return value, true
+		}
+		return lookup(MapEnv{root: value}, name)
+	}
+	return nil, false
+}
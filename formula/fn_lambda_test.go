@@ -0,0 +1,119 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLambda(t *testing.T) {
+	Convey("LET binds names", t, func() {
+		env := MapEnv{"x": 10.0, "order": map[string]interface{}{"items": []interface{}{map[string]interface{}{"price": 3.5}}}}
+		for expression, want := range map[string]interface{}{
+			"LET({x}, 2, {y}, {x} + 1, {x} * {y})":          6.0,
+			"LET({x}, 1, {x}) + {x}":                        11.0,
+			"LET({x}, {x} + 1, {x})":                        11.0,
+			"LET({x}, 1, {x}, {x} + 1, {x})":                2.0,
+			"LET({a}, 1, LET({b}, {a} + 1, {a} + {b}))":     3.0,
+			"LET({o}, {order}, {o.items[0].price} * 2)":     7.0,
+			`LET({s}, "a", {s} & LET({s}, "b", {s}) & {s})`: "aba",
+		} {
+			expr, err := ParseExpr(expression)
+			So(err, ShouldBeNil)
+			result, err := Evaluate(context.Background(), expr, env)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, want)
+
+			program, err := Compile(expr)
+			So(err, ShouldBeNil)
+			result, err = program.Eval(context.Background(), env)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, want)
+		}
+
+		expr, err := ParseExpr("LET({x}, 0.1, {x} + 0.2)")
+		So(err, ShouldBeNil)
+		result, err := Evaluate(context.Background(), expr, nil, WithDecimal(4, RoundHalfUp))
+		So(err, ShouldBeNil)
+		So(result.(Decimal).String(), ShouldEqual, "0.3")
+
+		for _, expression := range []string{"LET({x}, 1)", "LET(1, 2, 3)", "LET({a.b}, 2, 3)"} {
+			_, err := ParseExpr(expression)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("LET in checks", t, func() {
+		_, typ, err := Check("LET({x}, 1, {x} * {price})", VarTypes{"price": TypeNumber})
+		So(err, ShouldBeNil)
+		So(typ, ShouldEqual, TypeNumber)
+		_, _, err = Check(`LET({s}, "a", {s} * 2)`, nil)
+		So(err, ShouldNotBeNil)
+		So(err.(*ParserError).Diagnostics[0].Code, ShouldEqual, CodeOperandType)
+	})
+
+	Convey("functions defined by LAMBDA", t, func() {
+		registry := DefaultRegistry.Clone()
+		So(registry.Define("NET", "LAMBDA({price}, {rate}, {price} * (1 - {rate}))"), ShouldBeNil)
+		So(registry.Define("fact", "LAMBDA({n}, IF({n} <= 1, 1, {n} * FACT({n} - 1)))"), ShouldBeNil)
+		So(registry.Define("ADDX", "LAMBDA({n}, {n} + {x})"), ShouldBeNil)
+		So(registry.Define("LOOP", "LAMBDA({n}, LOOP({n} + 1))"), ShouldBeNil)
+		So(registry.Define("ANSWER", "LAMBDA(42)"), ShouldBeNil)
+
+		evaluate := func(expression string, env Env, opts ...EvalOption) (interface{}, error) {
+			expr, err := ParseExpr(expression, WithRegistry(registry))
+			So(err, ShouldBeNil)
+			return Evaluate(context.Background(), expr, env, opts...)
+		}
+		result, err := evaluate("NET(200, 0.25) + ANSWER()", nil)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 192.0)
+		result, err = evaluate("FACT(5)", nil)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 120.0)
+
+		// the body sees the variables of the evaluation, not the names of the caller
+		result, err = evaluate("LET({x}, 100, {n}, 5, ADDX(1))", MapEnv{"x": 1.0})
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 2.0)
+
+		_, err = evaluate("1 + LOOP(0)", nil)
+		var limitErr *LimitError
+		So(errors.As(err, &limitErr), ShouldBeTrue)
+		So(*limitErr, ShouldResemble, LimitError{Limit: LimitCallDepth, Max: DefaultMaxCallDepth, Pos: 4})
+		_, err = evaluate("FACT(20)", nil, WithMaxCallDepth(10))
+		So(errors.Is(err, ErrLimitExceeded), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "call depth over 10")
+
+		expr, err := ParseExpr("FACT(4) + NET(10, 0.5)", WithRegistry(registry))
+		So(err, ShouldBeNil)
+		program, err := Compile(expr)
+		So(err, ShouldBeNil)
+		result, err = program.Eval(context.Background(), nil)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 29.0)
+
+		def, ok := registry.Lookup("fact")
+		So(ok, ShouldBeTrue)
+		fn := def.Function.(*UserFunction)
+		So(fn.Params, ShouldResemble, []string{"n"})
+		So(fn.Source, ShouldEqual, "LAMBDA({n}, IF({n} <= 1, 1, {n} * FACT({n} - 1)))")
+
+		// arity checks
+		_, err = ParseExpr("NET(1)", WithRegistry(registry))
+		So(err.(*ParserError).Diagnostics[0].Code, ShouldEqual, CodeArgumentCount)
+		So(registry.Define("BAD", "LAMBDA({n}, BAD({n}, 1))"), ShouldNotBeNil)
+		_, err = fn.Calculate([]interface{}{1.0, 2.0})
+		So(err, ShouldNotBeNil)
+
+		So(registry.Define("NET", "LAMBDA(1)"), ShouldNotBeNil)
+		So(registry.Define("TWICE", "LAMBDA({a}, {a}, {a})"), ShouldNotBeNil)
+		So(registry.Define("PLAIN", "1 + 2"), ShouldNotBeNil)
+		_, ok = registry.Lookup("PLAIN")
+		So(ok, ShouldBeFalse)
+		_, err = ParseExpr("LAMBDA({a}, {a})")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,143 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"go/token"
+)
+
+// If returns the second argument when the condition is true, otherwise the
+// third one (null when omitted). Only the taken branch is calculated.
+type If int
+
+func (If) Valid(args []Expr) error {
+	return nil
+}
+
+func (If) Calculate(args []interface{}) (interface{}, error) {
+	cond, err := convertToBool(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if cond {
+		return args[1], nil
+	}
+	if len(args) > 2 {
+		return args[2], nil
+	}
+	return nil, nil
+}
+
+func (If) CalculateLazy(ctx context.Context, args []Expr) (interface{}, error) {
+	result, err := args[0].Calculate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := convertToBool(result)
+	if err != nil {
+		return nil, err
+	}
+	if cond {
+		return args[1].Calculate(ctx)
+	}
+	if len(args) > 2 {
+		return args[2].Calculate(ctx)
+	}
+	return nil, nil
+}
+
+// Ifs takes condition/value pairs and returns the value of the first true
+// condition.
+type Ifs int
+
+func (Ifs) Valid(args []Expr) error {
+	if len(args)%2 != 0 {
+		return errors.New("IFS requires condition and value pairs")
+	}
+	return nil
+}
+
+func (Ifs) Calculate(args []interface{}) (interface{}, error) {
+	for i := 0; i < len(args); i += 2 {
+		cond, err := convertToBool(args[i])
+		if err != nil {
+			return nil, err
+		}
+		if cond {
+			return args[i+1], nil
+		}
+	}
+	return nil, errors.New("IFS: no condition is true")
+}
+
+func (Ifs) CalculateLazy(ctx context.Context, args []Expr) (interface{}, error) {
+	for i := 0; i < len(args); i += 2 {
+		result, err := args[i].Calculate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cond, err := convertToBool(result)
+		if err != nil {
+			return nil, err
+		}
+		if cond {
+			return args[i+1].Calculate(ctx)
+		}
+	}
+	return nil, errors.New("IFS: no condition is true")
+}
+
+// Switch compares its first argument with case/value pairs and returns the
+// value of the first equal case, or the trailing default.
+type Switch int
+
+func (Switch) Valid(args []Expr) error {
+	return nil
+}
+
+func (Switch) Calculate(args []interface{}) (interface{}, error) {
+	for i := 1; i+1 < len(args); i += 2 {
+		if equal, err := switchMatch(args[0], args[i]); err != nil {
+			return nil, err
+		} else if equal {
+			return args[i+1], nil
+		}
+	}
+	if len(args)%2 == 0 {
+		return args[len(args)-1], nil
+	}
+	return nil, errors.New("SWITCH: no case matched")
+}
+
+func (Switch) CalculateLazy(ctx context.Context, args []Expr) (interface{}, error) {
+	value, err := args[0].Calculate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i+1 < len(args); i += 2 {
+		c, err := args[i].Calculate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if equal, err := switchMatch(value, c); err != nil {
+			return nil, err
+		} else if equal {
+			return args[i+1].Calculate(ctx)
+		}
+	}
+	if len(args)%2 == 0 {
+		return args[len(args)-1].Calculate(ctx)
+	}
+	return nil, errors.New("SWITCH: no case matched")
+}
+
+func switchMatch(value, c interface{}) (bool, error) {
+	if value == nil || c == nil {
+		return value == nil && c == nil, nil
+	}
+	result, err := compare(token.EQL, value, c)
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
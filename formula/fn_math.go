@@ -0,0 +1,637 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"math"
+)
+
+// The math functions follow Excel where it differs from the math package:
+// ROUND rounds half away from zero on the decimal digits as written (2.675
+// rounds to 2.68), MOD takes the sign of the divisor, and ATAN2 takes x
+// before y. A null argument yields null like the arithmetic operators.
+//
+// Rounding functions, ABS and MOD compute with decimals, so they are exact
+// in decimal mode and return decimals there.
+
+// maxDigits bounds the digits argument of the rounding functions.
+const maxDigits = 1000
+
+var errDivisionByZero = errors.New("division by zero")
+
+func hasNull(args []interface{}) bool {
+	for _, arg := range args {
+		if arg == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// exactArgs reports whether a function computes with decimals, in decimal
+// mode or with decimal arguments.
+func exactArgs(ctx context.Context, args []interface{}) bool {
+	_, ok := decimalOptions(ctx)
+	return ok || hasDecimal(args)
+}
+
+var errNotFinite = errors.New("argument should be a finite number")
+
+// finiteArg returns a number argument, which should be finite.
+func finiteArg(args []interface{}, index int) (float64, error) {
+	x, err := numberArg(args, index)
+	if err == nil && (math.IsNaN(x) || math.IsInf(x, 0)) {
+		return 0, argError(index, errNotFinite)
+	}
+	return x, err
+}
+
+func decimalArg(args []interface{}, index int) (Decimal, error) {
+	if x, ok := args[index].(float64); ok && (math.IsNaN(x) || math.IsInf(x, 0)) {
+		return Decimal{}, argError(index, errNotFinite)
+	}
+	result, err := convertToDecimal(args[index])
+	if err != nil {
+		return Decimal{}, argTypeError(index, "number", args[index])
+	}
+	return result, nil
+}
+
+// digitsArg returns the number of digits argument, truncated to an integer.
+func digitsArg(args []interface{}, index int) (int, error) {
+	if index >= len(args) {
+		return 0, nil
+	}
+	n, err := numberArg(args, index)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(n) || math.Abs(n) > maxDigits {
+		return 0, argError(index, fmt.Errorf("digits should be between -%d and %d", maxDigits, maxDigits))
+	}
+	return int(n), nil
+}
+
+// exactResult returns d, converted to float64 out of the decimal mode.
+func exactResult(ctx context.Context, args []interface{}, d Decimal) interface{} {
+	if exactArgs(ctx, args) {
+		return d
+	}
+	return d.Float64()
+}
+
+// floatMath applies f to the number argument, non finite results are
+// errors. The result is rounded to the scale of the decimal mode.
+func floatMath(ctx context.Context, args []interface{}, f func(x float64) (float64, error)) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	x, err := numberArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	result, err := f(x)
+	if err != nil {
+		return nil, argError(0, err)
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, argError(0, fmt.Errorf("result for %v is not a finite number", x))
+	}
+	return floatResult(ctx, args, result)
+}
+
+// floatResult returns a result computed with floats, rounded to the scale of
+// the decimal mode like the non integral powers are.
+func floatResult(ctx context.Context, args []interface{}, result float64) (interface{}, error) {
+	if opt, ok := decimalOptions(ctx); ok || hasDecimal(args) {
+		d, err := DecimalFromFloat(result)
+		if err != nil {
+			return nil, err
+		}
+		return d.Round(opt.Scale, opt.Rounding), nil
+	}
+	return result, nil
+}
+
+// roundNumber rounds the first argument to the digits of the optional
+// second one.
+func roundNumber(ctx context.Context, args []interface{}, mode RoundingMode) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	x, err := decimalArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	digits, err := digitsArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return exactResult(ctx, args, x.Round(digits, mode)), nil
+}
+
+// Abs returns the absolute value of a number.
+type Abs int
+
+func (Abs) Valid(args []Expr) error {
+	return nil
+}
+
+func (abs Abs) Calculate(args []interface{}) (interface{}, error) {
+	return abs.CalculateContext(context.Background(), args)
+}
+
+func (Abs) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	if exactArgs(ctx, args) {
+		x, err := decimalArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return x.Abs(), nil
+	}
+	x, err := numberArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return math.Abs(x), nil
+}
+
+// Round rounds a number to n digits, ties away from zero. A negative n
+// rounds to tens, hundreds and so on.
+type Round int
+
+func (Round) Valid(args []Expr) error {
+	return nil
+}
+
+func (round Round) Calculate(args []interface{}) (interface{}, error) {
+	return round.CalculateContext(context.Background(), args)
+}
+
+func (Round) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return roundNumber(ctx, args, RoundHalfUp)
+}
+
+// Roundup rounds a number away from zero to n digits.
+type Roundup int
+
+func (Roundup) Valid(args []Expr) error {
+	return nil
+}
+
+func (round Roundup) Calculate(args []interface{}) (interface{}, error) {
+	return round.CalculateContext(context.Background(), args)
+}
+
+func (Roundup) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return roundNumber(ctx, args, RoundUp)
+}
+
+// Rounddown rounds a number towards zero to n digits.
+type Rounddown int
+
+func (Rounddown) Valid(args []Expr) error {
+	return nil
+}
+
+func (round Rounddown) Calculate(args []interface{}) (interface{}, error) {
+	return round.CalculateContext(context.Background(), args)
+}
+
+func (Rounddown) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return roundNumber(ctx, args, RoundDown)
+}
+
+// Trunc truncates a number to n (default 0) digits.
+type Trunc int
+
+func (Trunc) Valid(args []Expr) error {
+	return nil
+}
+
+func (trunc Trunc) Calculate(args []interface{}) (interface{}, error) {
+	return trunc.CalculateContext(context.Background(), args)
+}
+
+func (Trunc) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return roundNumber(ctx, args, RoundDown)
+}
+
+// roundMultiple rounds the first argument to a multiple of the optional
+// significance (default 1). mode rounds a positive significance, a negative
+// one requires a negative number and rounds its magnitude with magnitude.
+func roundMultiple(ctx context.Context, args []interface{}, mode, magnitude RoundingMode) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	x, err := decimalArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	significance := NewDecimal(1, 0)
+	if len(args) > 1 {
+		if significance, err = decimalArg(args, 1); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case significance.IsZero() && mode == RoundCeiling:
+		return exactResult(ctx, args, Decimal{}), nil
+	case significance.IsZero():
+		return nil, argError(1, errors.New("significance should not be 0"))
+	case significance.Sign() < 0 && x.Sign() > 0:
+		return nil, argError(1, errors.New("significance should not be negative for a positive number"))
+	case significance.Sign() < 0:
+		mode = magnitude
+	}
+	multiple := x.Quo(significance, 0, mode)
+	return exactResult(ctx, args, multiple.Mul(significance)), nil
+}
+
+// Floor rounds a number down to a multiple of the significance (default 1),
+// towards zero when both are negative.
+type Floor int
+
+func (Floor) Valid(args []Expr) error {
+	return nil
+}
+
+func (floor Floor) Calculate(args []interface{}) (interface{}, error) {
+	return floor.CalculateContext(context.Background(), args)
+}
+
+func (Floor) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return roundMultiple(ctx, args, RoundFloor, RoundDown)
+}
+
+// Ceil rounds a number up to a multiple of the significance (default 1),
+// away from zero when both are negative. A significance of 0 yields 0.
+type Ceil int
+
+func (Ceil) Valid(args []Expr) error {
+	return nil
+}
+
+func (ceil Ceil) Calculate(args []interface{}) (interface{}, error) {
+	return ceil.CalculateContext(context.Background(), args)
+}
+
+func (Ceil) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return roundMultiple(ctx, args, RoundCeiling, RoundUp)
+}
+
+// Mod returns the remainder of x / y with the sign of y, MOD(-3, 2) is 1.
+type Mod int
+
+func (Mod) Valid(args []Expr) error {
+	return nil
+}
+
+func (mod Mod) Calculate(args []interface{}) (interface{}, error) {
+	return mod.CalculateContext(context.Background(), args)
+}
+
+func (Mod) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	x, err := decimalArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decimalArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if y.IsZero() {
+		return nil, argError(1, errDivisionByZero)
+	}
+	result := x.Mod(y)
+	if !result.IsZero() && result.Sign() != y.Sign() {
+		result = result.Add(y)
+	}
+	return exactResult(ctx, args, result), nil
+}
+
+// Sign returns -1, 0 or 1 by the sign of a number.
+type Sign int
+
+func (Sign) Valid(args []Expr) error {
+	return nil
+}
+
+func (Sign) Calculate(args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	x, err := decimalArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return float64(x.Sign()), nil
+}
+
+// Pow returns x raised to the power y. Unlike math.Pow, 0^0, 0 raised to a
+// negative power and a negative number raised to a fraction are errors.
+type Pow int
+
+func (Pow) Valid(args []Expr) error {
+	return nil
+}
+
+func (pow Pow) Calculate(args []interface{}) (interface{}, error) {
+	return pow.CalculateContext(context.Background(), args)
+}
+
+func (Pow) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	x, err := finiteArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	y, err := finiteArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case x == 0 && y == 0:
+		return nil, argError(1, errors.New("0^0 is not defined"))
+	case x == 0 && y < 0:
+		return nil, argError(1, errDivisionByZero)
+	case x < 0 && y != math.Trunc(y):
+		return nil, argError(1, fmt.Errorf("negative number %v cannot be raised to the fraction %v", x, y))
+	}
+	if opt, ok := decimalOptions(ctx); ok || hasDecimal(args) {
+		X, _ := convertToDecimal(args[0])
+		Y, _ := convertToDecimal(args[1])
+		return decimalArithmetic(token.XOR, X, Y, opt)
+	}
+	result := math.Pow(x, y)
+	if math.IsInf(result, 0) {
+		return nil, fmt.Errorf("power %v^%v is not a finite number", x, y)
+	}
+	return result, nil
+}
+
+// Sqrt returns the square root of a number, which should not be negative.
+type Sqrt int
+
+func (Sqrt) Valid(args []Expr) error {
+	return nil
+}
+
+func (sqrt Sqrt) Calculate(args []interface{}) (interface{}, error) {
+	return sqrt.CalculateContext(context.Background(), args)
+}
+
+func (Sqrt) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, fmt.Errorf("cannot take the square root of negative number %v", x)
+		}
+		return math.Sqrt(x), nil
+	})
+}
+
+// Exp returns e raised to the power of a number.
+type Exp int
+
+func (Exp) Valid(args []Expr) error {
+	return nil
+}
+
+func (exp Exp) Calculate(args []interface{}) (interface{}, error) {
+	return exp.CalculateContext(context.Background(), args)
+}
+
+func (Exp) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		return math.Exp(x), nil
+	})
+}
+
+// Ln returns the natural logarithm of a positive number.
+type Ln int
+
+func (Ln) Valid(args []Expr) error {
+	return nil
+}
+
+func (ln Ln) Calculate(args []interface{}) (interface{}, error) {
+	return ln.CalculateContext(context.Background(), args)
+}
+
+func (Ln) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, fmt.Errorf("logarithm of %v is not defined, the number should be positive", x)
+		}
+		return math.Log(x), nil
+	})
+}
+
+// Log10 returns the decimal logarithm of a positive number.
+type Log10 int
+
+func (Log10) Valid(args []Expr) error {
+	return nil
+}
+
+func (log10 Log10) Calculate(args []interface{}) (interface{}, error) {
+	return log10.CalculateContext(context.Background(), args)
+}
+
+func (Log10) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, fmt.Errorf("logarithm of %v is not defined, the number should be positive", x)
+		}
+		return math.Log10(x), nil
+	})
+}
+
+// Pi returns π.
+type Pi int
+
+func (Pi) Valid(args []Expr) error {
+	return nil
+}
+
+func (Pi) Calculate(args []interface{}) (interface{}, error) {
+	return math.Pi, nil
+}
+
+// Sin returns the sine of an angle in radians.
+type Sin int
+
+func (Sin) Valid(args []Expr) error {
+	return nil
+}
+
+func (sin Sin) Calculate(args []interface{}) (interface{}, error) {
+	return sin.CalculateContext(context.Background(), args)
+}
+
+func (Sin) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		return math.Sin(x), nil
+	})
+}
+
+// Cos returns the cosine of an angle in radians.
+type Cos int
+
+func (Cos) Valid(args []Expr) error {
+	return nil
+}
+
+func (cos Cos) Calculate(args []interface{}) (interface{}, error) {
+	return cos.CalculateContext(context.Background(), args)
+}
+
+func (Cos) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		return math.Cos(x), nil
+	})
+}
+
+// Tan returns the tangent of an angle in radians.
+type Tan int
+
+func (Tan) Valid(args []Expr) error {
+	return nil
+}
+
+func (tan Tan) Calculate(args []interface{}) (interface{}, error) {
+	return tan.CalculateContext(context.Background(), args)
+}
+
+func (Tan) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		return math.Tan(x), nil
+	})
+}
+
+// Asin returns the arcsine in radians of a number between -1 and 1.
+type Asin int
+
+func (Asin) Valid(args []Expr) error {
+	return nil
+}
+
+func (asin Asin) Calculate(args []interface{}) (interface{}, error) {
+	return asin.CalculateContext(context.Background(), args)
+}
+
+func (Asin) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		if x < -1 || x > 1 {
+			return 0, fmt.Errorf("arcsine of %v is not defined, the number should be between -1 and 1", x)
+		}
+		return math.Asin(x), nil
+	})
+}
+
+// Acos returns the arccosine in radians of a number between -1 and 1.
+type Acos int
+
+func (Acos) Valid(args []Expr) error {
+	return nil
+}
+
+func (acos Acos) Calculate(args []interface{}) (interface{}, error) {
+	return acos.CalculateContext(context.Background(), args)
+}
+
+func (Acos) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		if x < -1 || x > 1 {
+			return 0, fmt.Errorf("arccosine of %v is not defined, the number should be between -1 and 1", x)
+		}
+		return math.Acos(x), nil
+	})
+}
+
+// Atan returns the arctangent of a number in radians.
+type Atan int
+
+func (Atan) Valid(args []Expr) error {
+	return nil
+}
+
+func (atan Atan) Calculate(args []interface{}) (interface{}, error) {
+	return atan.CalculateContext(context.Background(), args)
+}
+
+func (Atan) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		return math.Atan(x), nil
+	})
+}
+
+// Atan2 returns the angle in radians of the point (x, y). Like Excel it
+// takes x first, the reverse of math.Atan2.
+type Atan2 int
+
+func (Atan2) Valid(args []Expr) error {
+	return nil
+}
+
+func (Atan2) Calculate(args []interface{}) (interface{}, error) {
+	if hasNull(args) {
+		return nil, nil
+	}
+	x, err := numberArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	y, err := numberArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if x == 0 && y == 0 {
+		return nil, argError(0, errors.New("angle of point (0, 0) is not defined"))
+	}
+	return math.Atan2(y, x), nil
+}
+
+// Degrees converts radians to degrees.
+type Degrees int
+
+func (Degrees) Valid(args []Expr) error {
+	return nil
+}
+
+func (degrees Degrees) Calculate(args []interface{}) (interface{}, error) {
+	return degrees.CalculateContext(context.Background(), args)
+}
+
+func (Degrees) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		return x * 180 / math.Pi, nil
+	})
+}
+
+// Radians converts degrees to radians.
+type Radians int
+
+func (Radians) Valid(args []Expr) error {
+	return nil
+}
+
+func (radians Radians) Calculate(args []interface{}) (interface{}, error) {
+	return radians.CalculateContext(context.Background(), args)
+}
+
+func (Radians) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	return floatMath(ctx, args, func(x float64) (float64, error) {
+		return x * math.Pi / 180, nil
+	})
+}
@@ -0,0 +1,109 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMath(t *testing.T) {
+	Convey("results", t, func() {
+		vars := map[string]interface{}{"none": nil}
+		for expression, want := range map[string]interface{}{
+			"ABS(-2.5)":                      2.5,
+			"ROUND(2.675, 2)":                2.68,
+			"ROUND(-2.5, 0)":                 -3.0,
+			"ROUND(1234.5, -2)":              1200.0,
+			"ROUNDUP(1.201, 2)":              1.21,
+			"ROUNDUP(-1.201, 2)":             -1.21,
+			"ROUNDDOWN(-1.209, 2)":           -1.2,
+			"TRUNC(8.97)":                    8.0,
+			"TRUNC(-8.97, 1)":                -8.9,
+			"FLOOR(2.5)":                     2.0,
+			"FLOOR(-2.5, 2)":                 -4.0,
+			"FLOOR(-2.5, -2)":                -2.0,
+			"FLOOR(0.3, 0.1)":                0.3,
+			"CEIL(2.1)":                      3.0,
+			"CEILING(-2.5, 2)":               -2.0,
+			"CEIL(-2.5, -2)":                 -4.0,
+			"CEIL(4.2, 0)":                   0.0,
+			"MOD(-3, 2)":                     1.0,
+			"MOD(3, -2)":                     -1.0,
+			"MOD(0.3, 0.1)":                  0.0,
+			"SIGN(-0.1)":                     -1.0,
+			"POW(2, 10)":                     1024.0,
+			"POWER(-8, 1/3 * 3)":             -8.0,
+			"SQRT(16)":                       4.0,
+			"EXP(0)":                         1.0,
+			"LN(EXP(2))":                     2.0,
+			"LOG10(1000)":                    3.0,
+			"ROUND(PI(), 4)":                 3.1416,
+			"ROUND(SIN(PI() / 2), 6)":        1.0,
+			"ROUND(DEGREES(ATAN2(1, 1)), 6)": 45.0,
+			"RADIANS(180) == PI()":           true,
+			"ROUND(ACOS(-1), 4)":             3.1416,
+			"ROUND({none}, 2)":               nil,
+			"SQRT({none})":                   nil,
+		} {
+			result, err := calculate(expression, vars)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, want)
+		}
+	})
+
+	Convey("domain errors", t, func() {
+		for expression, msg := range map[string]string{
+			"SQRT(-1)":       "square root of negative number -1",
+			"LN(0)":          "logarithm of 0 is not defined",
+			"LOG10(-1)":      "logarithm of -1 is not defined",
+			"ASIN(2)":        "arcsine of 2 is not defined",
+			"ACOS(-1.5)":     "arccosine of -1.5 is not defined",
+			"MOD(1, 0)":      "division by zero",
+			"POW(0, 0)":      "0^0 is not defined",
+			"POW(0, -1)":     "division by zero",
+			"POW(-8, 0.5)":   "cannot be raised to the fraction 0.5",
+			"EXP(1000)":      "not a finite number",
+			"FLOOR(2, 0)":    "significance should not be 0",
+			"FLOOR(2, -1)":   "significance should not be negative",
+			"ATAN2(0, 0)":    "angle of point (0, 0) is not defined",
+			"ROUND(1, 5000)": "digits should be between",
+			"ROUND(1, (10^300*10^300)-(10^300*10^300))": "digits should be between",
+			"ROUND((10^300*10^300)-(10^300*10^300), 1)": "argument should be a finite number",
+			"MOD(10^300*10^300, 2)":                     "argument should be a finite number",
+			"FLOOR(2, (10^300*10^300)-(10^300*10^300))": "argument should be a finite number",
+			"POW((10^300*10^300)-(10^300*10^300), 2)":   "argument should be a finite number",
+		} {
+			_, err := calculate(expression, nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, msg)
+		}
+		_, err := calculate("SQRT(4 - 5)", nil)
+		var argErr *ArgumentError
+		So(errors.As(err, &argErr), ShouldBeTrue)
+		So(argErr.Fn, ShouldEqual, "SQRT")
+		So(argErr.Pos, ShouldEqual, 5)
+	})
+
+	Convey("decimal mode", t, func() {
+		for expression, want := range map[string]string{
+			"ROUND(1.005, 2)":   "1.01",
+			"ABS(-0.1) + 0.2":   "0.3",
+			"MOD(-0.5, 0.2)":    "0.1",
+			"FLOOR(1.27, 0.05)": "1.25",
+			"POW(1.1, 2)":       "1.21",
+			"SQRT(2.25)":        "1.5",
+			"SQRT(2)":           "1.4142",
+			"EXP(1) + LN(2)":    "3.4114",
+			"DEGREES(PI())":     "180",
+		} {
+			expr, err := ParseExpr(expression)
+			So(err, ShouldBeNil)
+			result, err := Evaluate(context.Background(), expr, MapEnv{}, WithDecimal(4, RoundHalfUp))
+			So(err, ShouldBeNil)
+			So(result, ShouldHaveSameTypeAs, Decimal{})
+			So(convertToText(result), ShouldEqual, want)
+		}
+	})
+}
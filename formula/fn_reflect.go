@@ -0,0 +1,233 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	decimalType = reflect.TypeOf(Decimal{})
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// RegisterFunc adds a plain Go func under name, its signature is derived
+// from the parameter and result types:
+//
+//	r.RegisterFunc("DISCOUNT", func(price float64, rate float64) float64 { ... })
+//
+// Parameters may be numbers (including Decimal), strings, bools, dates
+// (time.Time), slices of these, or interface{} for any value, and the last
+// one may be variadic. A leading context.Context receives the evaluation
+// context. The func returns a single value, optionally followed by an error.
+func (r *Registry) RegisterFunc(name string, fn interface{}) error {
+	rf, err := newReflectFunction(fn)
+	if err != nil {
+		return fmt.Errorf("function %s: %w", name, err)
+	}
+	return r.Register(name, rf, rf.sig)
+}
+
+type reflectFunction struct {
+	fn      reflect.Value
+	params  []reflect.Type
+	sig     Signature
+	withCtx bool
+}
+
+var _ ContextFunction = (*reflectFunction)(nil)
+
+func newReflectFunction(fn interface{}) (*reflectFunction, error) {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return nil, fmt.Errorf("%T is not a func", fn)
+	}
+	typ := value.Type()
+	rf := &reflectFunction{fn: value, sig: Signature{Variadic: typ.IsVariadic()}}
+	for i := 0; i < typ.NumIn(); i++ {
+		param := typ.In(i)
+		if i == 0 && param == contextType {
+			rf.withCtx = true
+			continue
+		}
+		if rf.sig.Variadic && i == typ.NumIn()-1 {
+			param = param.Elem()
+			rf.sig.Optional = 1
+		}
+		paramType, ok := formulaType(param)
+		if !ok {
+			return nil, fmt.Errorf("unsupported parameter type %s", param)
+		}
+		rf.params = append(rf.params, param)
+		rf.sig.Params = append(rf.sig.Params, paramType)
+	}
+	switch {
+	case typ.NumOut() == 2 && typ.Out(1) == errorType, typ.NumOut() == 1:
+		result, ok := formulaType(typ.Out(0))
+		if !ok {
+			return nil, fmt.Errorf("unsupported result type %s", typ.Out(0))
+		}
+		rf.sig.Result = result
+	default:
+		return nil, errors.New("func should return a value and an optional error")
+	}
+	return rf, nil
+}
+
+// formulaType maps a Go type to the formula type of its values.
+func formulaType(typ reflect.Type) (Type, bool) {
+	switch typ {
+	case decimalType:
+		return TypeNumber, true
+	case timeType:
+		return TypeDate, true
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return TypeNumber, true
+	case reflect.String:
+		return TypeString, true
+	case reflect.Bool:
+		return TypeBool, true
+	case reflect.Slice, reflect.Array:
+		if elem, ok := formulaType(typ.Elem()); ok {
+			return ArrayOf(elem), true
+		}
+	case reflect.Interface:
+		if typ.NumMethod() == 0 {
+			return TypeAny, true
+		}
+	}
+	return 0, false
+}
+
+func (rf *reflectFunction) Valid(args []Expr) error {
+	return nil
+}
+
+func (rf *reflectFunction) Calculate(args []interface{}) (interface{}, error) {
+	return rf.CalculateContext(context.Background(), args)
+}
+
+func (rf *reflectFunction) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	in := make([]reflect.Value, 0, len(args)+1)
+	if rf.withCtx {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	for i, arg := range args {
+		param := rf.params[min(i, len(rf.params)-1)]
+		value, err := convertToGo(arg, param)
+		if err != nil {
+			paramType, _ := formulaType(param)
+			return nil, argTypeError(i, paramType.String(), arg)
+		}
+		in = append(in, value)
+	}
+	out := rf.fn.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	return normalizeValue(out[0].Interface()), nil
+}
+
+var errConvert = errors.New("类型转换错误")
+
+// convertToGo converts a formula value to a value of typ.
+func convertToGo(arg interface{}, typ reflect.Type) (reflect.Value, error) {
+	switch typ {
+	case decimalType:
+		d, err := convertToDecimal(arg)
+		return reflect.ValueOf(d), err
+	case timeType:
+		if t, ok := arg.(time.Time); ok {
+			return reflect.ValueOf(t), nil
+		}
+		return reflect.Value{}, errConvert
+	}
+	switch typ.Kind() {
+	case reflect.Interface:
+		if arg == nil {
+			return reflect.Zero(typ), nil
+		}
+		return reflect.ValueOf(arg), nil
+	case reflect.String:
+		if arg == nil {
+			return reflect.Zero(typ), nil
+		}
+		if text, ok := arg.(string); ok {
+			return reflect.ValueOf(text).Convert(typ), nil
+		}
+	case reflect.Bool:
+		if cond, err := convertToBool(arg); err == nil {
+			return reflect.ValueOf(cond).Convert(typ), nil
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := arg.([]interface{})
+		if !ok && arg != nil {
+			break
+		}
+		if typ.Kind() == reflect.Array && len(items) != typ.Len() {
+			break
+		}
+		value := reflect.New(typ).Elem()
+		if typ.Kind() == reflect.Slice {
+			if arg == nil {
+				return value, nil
+			}
+			value = reflect.MakeSlice(typ, len(items), len(items))
+		}
+		for i, item := range items {
+			itemValue, err := convertToGo(item, typ.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value.Index(i).Set(itemValue)
+		}
+		return value, nil
+	default:
+		if number, err := convertToFloat(arg); err == nil {
+			if value, ok := convertNumber(number, typ); ok {
+				return value, nil
+			}
+		}
+	}
+	return reflect.Value{}, errConvert
+}
+
+// convertNumber converts number to a value of the number type typ, ok is
+// false when typ cannot hold it exactly: a fraction or a value out of the
+// range of an integer type, or a value out of the range of a float type.
+func convertNumber(number float64, typ reflect.Type) (value reflect.Value, ok bool) {
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return reflect.Value{}, false
+	}
+	value = reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// -2^63 is the only bound exactly representable in float64
+		if number != math.Trunc(number) || number < math.MinInt64 || number >= -math.MinInt64 || value.OverflowInt(int64(number)) {
+			return reflect.Value{}, false
+		}
+		value.SetInt(int64(number))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if number != math.Trunc(number) || number < 0 || number >= 1<<64 || value.OverflowUint(uint64(number)) {
+			return reflect.Value{}, false
+		}
+		value.SetUint(uint64(number))
+	case reflect.Float32, reflect.Float64:
+		if value.OverflowFloat(number) {
+			return reflect.Value{}, false
+		}
+		value.SetFloat(number)
+	default:
+		return reflect.Value{}, false
+	}
+	return value, true
+}
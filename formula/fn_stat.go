@@ -0,0 +1,593 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// The statistical functions take numbers and arrays alike, arrays are
+// flattened. Nulls are skipped everywhere, like Excel skips blank cells,
+// while text and bools are type errors, except for COUNT, which counts the
+// numbers, and the criteria of COUNTIF and SUMIF.
+//
+// The functions selecting values (MEDIAN, MODE, LARGE, SMALL) and the sums
+// (SUMPRODUCT, SUMIF) are exact in decimal mode, the others compute in
+// float64.
+
+func floatValues(args []interface{}) ([]float64, error) {
+	values := make([]float64, 0, len(args))
+	_, err := processFloatArgs(args, func(f float64) error {
+		values = append(values, f)
+		return nil
+	})
+	return values, err
+}
+
+func decimalValues(args []interface{}) ([]Decimal, error) {
+	values := make([]Decimal, 0, len(args))
+	_, err := processDecimalArgs(args, func(d Decimal) error {
+		values = append(values, d)
+		return nil
+	})
+	return values, err
+}
+
+// sortedDecimals returns the sorted numbers of args, there is at least one.
+func sortedDecimals(args []interface{}) ([]Decimal, error) {
+	values, err := decimalValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, argError(0, errNoNumbers)
+	}
+	slices.SortFunc(values, Decimal.Cmp)
+	return values, nil
+}
+
+// rankArg returns the 1 based rank argument at index of n values.
+func rankArg(args []interface{}, index int, n int) (int, error) {
+	k, err := numberArg(args, index)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(k) || k < 1 || k >= float64(n+1) {
+		return 0, argError(index, fmt.Errorf("k should be between 1 and %d, got %v", n, k))
+	}
+	return int(k), nil
+}
+
+// itemsArg returns the items of an array argument, a single value is an
+// array of one and null an empty one.
+func itemsArg(arg interface{}) []interface{} {
+	switch arg := arg.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return arg
+	default:
+		return []interface{}{arg}
+	}
+}
+
+// Count returns the number of numbers in its arguments.
+type Count int
+
+func (Count) Valid(args []Expr) error {
+	return nil
+}
+
+func (Count) Calculate(args []interface{}) (interface{}, error) {
+	count := 0
+	var visit func(arg interface{})
+	visit = func(arg interface{}) {
+		switch arg := arg.(type) {
+		case []interface{}:
+			for _, item := range arg {
+				visit(item)
+			}
+		case int, float64, Decimal:
+			count++
+		}
+	}
+	for _, arg := range args {
+		visit(arg)
+	}
+	return float64(count), nil
+}
+
+// Median returns the middle number, the mean of the two middle ones for an
+// even count.
+type Median int
+
+func (Median) Valid(args []Expr) error {
+	return nil
+}
+
+func (median Median) Calculate(args []interface{}) (interface{}, error) {
+	return median.CalculateContext(context.Background(), args)
+}
+
+func (Median) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	values, err := sortedDecimals(args)
+	if err != nil {
+		return nil, err
+	}
+	n := len(values)
+	result := values[n/2]
+	if n%2 == 0 {
+		sum := values[n/2-1].Add(result)
+		result = sum.Quo(NewDecimal(2, 0), sum.Scale()+1, RoundHalfUp)
+	}
+	return exactResult(ctx, args, result), nil
+}
+
+// Mode returns the most frequent number, the first one of them in case of a
+// tie. It fails when no number occurs twice.
+type Mode int
+
+func (Mode) Valid(args []Expr) error {
+	return nil
+}
+
+func (mode Mode) Calculate(args []interface{}) (interface{}, error) {
+	return mode.CalculateContext(context.Background(), args)
+}
+
+func (Mode) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	values, err := decimalValues(args)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(values))
+	best := 1
+	for _, value := range values {
+		key := value.trim().String()
+		counts[key]++
+		best = max(best, counts[key])
+	}
+	if best == 1 {
+		return nil, argError(0, errors.New("no number occurs more than once"))
+	}
+	for _, value := range values {
+		if counts[value.trim().String()] == best {
+			return exactResult(ctx, args, value), nil
+		}
+	}
+	return nil, nil
+}
+
+// variance returns the variance of the numbers of args, of a sample when
+// sample is true, otherwise of the whole population.
+func variance(args []interface{}, sample bool) (float64, error) {
+	values, err := floatValues(args)
+	if err != nil {
+		return 0, err
+	}
+	n := len(values)
+	if sample && n < 2 {
+		return 0, argError(0, fmt.Errorf("a sample needs at least 2 numbers, got %d", n))
+	}
+	if n == 0 {
+		return 0, argError(0, errNoNumbers)
+	}
+	var mean float64
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(n)
+	var sum float64
+	for _, value := range values {
+		sum += (value - mean) * (value - mean)
+	}
+	if sample {
+		return sum / float64(n-1), nil
+	}
+	return sum / float64(n), nil
+}
+
+// Var returns the variance of a sample.
+type Var int
+
+func (Var) Valid(args []Expr) error {
+	return nil
+}
+
+func (v Var) Calculate(args []interface{}) (interface{}, error) {
+	return v.CalculateContext(context.Background(), args)
+}
+
+func (Var) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	result, err := variance(args, true)
+	if err != nil {
+		return nil, err
+	}
+	return floatResult(ctx, args, result)
+}
+
+// VarP returns the variance of a whole population.
+type VarP int
+
+func (VarP) Valid(args []Expr) error {
+	return nil
+}
+
+func (varP VarP) Calculate(args []interface{}) (interface{}, error) {
+	return varP.CalculateContext(context.Background(), args)
+}
+
+func (VarP) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	result, err := variance(args, false)
+	if err != nil {
+		return nil, err
+	}
+	return floatResult(ctx, args, result)
+}
+
+// Stdev returns the standard deviation of a sample.
+type Stdev int
+
+func (Stdev) Valid(args []Expr) error {
+	return nil
+}
+
+func (stdev Stdev) Calculate(args []interface{}) (interface{}, error) {
+	return stdev.CalculateContext(context.Background(), args)
+}
+
+func (Stdev) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	result, err := variance(args, true)
+	if err != nil {
+		return nil, err
+	}
+	return floatResult(ctx, args, math.Sqrt(result))
+}
+
+// StdevP returns the standard deviation of a whole population.
+type StdevP int
+
+func (StdevP) Valid(args []Expr) error {
+	return nil
+}
+
+func (stdevP StdevP) Calculate(args []interface{}) (interface{}, error) {
+	return stdevP.CalculateContext(context.Background(), args)
+}
+
+func (StdevP) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	result, err := variance(args, false)
+	if err != nil {
+		return nil, err
+	}
+	return floatResult(ctx, args, math.Sqrt(result))
+}
+
+// Percentile returns the k-th percentile of an array, k between 0 and 1,
+// interpolating between the closest ranks like Excel's PERCENTILE.INC.
+type Percentile int
+
+func (Percentile) Valid(args []Expr) error {
+	return nil
+}
+
+func (percentile Percentile) Calculate(args []interface{}) (interface{}, error) {
+	return percentile.CalculateContext(context.Background(), args)
+}
+
+func (Percentile) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	values, err := floatValues(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, argError(0, errNoNumbers)
+	}
+	k, err := numberArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(k) || k < 0 || k > 1 {
+		return nil, argError(1, fmt.Errorf("k should be between 0 and 1, got %v", k))
+	}
+	slices.Sort(values)
+	rank := k * float64(len(values)-1)
+	i := int(rank)
+	if i == len(values)-1 {
+		return floatResult(ctx, args, values[i])
+	}
+	return floatResult(ctx, args, values[i]+(rank-float64(i))*(values[i+1]-values[i]))
+}
+
+// Large returns the k-th largest number of an array.
+type Large int
+
+func (Large) Valid(args []Expr) error {
+	return nil
+}
+
+func (large Large) Calculate(args []interface{}) (interface{}, error) {
+	return large.CalculateContext(context.Background(), args)
+}
+
+func (Large) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	values, err := sortedDecimals(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	k, err := rankArg(args, 1, len(values))
+	if err != nil {
+		return nil, err
+	}
+	return exactResult(ctx, args, values[len(values)-k]), nil
+}
+
+// Small returns the k-th smallest number of an array.
+type Small int
+
+func (Small) Valid(args []Expr) error {
+	return nil
+}
+
+func (small Small) Calculate(args []interface{}) (interface{}, error) {
+	return small.CalculateContext(context.Background(), args)
+}
+
+func (Small) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	values, err := sortedDecimals(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	k, err := rankArg(args, 1, len(values))
+	if err != nil {
+		return nil, err
+	}
+	return exactResult(ctx, args, values[k-1]), nil
+}
+
+// SumProduct multiplies the items at the same index of arrays of the same
+// length and sums the products. Items other than numbers count as 0.
+type SumProduct int
+
+func (SumProduct) Valid(args []Expr) error {
+	return nil
+}
+
+func (sp SumProduct) Calculate(args []interface{}) (interface{}, error) {
+	return sp.CalculateContext(context.Background(), args)
+}
+
+func (SumProduct) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	arrays := make([][]interface{}, len(args))
+	for i, arg := range args {
+		arrays[i] = itemsArg(arg)
+		if len(arrays[i]) != len(arrays[0]) {
+			return nil, argError(i, fmt.Errorf("arrays should have the same length, got %d and %d", len(arrays[0]), len(arrays[i])))
+		}
+	}
+	var result Decimal
+	for j := range arrays[0] {
+		product := NewDecimal(1, 0)
+		for _, array := range arrays {
+			item, err := convertToDecimal(array[j])
+			if err != nil {
+				product = Decimal{}
+				break
+			}
+			product = product.Mul(item)
+		}
+		result = result.Add(product)
+	}
+	return exactResult(ctx, args, result), nil
+}
+
+// CountIf returns the number of items of an array matching a criteria, see
+// newCriteria.
+type CountIf int
+
+func (CountIf) Valid(args []Expr) error {
+	return nil
+}
+
+func (CountIf) Calculate(args []interface{}) (interface{}, error) {
+	match, err := newCriteria(args[1])
+	if err != nil {
+		return nil, argError(1, err)
+	}
+	count := 0
+	for _, item := range itemsArg(args[0]) {
+		if match(item) {
+			count++
+		}
+	}
+	return float64(count), nil
+}
+
+// SumIf sums the numbers of the optional sum array (default the array
+// itself) at the indexes where the array matches a criteria, see
+// newCriteria.
+type SumIf int
+
+func (SumIf) Valid(args []Expr) error {
+	return nil
+}
+
+func (sumIf SumIf) Calculate(args []interface{}) (interface{}, error) {
+	return sumIf.CalculateContext(context.Background(), args)
+}
+
+func (SumIf) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	match, err := newCriteria(args[1])
+	if err != nil {
+		return nil, argError(1, err)
+	}
+	items, sumItems := itemsArg(args[0]), itemsArg(args[0])
+	if len(args) > 2 {
+		if sumItems = itemsArg(args[2]); len(sumItems) != len(items) {
+			return nil, argError(2, fmt.Errorf("arrays should have the same length, got %d and %d", len(items), len(sumItems)))
+		}
+	}
+	var result Decimal
+	for i, item := range items {
+		if !match(item) {
+			continue
+		}
+		if value, err := convertToDecimal(sumItems[i]); err == nil {
+			result = result.Add(value)
+		}
+	}
+	return exactResult(ctx, args, result), nil
+}
+
+// newCriteria returns the predicate of a COUNTIF or SUMIF criteria. A number
+// or a bool matches equal items. Text may start with a comparison operator
+// (=, <>, <, <=, >, >=) followed by a number, TRUE, FALSE or text. Text is
+// compared case insensitively, and = and <> match the wildcards * and ?,
+// escaped with ~. "=" matches null and empty text, "<>" anything else.
+func newCriteria(criteria interface{}) (func(item interface{}) bool, error) {
+	switch criteria := criteria.(type) {
+	case nil:
+		return isBlank, nil
+	case bool:
+		return func(item interface{}) bool { return item == criteria }, nil
+	case string:
+		return textCriteria(criteria), nil
+	}
+	number, err := convertToFloat(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("%w: criteria should be a number, a bool or text, got %s", ErrArgumentType, typeName(criteria))
+	}
+	return func(item interface{}) bool {
+		value, ok := numberItem(item)
+		return ok && value == number
+	}, nil
+}
+
+var criteriaOps = []string{"<=", ">=", "<>", "<", ">", "="}
+
+func textCriteria(criteria string) func(item interface{}) bool {
+	op := "="
+	for _, prefix := range criteriaOps {
+		if strings.HasPrefix(criteria, prefix) {
+			op, criteria = prefix, criteria[len(prefix):]
+			break
+		}
+	}
+	var match func(item interface{}) (result int, ok bool)
+	if d, err := ParseDecimal(strings.TrimSpace(criteria)); err == nil {
+		number := d.Float64()
+		match = func(item interface{}) (int, bool) {
+			value, ok := numberItem(item)
+			return compareFloat(value, number), ok
+		}
+	} else if cond, ok := parseBoolText(criteria); ok && (op == "=" || op == "<>") {
+		match = func(item interface{}) (int, bool) {
+			value, ok := item.(bool)
+			if ok && value == cond {
+				return 0, true
+			}
+			return 1, ok
+		}
+	} else if op == "=" || op == "<>" {
+		if criteria == "" {
+			return func(item interface{}) bool { return isBlank(item) == (op == "=") }
+		}
+		pattern := []rune(strings.ToLower(criteria))
+		match = func(item interface{}) (int, bool) {
+			text, ok := item.(string)
+			if ok && wildcardMatch(pattern, []rune(strings.ToLower(text))) {
+				return 0, true
+			}
+			return 1, ok
+		}
+	} else {
+		criteria = strings.ToLower(criteria)
+		match = func(item interface{}) (int, bool) {
+			// blanks are not ordered
+			text, ok := item.(string)
+			return strings.Compare(strings.ToLower(text), criteria), ok && text != ""
+		}
+	}
+	return func(item interface{}) bool {
+		result, ok := match(item)
+		if !ok {
+			// items of another type only differ
+			return op == "<>"
+		}
+		switch op {
+		case "<>":
+			return result != 0
+		case "<":
+			return result < 0
+		case "<=":
+			return result <= 0
+		case ">":
+			return result > 0
+		case ">=":
+			return result >= 0
+		default:
+			return result == 0
+		}
+	}
+}
+
+func isBlank(item interface{}) bool {
+	return item == nil || item == ""
+}
+
+func numberItem(item interface{}) (float64, bool) {
+	switch item.(type) {
+	case int, float64, Decimal:
+		value, _ := convertToFloat(item)
+		return value, true
+	default:
+		return 0, false
+	}
+}
+
+func parseBoolText(text string) (bool, bool) {
+	switch strings.ToUpper(strings.TrimSpace(text)) {
+	case "TRUE":
+		return true, true
+	case "FALSE":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// wildcardMatch matches text against a pattern where * matches any run of
+// characters, ? any single character, and ~ escapes the next character.
+func wildcardMatch(pattern, text []rune) bool {
+	// star and its text position to backtrack to
+	star, mark := -1, 0
+	p, t := 0, 0
+	for t < len(text) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, t
+			p++
+			continue
+		case p < len(pattern) && pattern[p] == '~' && p+1 < len(pattern):
+			if pattern[p+1] == text[t] {
+				p, t = p+2, t+1
+				continue
+			}
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == text[t]):
+			p, t = p+1, t+1
+			continue
+		}
+		if star < 0 {
+			return false
+		}
+		p, mark = star+1, mark+1
+		t = mark
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
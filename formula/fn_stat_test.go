@@ -0,0 +1,106 @@
+package formula
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatistics(t *testing.T) {
+	vars := map[string]interface{}{
+		"scores": []interface{}{2.0, 4.0, nil, 4.0, 4.0, 5.0, 5.0, 7.0, 9.0},
+		"names":  []interface{}{"apple", "Banana", "avocado", nil, "", 3.0, true},
+		"qty":    []interface{}{1.0, 2.0, 3.0},
+		"price":  []interface{}{10.0, 20.0, 30.0},
+		"none":   nil,
+	}
+	Convey("results", t, func() {
+		for expression, want := range map[string]interface{}{
+			"COUNT({scores}, 1, {none})":   9.0,
+			"COUNT({names}, \"a\")":        1.0,
+			"SUM(5)":                       5.0,
+			"SUM({scores}, {none})":        40.0,
+			"AVG({scores})":                5.0,
+			"MEDIAN({scores})":             4.5,
+			"MEDIAN(3, 1, 2)":              2.0,
+			"MODE({scores})":               4.0,
+			"MODE(2, 1, 1, 2)":             2.0,
+			"VARP({scores})":               4.0,
+			"STDEVP({scores})":             2.0,
+			"ROUND(VAR({scores}), 6)":      4.571429,
+			"ROUND(STDEV({scores}), 6)":    2.13809,
+			"PERCENTILE({scores}, 0.5)":    4.5,
+			"PERCENTILE({qty}, 0.25)":      1.5,
+			"PERCENTILE({qty}, 1)":         3.0,
+			"LARGE({scores}, 2)":           7.0,
+			"SMALL({scores}, 1)":           2.0,
+			"SUMPRODUCT({qty}, {price})":   140.0,
+			"SUMPRODUCT({names}, {names})": 9.0,
+			"COUNTIF({scores}, 4)":         3.0,
+			`COUNTIF({scores}, ">=5")`:     4.0,
+			`COUNTIF({scores}, "<>4")`:     6.0,
+			`COUNTIF({names}, "a*")`:       2.0,
+			`COUNTIF({names}, "?anana")`:   1.0,
+			`COUNTIF({names}, "=")`:        2.0,
+			`COUNTIF({names}, "<>")`:       5.0,
+			`COUNTIF({names}, "TRUE")`:     1.0,
+			`COUNTIF({names}, "<b")`:       2.0,
+			`SUMIF({scores}, ">4")`:        26.0,
+			`SUMIF({qty}, ">1", {price})`:  50.0,
+		} {
+			result, err := calculate(expression, vars)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, want)
+		}
+	})
+
+	Convey("errors", t, func() {
+		for expression, msg := range map[string]string{
+			"MEDIAN({none})":         "没有可计算的数值",
+			"MODE(1, 2, 3)":          "no number occurs more than once",
+			"VAR(1)":                 "a sample needs at least 2 numbers",
+			"PERCENTILE({qty}, 1.5)": "k should be between 0 and 1",
+			"LARGE({qty}, 4)":        "k should be between 1 and 3",
+			"SMALL({qty}, 0)":        "k should be between 1 and 3",
+			"LARGE(1, (10^300*10^300)-(10^300*10^300))":          "k should be between 1 and 1",
+			"SMALL({qty}, (10^300*10^300)-(10^300*10^300))":      "k should be between 1 and 3",
+			"PERCENTILE({qty}, (10^300*10^300)-(10^300*10^300))": "k should be between 0 and 1",
+			"SUMPRODUCT({qty}, {scores})":                        "arrays should have the same length",
+			"SUMIF({qty}, 1, {scores})":                          "arrays should have the same length",
+			"COUNTIF({qty}, {qty})":                              "criteria should be a number, a bool or text",
+			"MEDIAN({names})":                                    ErrArgumentType.Error(),
+		} {
+			_, err := calculate(expression, vars)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, msg)
+		}
+	})
+
+	Convey("decimal mode", t, func() {
+		for expression, want := range map[string]string{
+			"STDEV(1, 2, 3, 4)":           "1.2910",
+			"STDEVP(1, 2, 3, 4)":          "1.1180",
+			"VAR(0.1, 0.2, 0.4)":          "0.0233",
+			"VARP(1, 2)":                  "0.25",
+			"PERCENTILE({scores}, 0.33)":  "4",
+			"PERCENTILE({values}, 0.333)": "0.1333",
+		} {
+			expr, err := ParseExpr(expression)
+			So(err, ShouldBeNil)
+			result, err := Evaluate(context.Background(), expr, MapEnv{"scores": vars["scores"], "values": []interface{}{0.1, 0.2}}, WithDecimal(4, RoundHalfUp))
+			So(err, ShouldBeNil)
+			So(result, ShouldHaveSameTypeAs, Decimal{})
+			So(convertToText(result), ShouldEqual, want)
+		}
+
+		expr, _ := ParseExpr("MEDIAN(0.1, 0.2)")
+		result, err := Evaluate(context.Background(), expr, MapEnv{}, WithDecimal(4, RoundHalfUp))
+		So(err, ShouldBeNil)
+		So(convertToText(result), ShouldEqual, "0.15")
+		expr, _ = ParseExpr("SUMIF({values}, \">0.1\") + SUMPRODUCT({values}, {values})")
+		result, err = Evaluate(context.Background(), expr, MapEnv{"values": []interface{}{0.1, 0.2}}, WithDecimal(4, RoundHalfUp))
+		So(err, ShouldBeNil)
+		So(convertToText(result), ShouldEqual, "0.25")
+	})
+}
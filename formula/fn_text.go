@@ -0,0 +1,389 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// textArg returns the text argument at index, null is empty text.
+func textArg(args []interface{}, index int) (string, error) {
+	switch arg := args[index].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return arg, nil
+	default:
+		return "", argTypeError(index, "string", arg)
+	}
+}
+
+func numberArg(args []interface{}, index int) (float64, error) {
+	result, err := convertToFloat(args[index])
+	if err != nil {
+		return 0, argTypeError(index, "number", args[index])
+	}
+	return result, nil
+}
+
+// countArg returns a character count argument, truncated to an integer.
+// Counts beyond math.MaxInt are math.MaxInt, no text is that long.
+func countArg(args []interface{}, index int, defaultValue int) (int, error) {
+	if index >= len(args) {
+		return defaultValue, nil
+	}
+	result, err := numberArg(args, index)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) {
+		return 0, argError(index, errors.New("count should be a number"))
+	}
+	if result < 0 {
+		return 0, argError(index, errors.New("count should not be negative"))
+	}
+	if result >= math.MaxInt {
+		return math.MaxInt, nil
+	}
+	return int(result), nil
+}
+
+// Concat joins its arguments as text.
+type Concat int
+
+func (Concat) Valid(args []Expr) error {
+	return nil
+}
+
+func (Concat) Calculate(args []interface{}) (interface{}, error) {
+	sb := strings.Builder{}
+	for _, arg := range args {
+		sb.WriteString(convertToText(arg))
+	}
+	return sb.String(), nil
+}
+
+// Len returns the number of characters of a text.
+type Len int
+
+func (Len) Valid(args []Expr) error {
+	return nil
+}
+
+func (Len) Calculate(args []interface{}) (interface{}, error) {
+	text, err := textArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return float64(utf8.RuneCountInString(text)), nil
+}
+
+type Upper int
+
+func (Upper) Valid(args []Expr) error {
+	return nil
+}
+
+func (Upper) Calculate(args []interface{}) (interface{}, error) {
+	text, err := textArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(text), nil
+}
+
+type Lower int
+
+func (Lower) Valid(args []Expr) error {
+	return nil
+}
+
+func (Lower) Calculate(args []interface{}) (interface{}, error) {
+	text, err := textArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(text), nil
+}
+
+// Trim removes leading and trailing spaces and collapses inner runs of
+// spaces into one, like Excel.
+type Trim int
+
+func (Trim) Valid(args []Expr) error {
+	return nil
+}
+
+func (Trim) Calculate(args []interface{}) (interface{}, error) {
+	text, err := textArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Join(strings.Fields(text), " "), nil
+}
+
+// Left returns the first n (default 1) characters of a text.
+type Left int
+
+func (Left) Valid(args []Expr) error {
+	return nil
+}
+
+func (Left) Calculate(args []interface{}) (interface{}, error) {
+	text, err := textArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := countArg(args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(text)
+	return string(runes[:min(n, len(runes))]), nil
+}
+
+// Right returns the last n (default 1) characters of a text.
+type Right int
+
+func (Right) Valid(args []Expr) error {
+	return nil
+}
+
+func (Right) Calculate(args []interface{}) (interface{}, error) {
+	text, err := textArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := countArg(args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(text)
+	return string(runes[len(runes)-min(n, len(runes)):]), nil
+}
+
+// Mid returns n characters of a text starting at the 1 based position start.
+type Mid int
+
+func (Mid) Valid(args []Expr) error {
+	return nil
+}
+
+func (Mid) Calculate(args []interface{}) (interface{}, error) {
+	text, err := textArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, err := countArg(args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if start < 1 {
+		return nil, argError(1, errors.New("start should be greater than 0"))
+	}
+	n, err := countArg(args, 2, 0)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(text)
+	if start > len(runes) {
+		return "", nil
+	}
+	return string(runes[start-1 : start-1+min(n, len(runes)-start+1)]), nil
+}
+
+// Substitute replaces old with new in a text, every occurrence or only the
+// n-th one when the fourth argument is given.
+type Substitute int
+
+func (Substitute) Valid(args []Expr) error {
+	return nil
+}
+
+func (Substitute) Calculate(args []interface{}) (interface{}, error) {
+	texts := make([]string, 3)
+	for i := range texts {
+		text, err := textArg(args, i)
+		if err != nil {
+			return nil, err
+		}
+		texts[i] = text
+	}
+	text, old, replacement := texts[0], texts[1], texts[2]
+	if len(args) < 4 {
+		if old == "" {
+			return text, nil
+		}
+		return strings.ReplaceAll(text, old, replacement), nil
+	}
+	instance, err := countArg(args, 3, 0)
+	if err != nil {
+		return nil, err
+	}
+	if instance < 1 {
+		return nil, argError(3, errors.New("instance should be greater than 0"))
+	}
+	if old == "" {
+		return text, nil
+	}
+	offset := 0
+	for i := 1; ; i++ {
+		index := strings.Index(text[offset:], old)
+		if index < 0 {
+			return text, nil
+		}
+		if i == instance {
+			return text[:offset+index] + replacement + text[offset+index+len(old):], nil
+		}
+		offset += index + len(old)
+	}
+}
+
+// Text formats a number with an Excel like format such as "0.00", "#,##0",
+// "0%" or "$#,##0.00 USD".
+type Text int
+
+func (Text) Valid(args []Expr) error {
+	return nil
+}
+
+func (Text) Calculate(args []interface{}) (interface{}, error) {
+	var number interface{} = args[0]
+	if !isDecimalValue(number) {
+		f, err := numberArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		number = f
+	}
+	format, err := textArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	result, err := formatNumber(number, format)
+	if err != nil {
+		return nil, argError(1, err)
+	}
+	return result, nil
+}
+
+// formatNumber formats a float64 or a Decimal, decimals are rounded half up
+// exactly.
+func formatNumber(number interface{}, format string) (string, error) {
+	start := strings.IndexAny(format, "0#")
+	if start < 0 {
+		return "", errors.New("format has no digit placeholder")
+	}
+	end := start
+	for end < len(format) && strings.IndexByte("0#,.", format[end]) >= 0 {
+		end++
+	}
+	prefix, pattern, suffix := format[:start], format[start:end], format[end:]
+	percent := strings.Contains(prefix+suffix, "%")
+
+	intPattern, fracPattern, _ := strings.Cut(pattern, ".")
+	grouping := strings.Contains(intPattern, ",")
+	minInt := strings.Count(intPattern, "0")
+	decimals := strings.Count(fracPattern, "0") + strings.Count(fracPattern, "#")
+	minDecimals := strings.Count(fracPattern, "0")
+
+	var rounded string
+	negative := false
+	switch number := number.(type) {
+	case Decimal:
+		if percent {
+			number = number.Mul(NewDecimal(100, 0))
+		}
+		negative = number.Sign() < 0
+		rounded = number.Abs().StringFixed(decimals, RoundHalfUp)
+	case float64:
+		if percent {
+			number *= 100
+		}
+		negative = number < 0
+		rounded = strconv.FormatFloat(math.Abs(number), 'f', decimals, 64)
+	}
+	intPart, fracPart, _ := strings.Cut(rounded, ".")
+	fracPart = strings.TrimRight(fracPart, "0")
+	for len(fracPart) < minDecimals {
+		fracPart += "0"
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	for len(intPart) < minInt {
+		intPart = "0" + intPart
+	}
+	if grouping && len(intPart) > 3 {
+		sb := strings.Builder{}
+		for i, ch := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteRune(ch)
+		}
+		intPart = sb.String()
+	}
+
+	sb := strings.Builder{}
+	if negative && strings.Trim(intPart+fracPart, "0,") != "" {
+		sb.WriteByte('-')
+	}
+	sb.WriteString(prefix)
+	sb.WriteString(intPart)
+	if fracPart != "" {
+		sb.WriteByte('.')
+		sb.WriteString(fracPart)
+	}
+	sb.WriteString(suffix)
+	return sb.String(), nil
+}
+
+// Value converts a text to a number, accepting thousands separators and a
+// trailing percent sign.
+type Value int
+
+func (Value) Valid(args []Expr) error {
+	return nil
+}
+
+func (value Value) Calculate(args []interface{}) (interface{}, error) {
+	return value.CalculateContext(context.Background(), args)
+}
+
+// CalculateContext parses the text exactly in decimal mode.
+func (Value) CalculateContext(ctx context.Context, args []interface{}) (interface{}, error) {
+	if isDecimalValue(args[0]) {
+		return args[0], nil
+	}
+	if number, err := convertToFloat(args[0]); err == nil {
+		return number, nil
+	}
+	text, err := textArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.ReplaceAll(strings.TrimSpace(text), ",", "")
+	percent := strings.HasSuffix(text, "%")
+	text = strings.TrimSpace(strings.TrimSuffix(text, "%"))
+	if _, ok := decimalOptions(ctx); ok {
+		d, err := ParseDecimal(text)
+		if err != nil {
+			return nil, argError(0, fmt.Errorf("%q is not a number", args[0]))
+		}
+		if percent {
+			d = d.Quo(NewDecimal(100, 0), d.Scale()+2, RoundDown)
+		}
+		return d, nil
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, argError(0, fmt.Errorf("%q is not a number", args[0]))
+	}
+	if percent {
+		number /= 100
+	}
+	return number, nil
+}
@@ -0,0 +1,66 @@
+package formula
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestText(t *testing.T) {
+	vars := map[string]interface{}{"name": "  Ada   Lovelace ", "price": 1234.5}
+	cases := []struct {
+		expr   string
+		result interface{}
+	}{
+		{`"a\"b\\c\n"`, "a\"b\\c\n"},
+		{`"Hi, " & TRIM({name}) & "!"`, "Hi, Ada Lovelace!"},
+		{`"n" & 1 + 2`, "n3"},
+		{`"abc" < "abd" && "x" == "x"`, true},
+		{`CONCAT("a", 1, 2.5, 1 > 2)`, "a12.5FALSE"},
+		{`LEN("你好ab")`, 4.0},
+		{`UPPER("abc") & LOWER("DEF")`, "ABCdef"},
+		{`LEFT("hello", 2) & RIGHT("hello") & MID("hello", 2, 3)`, "heoell"},
+		{`LEFT("hi", 10)`, "hi"},
+		{`LEFT("hi", 10^20) & RIGHT("hi", 10^20) & MID("hello", 2, 10^20) & MID("hi", 10^20, 1)`, "hihiello"},
+		{`SUBSTITUTE("a-b", "-", "+", 10^20)`, "a-b"},
+		{`SUBSTITUTE("a-b-c", "-", "+")`, "a+b+c"},
+		{`SUBSTITUTE("a-b-c", "-", "+", 2)`, "a-b+c"},
+		{`TEXT({price}, "#,##0.00")`, "1,234.50"},
+		{`TEXT(0.256, "0.0%")`, "25.6%"},
+		{`TEXT(-3.14159, "$0.##")`, "-$3.14"},
+		{`TEXT(5, "000")`, "005"},
+		{`VALUE("1,234.5") + VALUE("50%")`, 1235.0},
+	}
+	Convey("string literals and text functions", t, func() {
+		for _, c := range cases {
+			result, err := calculate(c.expr, vars)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, c.result)
+		}
+	})
+
+	Convey("counts should be numbers", t, func() {
+		_, err := calculate(`LEFT("abc", (10^300*10^300)-(10^300*10^300))`, vars)
+		So(err, ShouldNotBeNil)
+		_, err = calculate(`MID("abc", 1, (10^300*10^300)-(10^300*10^300))`, vars)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("type errors point to the argument", t, func() {
+		_, err := calculate(`CONCAT("a") & LEFT("abc", "x")`, vars)
+		var argErr *ArgumentError
+		So(errors.As(err, &argErr), ShouldBeTrue)
+		So(errors.Is(err, ErrArgumentType), ShouldBeTrue)
+		So(argErr.Fn, ShouldEqual, "LEFT")
+		So(argErr.Index, ShouldEqual, 1)
+		So(argErr.Pos, ShouldEqual, 26)
+
+		_, err = calculate(`VALUE("abc")`, vars)
+		So(errors.As(err, &argErr), ShouldBeTrue)
+		So(argErr.Index, ShouldEqual, 0)
+
+		_, err = ParseExpr(`"abc`)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,226 @@
+package formula
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"unicode/utf8"
+)
+
+type FormatOptions struct {
+	// Compact leaves out the spaces around binary operators and after
+	// commas.
+	Compact bool
+	// LineWidth breaks the arguments of calls onto lines of their own when
+	// the call does not fit the line, zero never breaks.
+	LineWidth int
+	// Indent indents the broken arguments, two spaces when empty.
+	Indent string
+}
+
+type FormatOption func(opt *FormatOptions)
+
+func WithCompact() FormatOption {
+	return func(opt *FormatOptions) { opt.Compact = true }
+}
+
+func WithLineWidth(width int) FormatOption {
+	return func(opt *FormatOptions) { opt.LineWidth = width }
+}
+
+func WithIndent(indent string) FormatOption {
+	return func(opt *FormatOptions) { opt.Indent = indent }
+}
+
+// Format formats expr as formula source with the parentheses the precedence
+// and associativity of its operators need, numbers and strings are written
+// as spelled in the source. Parsing the result gives an expression equal
+// to expr by EqualExpr:
+//
+//	Format(x) == "(1 + 2) * 3 ^ 2" // for the x parsed from "((1+2)*(3^2))"
+func Format(expr Expr, opts ...FormatOption) string {
+	p := &printer{}
+	for _, f := range opts {
+		f(&p.opt)
+	}
+	if p.opt.Indent == "" {
+		p.opt.Indent = "  "
+	}
+	p.print(expr)
+	return p.sb.String()
+}
+
+type printer struct {
+	opt   FormatOptions
+	sb    strings.Builder
+	col   int
+	depth int
+}
+
+func (p *printer) write(s string) {
+	p.sb.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.col += utf8.RuneCountInString(s)
+	}
+}
+
+func (p *printer) print(expr Expr) {
+	switch expr := unwrapGroup(expr).(type) {
+	case *ConstExpr:
+		p.write(constText(expr))
+	case *StringExpr:
+		p.write(expr.String())
+	case *RefExpr:
+		p.write(expr.String())
+	case *UnaryExpr:
+		p.write(expr.Op.String())
+		p.operand(expr.X, needParens(expr.X, token.ILLEGAL, false))
+	case *BinaryExpr:
+		p.operand(expr.X, needParens(expr.X, expr.Op, false))
+		if p.opt.Compact {
+			p.write(expr.Op.String())
+		} else {
+			p.write(" " + expr.Op.String() + " ")
+		}
+		p.operand(expr.Y, needParens(expr.Y, expr.Op, true))
+	case *CallerExpr:
+		p.call(expr)
+	default:
+		p.write(fmt.Sprintf("%s", expr))
+	}
+}
+
+func (p *printer) operand(expr Expr, parens bool) {
+	if parens {
+		p.write("(")
+		p.print(expr)
+		p.write(")")
+	} else {
+		p.print(expr)
+	}
+}
+
+func (p *printer) call(expr *CallerExpr) {
+	broken := p.opt.LineWidth > 0 && len(expr.Args) > 0 && p.col+p.width(expr) > p.opt.LineWidth
+	p.write(expr.Name + "(")
+	if broken {
+		p.depth++
+	}
+	for i, arg := range expr.Args {
+		switch {
+		case broken:
+			p.write("\n" + strings.Repeat(p.opt.Indent, p.depth))
+		case i > 0 && !p.opt.Compact:
+			p.write(" ")
+		}
+		p.print(arg)
+		if i < len(expr.Args)-1 {
+			p.write(",")
+		}
+	}
+	if broken {
+		p.depth--
+		p.write("\n" + strings.Repeat(p.opt.Indent, p.depth))
+	}
+	p.write(")")
+}
+
+// width returns the characters of expr printed on one line.
+func (p *printer) width(expr Expr) int {
+	flat := &printer{opt: p.opt}
+	flat.opt.LineWidth = 0
+	flat.print(expr)
+	return flat.col
+}
+
+// unaryPrinted reports whether expr is printed with a leading operator, a
+// unary expression or a negative number built without the parser.
+func unaryPrinted(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *UnaryExpr:
+		return true
+	case *ConstExpr:
+		return strings.HasPrefix(constText(expr), "-")
+	default:
+		return false
+	}
+}
+
+// needParens reports whether expr needs parentheses as the left or right
+// operand of the binary operator op, or as the operand of a unary operator
+// when op is token.ILLEGAL.
+func needParens(expr Expr, op token.Token, right bool) bool {
+	expr = unwrapGroup(expr)
+	if op == token.ILLEGAL {
+		// -(1 + 2), but -2^2 is -(2^2)
+		binary, ok := expr.(*BinaryExpr)
+		return ok && precedence(binary.Op) <= unaryPrecedence || unaryPrinted(expr)
+	}
+	if unaryPrinted(expr) {
+		// (-2)^2, while 2^-2 and -2 * 3 read as written
+		return !right && precedence(op) > unaryPrecedence
+	}
+	binary, ok := expr.(*BinaryExpr)
+	if !ok {
+		return false
+	}
+	inner, outer := precedence(binary.Op), precedence(op)
+	return inner < outer || inner == outer && right != isRightAssociative(op)
+}
+
+// constText returns the number as spelled in the source.
+func constText(expr *ConstExpr) string {
+	if expr.Src != "" {
+		return expr.Src
+	}
+	return expr.String()
+}
+
+func unwrapGroup(expr Expr) Expr {
+	for {
+		grp, ok := expr.(*GroupExpr)
+		if !ok {
+			return expr
+		}
+		expr = grp.Expr
+	}
+}
+
+// EqualExpr reports whether x and y have the same structure: the same
+// operators, values, references and calls, regardless of their positions,
+// parentheses and spelling.
+func EqualExpr(x, y Expr) bool {
+	x, y = unwrapGroup(x), unwrapGroup(y)
+	switch x := x.(type) {
+	case *ConstExpr:
+		y, ok := y.(*ConstExpr)
+		return ok && x.Value == y.Value
+	case *StringExpr:
+		y, ok := y.(*StringExpr)
+		return ok && x.Value == y.Value
+	case *RefExpr:
+		y, ok := y.(*RefExpr)
+		return ok && x.Name == y.Name
+	case *UnaryExpr:
+		y, ok := y.(*UnaryExpr)
+		return ok && x.Op == y.Op && EqualExpr(x.X, y.X)
+	case *BinaryExpr:
+		y, ok := y.(*BinaryExpr)
+		return ok && x.Op == y.Op && EqualExpr(x.X, y.X) && EqualExpr(x.Y, y.Y)
+	case *CallerExpr:
+		y, ok := y.(*CallerExpr)
+		if !ok || !strings.EqualFold(x.Name, y.Name) || len(x.Args) != len(y.Args) {
+			return false
+		}
+		for i := range x.Args {
+			if !EqualExpr(x.Args[i], y.Args[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return x == y
+	}
+}
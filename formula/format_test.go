@@ -0,0 +1,119 @@
+package formula
+
+import (
+	"fmt"
+	"go/token"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFormat(t *testing.T) {
+	parse := func(expression string) Expr {
+		expr, err := ParseExpr(expression)
+		So(err, ShouldBeNil)
+		return expr
+	}
+
+	Convey("minimal parentheses", t, func() {
+		for expression, want := range map[string]string{
+			"((1+2)*(3^2))":                "(1 + 2) * 3 ^ 2",
+			"1 - (2 - 3)":                  "1 - (2 - 3)",
+			"(1 - 2) - 3":                  "1 - 2 - 3",
+			"2^(3^2)":                      "2 ^ 3 ^ 2",
+			"(2^3)^2":                      "(2 ^ 3) ^ 2",
+			"(-2)^2":                       "(-2) ^ 2",
+			"-(2^2)":                       "-2 ^ 2",
+			"-(1+2)":                       "-(1 + 2)",
+			"2^-1 + 2 * -3":                "2 ^ -1 + 2 * -3",
+			"!(1 > 2) && (1 || 0)":         "!(1 > 2) && (1 || 0)",
+			"1 + (2 & 3)":                  "1 + (2 & 3)",
+			"(1 + 2) & 3":                  "1 + 2 & 3",
+			"((1))":                        "1",
+			"1.50 + 0.000000001":           "1.50 + 0.000000001",
+			`"a\"b" & {x} & { a.b[0] }`:    `"a\"b" & {x} & {a.b[0]}`,
+			"sum( 1 ,(2) ) / count(1,2,3)": "SUM(1, 2) / COUNT(1, 2, 3)",
+			"PI()":                         "PI()",
+		} {
+			So(Format(parse(expression)), ShouldEqual, want)
+		}
+	})
+
+	Convey("options", t, func() {
+		So(Format(parse("(1 + 2) * -3 >= SUM(1, 2)"), WithCompact()), ShouldEqual, "(1+2)*-3>=SUM(1,2)")
+
+		expr := parse(`IF({price} > 100, SUM({a}, {b}, {c}), CONCAT("long text", {name}))`)
+		So(Format(expr, WithLineWidth(80)), ShouldEqual, `IF({price} > 100, SUM({a}, {b}, {c}), CONCAT("long text", {name}))`)
+		So(Format(expr, WithLineWidth(30), WithIndent("\t")), ShouldEqual, "IF(\n"+
+			"\t{price} > 100,\n"+
+			"\tSUM({a}, {b}, {c}),\n"+
+			"\tCONCAT(\"long text\", {name})\n"+
+			")")
+		So(Format(parse(`1 + IF(1, CONCAT("aaaaaaaaaa", "bbbbbbbbbb"), 2)`), WithLineWidth(20)), ShouldEqual, "1 + IF(\n"+
+			"  1,\n"+
+			"  CONCAT(\n"+
+			"    \"aaaaaaaaaa\",\n"+
+			"    \"bbbbbbbbbb\"\n"+
+			"  ),\n"+
+			"  2\n"+
+			")")
+	})
+
+	Convey("expressions built without the parser", t, func() {
+		So(Format(&ConstExpr{Value: 1e-9}), ShouldEqual, "0.000000001")
+		So(fmt.Sprint(&ConstExpr{Value: 1e-9, Src: "1.0e-9"}), ShouldEqual, "0.000000001")
+		So(Format(&BinaryExpr{X: &ConstExpr{Value: -2}, Op: token.XOR, Y: &ConstExpr{Value: 2}}), ShouldEqual, "(-2) ^ 2")
+		So(Format(&UnaryExpr{Op: token.SUB, X: &ConstExpr{Value: -2}}), ShouldEqual, "-(-2)")
+		So(Format(&StringExpr{Value: "say \"hi\"\n"}), ShouldEqual, `"say \"hi\"\n"`)
+	})
+
+	Convey("round trips", t, func() {
+		ops := []token.Token{token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.XOR, token.AND,
+			token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR}
+		spellings := []string{"0", "7", "1.5", "2.50", "0.001", "10"}
+		rnd := rand.New(rand.NewSource(1))
+		var gen func(depth int) Expr
+		gen = func(depth int) Expr {
+			var expr Expr
+			switch n := rnd.Intn(10); {
+			case depth == 0 || n < 2:
+				src := spellings[rnd.Intn(len(spellings))]
+				value, _ := strconv.ParseFloat(src, 64)
+				expr = &ConstExpr{Value: value, Src: src}
+			case n == 2:
+				expr = &StringExpr{Value: "a\"b"}
+			case n == 3:
+				expr = &RefExpr{Name: []string{"x", "order.items[0].price"}[rnd.Intn(2)]}
+			case n == 4:
+				expr = &UnaryExpr{Op: []token.Token{token.NOT, token.ADD, token.SUB}[rnd.Intn(3)], X: gen(depth - 1)}
+			case n == 5:
+				call := &CallerExpr{Name: []string{"CONCAT", "COUNT"}[rnd.Intn(2)]}
+				for i := rnd.Intn(3); i >= 0; i-- {
+					call.Args = append(call.Args, gen(depth-1))
+				}
+				expr = call
+			default:
+				expr = &BinaryExpr{X: gen(depth - 1), Op: ops[rnd.Intn(len(ops))], Y: gen(depth - 1)}
+			}
+			if rnd.Intn(4) == 0 {
+				expr = &GroupExpr{Expr: expr}
+			}
+			return expr
+		}
+		options := [][]FormatOption{nil, {WithCompact()}, {WithLineWidth(16)}}
+		for i := 0; i < 2000; i++ {
+			expr := gen(6)
+			for _, opts := range options {
+				text := Format(expr, opts...)
+				parsed, err := ParseExpr(text)
+				So(err, ShouldBeNil)
+				if !EqualExpr(parsed, expr) {
+					So(fmt.Sprint(parsed), ShouldEqual, fmt.Sprint(expr))
+				}
+				So(Format(parsed, opts...), ShouldEqual, text)
+			}
+		}
+	})
+}
@@ -1,8 +1,91 @@
 package formula
 
 func init() {
-	Register(Min(1))
-	Register(Max(1))
-	Register(Avg(1))
-	Register(Sum(1))
+	number, text, cond := TypeNumber, TypeString, TypeBool|TypeNumber
+	numbers := TypeNumber | ArrayOf(TypeNumber)
+	date, dates := TypeDate|TypeString, TypeDate|TypeString|TypeArray
+	builtins := []struct {
+		name string
+		fn   Function
+		sig  Signature
+	}{
+		{"MIN", Min(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"MAX", Max(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"AVG", Avg(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"SUM", Sum(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"IF", If(1), Signature{Params: []Type{cond, TypeAny, TypeAny}, Optional: 1, Result: TypeAny}},
+		{"IFS", Ifs(1), Signature{Params: []Type{cond, TypeAny}, Variadic: true, Result: TypeAny}},
+		{"LET", Let(1), Signature{Params: []Type{TypeAny, TypeAny, TypeAny}, Variadic: true, Result: TypeAny}},
+		{"SWITCH", Switch(1), Signature{Params: []Type{TypeAny, TypeAny, TypeAny}, Variadic: true, Result: TypeAny}},
+		{"CONCAT", Concat(1), Signature{Params: []Type{TypeAny}, Variadic: true, Result: text}},
+		{"LEN", Len(1), Signature{Params: []Type{text}, Result: number}},
+		{"UPPER", Upper(1), Signature{Params: []Type{text}, Result: text}},
+		{"LOWER", Lower(1), Signature{Params: []Type{text}, Result: text}},
+		{"TRIM", Trim(1), Signature{Params: []Type{text}, Result: text}},
+		{"LEFT", Left(1), Signature{Params: []Type{text, number}, Optional: 1, Result: text}},
+		{"RIGHT", Right(1), Signature{Params: []Type{text, number}, Optional: 1, Result: text}},
+		{"MID", Mid(1), Signature{Params: []Type{text, number, number}, Result: text}},
+		{"SUBSTITUTE", Substitute(1), Signature{Params: []Type{text, text, text, number}, Optional: 1, Result: text}},
+		{"TEXT", Text(1), Signature{Params: []Type{number, text}, Result: text}},
+		{"VALUE", Value(1), Signature{Params: []Type{text | number}, Result: number}},
+		{"COUNT", Count(1), Signature{Params: []Type{TypeAny}, Variadic: true, Result: number}},
+		{"MEDIAN", Median(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"MODE", Mode(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"VAR", Var(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"VARP", VarP(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"STDEV", Stdev(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"STDEVP", StdevP(1), Signature{Params: []Type{numbers}, Variadic: true, Result: number}},
+		{"PERCENTILE", Percentile(1), Signature{Params: []Type{numbers, number}, Result: number}},
+		{"LARGE", Large(1), Signature{Params: []Type{numbers, number}, Result: number}},
+		{"SMALL", Small(1), Signature{Params: []Type{numbers, number}, Result: number}},
+		{"SUMPRODUCT", SumProduct(1), Signature{Params: []Type{TypeAny}, Variadic: true, Result: number}},
+		{"COUNTIF", CountIf(1), Signature{Params: []Type{TypeAny, TypeAny}, Result: number}},
+		{"SUMIF", SumIf(1), Signature{Params: []Type{TypeAny, TypeAny, TypeAny}, Optional: 1, Result: number}},
+		{"ABS", Abs(1), Signature{Params: []Type{number}, Result: number}},
+		{"ROUND", Round(1), Signature{Params: []Type{number, number}, Result: number}},
+		{"ROUNDUP", Roundup(1), Signature{Params: []Type{number, number}, Result: number}},
+		{"ROUNDDOWN", Rounddown(1), Signature{Params: []Type{number, number}, Result: number}},
+		{"TRUNC", Trunc(1), Signature{Params: []Type{number, number}, Optional: 1, Result: number}},
+		{"FLOOR", Floor(1), Signature{Params: []Type{number, number}, Optional: 1, Result: number}},
+		{"CEIL", Ceil(1), Signature{Params: []Type{number, number}, Optional: 1, Result: number}},
+		{"CEILING", Ceil(1), Signature{Params: []Type{number, number}, Optional: 1, Result: number}},
+		{"MOD", Mod(1), Signature{Params: []Type{number, number}, Result: number}},
+		{"SIGN", Sign(1), Signature{Params: []Type{number}, Result: number}},
+		{"POW", Pow(1), Signature{Params: []Type{number, number}, Result: number}},
+		{"POWER", Pow(1), Signature{Params: []Type{number, number}, Result: number}},
+		{"SQRT", Sqrt(1), Signature{Params: []Type{number}, Result: number}},
+		{"EXP", Exp(1), Signature{Params: []Type{number}, Result: number}},
+		{"LN", Ln(1), Signature{Params: []Type{number}, Result: number}},
+		{"LOG10", Log10(1), Signature{Params: []Type{number}, Result: number}},
+		{"PI", Pi(1), Signature{Result: number}},
+		{"SIN", Sin(1), Signature{Params: []Type{number}, Result: number}},
+		{"COS", Cos(1), Signature{Params: []Type{number}, Result: number}},
+		{"TAN", Tan(1), Signature{Params: []Type{number}, Result: number}},
+		{"ASIN", Asin(1), Signature{Params: []Type{number}, Result: number}},
+		{"ACOS", Acos(1), Signature{Params: []Type{number}, Result: number}},
+		{"ATAN", Atan(1), Signature{Params: []Type{number}, Result: number}},
+		{"ATAN2", Atan2(1), Signature{Params: []Type{number, number}, Result: number}},
+		{"DEGREES", Degrees(1), Signature{Params: []Type{number}, Result: number}},
+		{"RADIANS", Radians(1), Signature{Params: []Type{number}, Result: number}},
+		{"NOW", Now(1), Signature{Result: TypeDate}},
+		{"TODAY", Today(1), Signature{Result: TypeDate}},
+		{"DATE", Date(1), Signature{Params: []Type{number, number, number}, Result: TypeDate}},
+		{"DATEDIFF", DateDiff(1), Signature{Params: []Type{date, date, text}, Result: number}},
+		{"DATEADD", DateAdd(1), Signature{Params: []Type{date, number, text}, Result: TypeDate}},
+		{"YEAR", Year(1), Signature{Params: []Type{date}, Result: number}},
+		{"MONTH", Month(1), Signature{Params: []Type{date}, Result: number}},
+		{"DAY", Day(1), Signature{Params: []Type{date}, Result: number}},
+		{"WEEKDAY", Weekday(1), Signature{Params: []Type{date, number}, Optional: 1, Result: number}},
+		{"WORKDAY", Workday(1), Signature{Params: []Type{date, number, dates}, Optional: 1, Result: TypeDate}},
+	}
+	// the other built-in functions only depend on their arguments and the
+	// evaluation options
+	impure := map[string]bool{"NOW": true, "TODAY": true}
+	for _, builtin := range builtins {
+		builtin.sig.Pure = !impure[builtin.name]
+		if err := DefaultRegistry.Register(builtin.name, builtin.fn, builtin.sig); err != nil {
+			panic(err)
+		}
+		DefaultRegistry.SetDoc(builtin.name, builtinDocs[builtin.name])
+	}
 }
@@ -0,0 +1,161 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+)
+
+// Limit is a resource limit of parsing or evaluating a formula.
+type Limit int
+
+const (
+	// LimitLength is the number of characters of the source.
+	LimitLength Limit = iota + 1
+	// LimitDepth is the nesting depth of parentheses and calls.
+	LimitDepth
+	// LimitNodes is the number of operands, operators and calls.
+	LimitNodes
+	// LimitOperations is the number of operators and calls evaluated.
+	LimitOperations
+	// LimitCallDepth is the number of nested calls of user functions.
+	LimitCallDepth
+)
+
+func (limit Limit) String() string {
+	switch limit {
+	case LimitLength:
+		return "length"
+	case LimitDepth:
+		return "depth"
+	case LimitNodes:
+		return "nodes"
+	case LimitOperations:
+		return "operations"
+	case LimitCallDepth:
+		return "call depth"
+	default:
+		return fmt.Sprintf("Limit(%d)", int(limit))
+	}
+}
+
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// LimitError reports a formula exceeding a limit, it matches
+// ErrLimitExceeded with errors.Is. Evaluations canceled through their
+// context fail with the error of the context instead, context.Canceled or
+// context.DeadlineExceeded.
+type LimitError struct {
+	Limit Limit
+	Max   int
+	// Pos is where the formula exceeds the limit, for the call depth the
+	// call of the formula evaluated.
+	Pos token.Pos
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s over %d,pos:%v", ErrLimitExceeded, err.Limit, err.Max, err.Pos)
+}
+
+func (err *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// ParseLimits bound the formulas accepted by ParseExpr, zero is unlimited.
+// A formula over a limit fails with a *LimitError, without diagnostics.
+type ParseLimits struct {
+	MaxLength int
+	MaxDepth  int
+	MaxNodes  int
+}
+
+// WithParseLimits bounds the formulas parsed, e.g. the ones authored by users.
+func WithParseLimits(limits ParseLimits) ParseOption {
+	return func(opt *ParseOptions) { opt.Limits = limits }
+}
+
+// WithMaxOperations fails the evaluation with a *LimitError after n
+// operators and calls, zero is unlimited. The limit and the cancellation of
+// the context are checked before each operation: a call of a function is one
+// operation whatever the function does. The built-in functions bound their
+// own work by the size of their arguments, e.g. WORKDAY rejects counts of
+// days beyond year 9999 and decimals have at most 4096 digits, functions
+// registered by the application should do the same or watch the context.
+func WithMaxOperations(n int) EvalOption {
+	return func(opt *EvalOptions) { opt.MaxOperations = n }
+}
+
+// DefaultMaxCallDepth bounds the nested calls of user functions when the
+// evaluation sets no bound, recursion would otherwise overflow the stack.
+const DefaultMaxCallDepth = 256
+
+// WithMaxCallDepth fails the evaluation with a *LimitError when user
+// functions, see Registry.Define, nest deeper than n calls. Zero is
+// DefaultMaxCallDepth.
+func WithMaxCallDepth(n int) EvalOption {
+	return func(opt *EvalOptions) { opt.MaxCallDepth = n }
+}
+
+// exceed stops the parser at pos, the scanner delivers the end of input from
+// then on.
+func (parser *Parser) exceed(limit Limit, max int, pos token.Pos) {
+	if parser.limit == nil {
+		parser.limit = &LimitError{Limit: limit, Max: max, Pos: pos}
+	}
+}
+
+// node counts a node of the AST starting at pos.
+func (parser *Parser) node(pos token.Pos) {
+	parser.nodes++
+	if max := parser.opt.Limits.MaxNodes; max > 0 && parser.nodes > max {
+		parser.exceed(LimitNodes, max, pos)
+	}
+}
+
+// nest enters a group of parentheses or arguments opened at pos, the caller
+// leaves it by decrementing depth.
+func (parser *Parser) nest(pos token.Pos) {
+	parser.depth++
+	if max := parser.opt.Limits.MaxDepth; max > 0 && parser.depth > max {
+		parser.exceed(LimitDepth, max, pos)
+	}
+}
+
+// step counts an operation of expr, checking the limit of operations and
+// the cancellation of ctx. The functions called are not interrupted, see
+// WithMaxOperations.
+func step(ctx context.Context, expr Expr) error {
+	if ev := evaluationFrom(ctx); ev != nil && ev.opt.MaxOperations > 0 {
+		ev.ops++
+		if ev.ops > ev.opt.MaxOperations {
+			return &LimitError{Limit: LimitOperations, Max: ev.opt.MaxOperations, Pos: expr.Pos()}
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+func (m *machine) step(expr Expr) error {
+	if max := m.opt.MaxOperations; max > 0 {
+		ops := &m.ops
+		if m.ev != nil {
+			// functions evaluating their arguments count there as well
+			ops = &m.ev.ops
+		}
+		*ops++
+		if *ops > max {
+			return &LimitError{Limit: LimitOperations, Max: max, Pos: expr.Pos()}
+		}
+	}
+	select {
+	case <-m.done:
+		return m.ctx.Err()
+	default:
+		return nil
+	}
+}
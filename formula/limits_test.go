@@ -0,0 +1,97 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimits(t *testing.T) {
+	limitOf := func(err error) *LimitError {
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			return nil
+		}
+		return limitErr
+	}
+
+	Convey("parse limits", t, func() {
+		deep := strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000)
+		for _, c := range []struct {
+			expr   string
+			limits ParseLimits
+			limit  Limit
+			pos    token.Pos
+		}{
+			{"1 + 2 + 3", ParseLimits{MaxLength: 8}, LimitLength, 8},
+			{deep, ParseLimits{MaxDepth: 32}, LimitDepth, 32},
+			{"ABS(ABS(ABS(-1)))", ParseLimits{MaxDepth: 2}, LimitDepth, 11},
+			{"1 + 2 + 3", ParseLimits{MaxNodes: 4}, LimitNodes, 8},
+			{"SUM({a}, -{b})", ParseLimits{MaxNodes: 3}, LimitNodes, 10},
+		} {
+			_, err := ParseExpr(c.expr, WithParseLimits(c.limits))
+			So(errors.Is(err, ErrLimitExceeded), ShouldBeTrue)
+			limitErr := limitOf(err)
+			So(limitErr, ShouldNotBeNil)
+			So(limitErr.Limit, ShouldEqual, c.limit)
+			So(limitErr.Pos, ShouldEqual, c.pos)
+		}
+
+		limits := WithParseLimits(ParseLimits{MaxLength: 17, MaxDepth: 3, MaxNodes: 6})
+		_, err := ParseExpr("ABS(ABS(ABS(-1)))", limits)
+		So(err, ShouldBeNil)
+		_, err = ParseExpr("1 +", limits)
+		So(limitOf(err), ShouldBeNil)
+	})
+
+	Convey("evaluation limits", t, func() {
+		for expression, pos := range map[string]token.Pos{
+			"1 + 2 * 3":         4,
+			"IF(1, -1, 0)":      6,
+			"SUM(1, ABS(-1))":   7,
+			"1 > 0 && !(1 > 2)": 0,
+		} {
+			expr, err := ParseExpr(expression)
+			So(err, ShouldBeNil)
+			program, err := Compile(expr)
+			So(err, ShouldBeNil)
+
+			_, err = Evaluate(context.Background(), expr, MapEnv{}, WithMaxOperations(1))
+			So(limitOf(err), ShouldResemble, &LimitError{Limit: LimitOperations, Max: 1, Pos: pos})
+			_, err = program.Eval(context.Background(), MapEnv{}, WithMaxOperations(1))
+			So(limitOf(err), ShouldResemble, &LimitError{Limit: LimitOperations, Max: 1, Pos: pos})
+
+			_, err = Evaluate(context.Background(), expr, MapEnv{}, WithMaxOperations(4))
+			So(err, ShouldBeNil)
+			_, err = program.Eval(context.Background(), MapEnv{}, WithMaxOperations(4))
+			So(err, ShouldBeNil)
+		}
+
+		_, err := calculate("1 / 0", nil)
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, ErrLimitExceeded), ShouldBeFalse)
+	})
+
+	Convey("cancellation", t, func() {
+		expr, _ := ParseExpr("SUM({x}, 1) * 2")
+		program, _ := Compile(expr)
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+		expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		for ctx, want := range map[context.Context]error{canceled: context.Canceled, expired: context.DeadlineExceeded} {
+			_, err := Evaluate(ctx, expr, MapEnv{"x": 1.0})
+			So(errors.Is(err, want), ShouldBeTrue)
+			_, err = program.Eval(ctx, MapEnv{"x": 1.0})
+			So(errors.Is(err, want), ShouldBeTrue)
+			_, err = program.Eval(ctx, MapEnv{"x": 1.0}, WithDecimal(2, RoundHalfUp))
+			So(errors.Is(err, want), ShouldBeTrue)
+			So(errors.Is(err, ErrLimitExceeded), ShouldBeFalse)
+		}
+	})
+}
@@ -0,0 +1,395 @@
+package formula
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Rule is a kind of rewrite applied by Optimize.
+type Rule int
+
+const (
+	// RuleFold replaces a constant subexpression by its value, e.g.
+	// MAX(3, 5) by 5.
+	RuleFold Rule = iota + 1
+	// RuleIdentity drops an operation leaving its operand as it is, e.g.
+	// 0 + {y}.
+	RuleIdentity
+	// RuleGroup drops redundant parentheses, e.g. ((1 + 2)) * 3.
+	RuleGroup
+)
+
+func (rule Rule) String() string {
+	switch rule {
+	case RuleFold:
+		return "fold"
+	case RuleIdentity:
+		return "identity"
+	case RuleGroup:
+		return "group"
+	default:
+		return fmt.Sprintf("Rule(%d)", int(rule))
+	}
+}
+
+// Rewrite is a rewrite applied by Optimize. Pos and End are the position
+// of the rewritten expression in the source, Before and After the
+// expression before and after the rewrite, formatted compactly.
+type Rewrite struct {
+	Rule   Rule
+	Pos    token.Pos
+	End    token.Pos
+	Before string
+	After  string
+}
+
+type OptimizeOptions struct {
+	// Eval are the options the optimized expression is evaluated with.
+	Eval []EvalOption
+	// Types are the declared types of the variables, they are trusted.
+	Types VarTypes
+}
+
+type OptimizeOption func(opt *OptimizeOptions)
+
+// WithEvalOptions folds constants as evaluated with opts, e.g. WithDecimal.
+func WithEvalOptions(opts ...EvalOption) OptimizeOption {
+	return func(opt *OptimizeOptions) { opt.Eval = append(opt.Eval, opts...) }
+}
+
+// WithVarTypes declares the types of the variables, like Check does, so
+// that e.g. 0 + {y} drops the addition for a number y.
+func WithVarTypes(types VarTypes) OptimizeOption {
+	return func(opt *OptimizeOptions) { opt.Types = types }
+}
+
+// Optimize simplifies expr, e.g. one generated by a tool, and returns the
+// simplified expression with the rewrites applied in order. expr is left
+// unchanged. Optimize
+//
+//   - folds the subexpressions without variables, including the calls of
+//     pure functions, whose value is a number or a string. Subexpressions
+//     failing to evaluate are kept, so that they fail at evaluation.
+//   - drops the identities x * 1, 1 * x, x + 0, 0 + x, x - 0, x / 1, x ^ 1,
+//     +x, --x and the concatenation of text with "". An operand that may
+//     not be a number becomes +x, which converts it like the operation did:
+//     {x} * 1 becomes +{x} and still fails for a text x. Dates are added
+//     days to, so x + 0 and x - 0 are only dropped when x is known not to
+//     be a date, see WithVarTypes.
+//   - drops the parentheses the precedence does not need, the groups the
+//     parser wraps a formula and the arguments of calls in are not reported.
+//
+// The result evaluates like expr as long as it is evaluated with the same
+// options, since the folded values depend on them: 0.1 + 0.2 folds to
+// 0.30000000000000004, but to 0.3 with WithDecimal.
+func Optimize(expr Expr, opts ...OptimizeOption) (Expr, []Rewrite) {
+	o := &optimizer{}
+	for _, f := range opts {
+		f(&o.opt)
+	}
+	var eval EvalOptions
+	for _, f := range o.opt.Eval {
+		f(&eval)
+	}
+	o.decimal = eval.Decimal != nil
+	if grp, ok := expr.(*GroupExpr); ok {
+		expr = grp.Expr
+	}
+	return o.operand(expr, token.ILLEGAL, false, false), o.rewrites
+}
+
+type optimizer struct {
+	opt      OptimizeOptions
+	decimal  bool
+	rewrites []Rewrite
+}
+
+func (o *optimizer) rewrite(rule Rule, pos, end token.Pos, before, after string) {
+	o.rewrites = append(o.rewrites, Rewrite{Rule: rule, Pos: pos, End: end, Before: before, After: after})
+}
+
+// operand optimizes an operand of the binary operator op, the operand of
+// a unary operator when unary, or an expression on its own when op is
+// token.ILLEGAL. Its redundant parentheses are dropped.
+func (o *optimizer) operand(expr Expr, op token.Token, right, unary bool) Expr {
+	inner := unwrapGroup(expr)
+	if inner != expr {
+		levels := 0
+		for grp, ok := expr.(*GroupExpr); ok; grp, ok = grp.Expr.(*GroupExpr) {
+			levels++
+		}
+		needed := 0
+		if unary || op != token.ILLEGAL {
+			if needParens(inner, op, right) {
+				needed = 1
+			}
+		}
+		if levels > needed {
+			text := Format(inner, WithCompact())
+			o.rewrite(RuleGroup, inner.Pos(), inner.End(),
+				strings.Repeat("(", levels)+text+strings.Repeat(")", levels),
+				strings.Repeat("(", needed)+text+strings.Repeat(")", needed))
+		}
+	}
+	return o.optimize(inner)
+}
+
+func (o *optimizer) optimize(expr Expr) Expr {
+	pos, end := expr.Pos(), expr.End()
+	switch expr := expr.(type) {
+	case *UnaryExpr:
+		unary := *expr
+		unary.X = o.operand(expr.X, token.ILLEGAL, false, true)
+		if result, ok := o.fold(&unary, pos, end); ok {
+			return result
+		}
+		return o.unaryIdentity(&unary, pos, end)
+	case *BinaryExpr:
+		binary := *expr
+		binary.X = o.operand(expr.X, expr.Op, false, false)
+		binary.Y = o.operand(expr.Y, expr.Op, true, false)
+		if result, ok := o.fold(&binary, pos, end); ok {
+			return result
+		}
+		return o.binaryIdentity(&binary, pos, end)
+	case *CallerExpr:
+		call := *expr
+		if types := o.opt.Types; len(types) > 0 && isLet(expr) {
+			// the names bound by LET hide the declared variables
+			defer func() { o.opt.Types = types }()
+			o.opt.Types = make(VarTypes, len(types))
+			for name, typ := range types {
+				o.opt.Types[name] = typ
+			}
+			for i := 0; i < len(expr.Args)-1; i += 2 {
+				if name, err := bindingName(expr.Args[i]); err == nil {
+					delete(o.opt.Types, name)
+				}
+			}
+		}
+		call.Args = make([]Expr, len(expr.Args))
+		for i, arg := range expr.Args {
+			// the group the parser wraps an argument in is not reported
+			if grp, ok := arg.(*GroupExpr); ok {
+				arg = grp.Expr
+			}
+			call.Args[i] = o.operand(arg, token.ILLEGAL, false, false)
+		}
+		if result, ok := o.fold(&call, pos, end); ok {
+			return result
+		}
+		return &call
+	default:
+		return expr
+	}
+}
+
+// fold evaluates expr when its operands are literals, and returns its value
+// as a literal.
+func (o *optimizer) fold(expr Expr, pos, end token.Pos) (Expr, bool) {
+	var operands []Expr
+	switch expr := expr.(type) {
+	case *UnaryExpr:
+		if isLiteral(expr) {
+			return nil, false
+		}
+		operands = []Expr{expr.X}
+	case *BinaryExpr:
+		operands = []Expr{expr.X, expr.Y}
+	case *CallerExpr:
+		def := expr.def
+		if def == nil {
+			def, _ = DefaultRegistry.Lookup(expr.Name)
+		}
+		if def == nil || !def.Signature.Pure {
+			return nil, false
+		}
+		operands = expr.Args
+	}
+	for _, operand := range operands {
+		if !isLiteral(operand) {
+			return nil, false
+		}
+	}
+	// folding is not an operation of the evaluation
+	opts := append(append([]EvalOption(nil), o.opt.Eval...), WithMaxOperations(0))
+	value, err := Evaluate(context.Background(), expr, nil, opts...)
+	if err != nil {
+		return nil, false
+	}
+	result, ok := o.literal(value, pos)
+	if !ok {
+		return nil, false
+	}
+	o.rewrite(RuleFold, pos, end, Format(expr, WithCompact()), Format(result, WithCompact()))
+	return result, true
+}
+
+// isLiteral reports whether expr is a number or a string, numbers may be
+// negated.
+func isLiteral(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *ConstExpr, *StringExpr:
+		return true
+	case *UnaryExpr:
+		_, ok := expr.X.(*ConstExpr)
+		return ok && expr.Op == token.SUB
+	default:
+		return false
+	}
+}
+
+// literal returns the literal evaluating to value. Numbers are only
+// literals of the mode they are computed in, a literal evaluates to a
+// float64 or to a Decimal depending on the options.
+func (o *optimizer) literal(value interface{}, pos token.Pos) (Expr, bool) {
+	var number *ConstExpr
+	negative := false
+	switch value := value.(type) {
+	case string:
+		return &StringExpr{Position: pos, Value: value}, true
+	case float64:
+		if o.decimal {
+			return nil, false
+		}
+		negative = math.Signbit(value)
+		value = math.Abs(value)
+		number = &ConstExpr{Value: value, Src: strconv.FormatFloat(value, 'f', -1, 64)}
+	case Decimal:
+		if !o.decimal {
+			return nil, false
+		}
+		negative = value.Sign() < 0
+		value = value.Abs()
+		number = &ConstExpr{Value: value.Float64(), Src: value.String()}
+	default:
+		return nil, false
+	}
+	if !negative {
+		number.Position = pos
+		return number, true
+	}
+	number.Position = pos + 1
+	return &UnaryExpr{Position: pos, Op: token.SUB, X: number}, true
+}
+
+func (o *optimizer) unaryIdentity(expr *UnaryExpr, pos, end token.Pos) Expr {
+	var result Expr
+	switch x := expr.X.(type) {
+	case *UnaryExpr:
+		switch {
+		case expr.Op == token.ADD && x.Op != token.NOT:
+			result = x
+		case expr.Op == token.SUB && x.Op == token.SUB:
+			result = o.number(x.X, pos)
+		}
+	default:
+		if expr.Op == token.ADD && isNumber(x) {
+			result = x
+		}
+	}
+	if result == nil {
+		return expr
+	}
+	o.rewrite(RuleIdentity, pos, end, Format(expr, WithCompact()), Format(result, WithCompact()))
+	return result
+}
+
+func (o *optimizer) binaryIdentity(expr *BinaryExpr, pos, end token.Pos) Expr {
+	var result Expr
+	switch expr.Op {
+	case token.ADD:
+		if o.isConst(expr.X, 0) && !o.mayBeDate(expr.Y) {
+			result = o.number(expr.Y, pos)
+		} else if o.isConst(expr.Y, 0) && !o.mayBeDate(expr.X) {
+			result = o.number(expr.X, pos)
+		}
+	case token.MUL:
+		if o.isConst(expr.X, 1) {
+			result = o.number(expr.Y, pos)
+		} else if o.isConst(expr.Y, 1) {
+			result = o.number(expr.X, pos)
+		}
+	case token.SUB:
+		if o.isConst(expr.Y, 0) && !o.mayBeDate(expr.X) {
+			result = o.number(expr.X, pos)
+		}
+	case token.QUO, token.XOR:
+		// decimal quotients and powers are rounded to the scale
+		if !o.decimal && o.isConst(expr.Y, 1) {
+			result = o.number(expr.X, pos)
+		}
+	case token.AND:
+		if isEmptyString(expr.X) && isString(expr.Y) {
+			result = expr.Y
+		} else if isEmptyString(expr.Y) && isString(expr.X) {
+			result = expr.X
+		}
+	}
+	if result == nil {
+		return expr
+	}
+	o.rewrite(RuleIdentity, pos, end, Format(expr, WithCompact()), Format(result, WithCompact()))
+	return result
+}
+
+// isConst reports whether expr is the number value. A decimal
+// literal with fraction digits, like 1.0, is not an identity, it changes
+// the scale of the result.
+func (o *optimizer) isConst(expr Expr, value float64) bool {
+	number, ok := expr.(*ConstExpr)
+	if !ok || number.Value != value {
+		return false
+	}
+	return !o.decimal || !strings.ContainsAny(number.Src, ".eE")
+}
+
+// mayBeDate reports whether expr may evaluate to a date, by its type.
+func (o *optimizer) mayBeDate(expr Expr) bool {
+	c := &checker{types: o.opt.Types}
+	return c.check(expr)&TypeDate != 0
+}
+
+// number returns expr converted to a number, as arithmetic converts it.
+func (o *optimizer) number(expr Expr, pos token.Pos) Expr {
+	if isNumber(expr) {
+		return expr
+	}
+	return &UnaryExpr{Position: pos, Op: token.ADD, X: expr}
+}
+
+// isNumber reports whether expr evaluates to a number or null of the mode
+// of evaluation, as arithmetic does. Variables and calls may not.
+func isNumber(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *ConstExpr:
+		return true
+	case *UnaryExpr:
+		return expr.Op != token.NOT
+	case *BinaryExpr:
+		return staticType(expr) == TypeNumber
+	default:
+		return false
+	}
+}
+
+// isString reports whether expr evaluates to text, as concatenation does.
+func isString(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *StringExpr:
+		return true
+	case *BinaryExpr:
+		return expr.Op == token.AND
+	default:
+		return false
+	}
+}
+
+func isEmptyString(expr Expr) bool {
+	str, ok := expr.(*StringExpr)
+	return ok && str.Value == ""
+}
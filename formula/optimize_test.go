@@ -0,0 +1,184 @@
+package formula
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOptimize(t *testing.T) {
+	optimize := func(expression string, opts ...OptimizeOption) (string, []Rewrite) {
+		expr, err := ParseExpr(expression)
+		So(err, ShouldBeNil)
+		result, rewrites := Optimize(expr, opts...)
+		return Format(result), rewrites
+	}
+
+	Convey("simplifications", t, func() {
+		for expression, want := range map[string]string{
+			"{x} * 1":                     "+{x}",
+			"0 + {y}":                     "0 + {y}",
+			"{y} * 1 + 0":                 "+{y}",
+			"MAX(3, 5)":                   "5",
+			"(({a})) + ((2 * 3))":         "{a} + 6",
+			"{a} * (1 + 2) - 0":           "{a} * 3",
+			"({a} - {b}) * 1 * 2":         "+({a} - {b}) * 2",
+			"{a} * 3 / 1 + 0":             "{a} * 3",
+			"--{a}":                       "+{a}",
+			"-(-(2 * {a}))":               "2 * {a}",
+			"2 - 5 * 1":                   "-3",
+			"(-3) ^ 2 + {a}":              "9 + {a}",
+			"2 ^ (0 - 1)":                 "0.5",
+			`"a" & 1 & ""`:                `"a1"`,
+			`{s} & "" & ""`:               `{s} & ""`,
+			`UPPER("ab") & {s}`:           `"AB" & {s}`,
+			`IF({a} > 0, 1 + 1, "x" & 2)`: `IF({a} > 0, 2, "x2")`,
+			"1 / 0 + {a} * 0":             "1 / 0 + {a} * 0",
+			"NOW() + 0 * 1":               "NOW() + 0",
+			"LEN({s}) - 0":                "+LEN({s})",
+			"(1 > 2) && {a}":              "1 > 2 && {a}",
+			"SUM({items}, 2 * 3)":         "SUM({items}, 6)",
+		} {
+			result, _ := optimize(expression)
+			So(result, ShouldEqual, want)
+		}
+	})
+
+	Convey("rewrites", t, func() {
+		_, rewrites := optimize("{x} * ((1 + 0))")
+		So(rewrites, ShouldResemble, []Rewrite{
+			{Rule: RuleGroup, Pos: 8, End: 13, Before: "((1+0))", After: "(1+0)"},
+			{Rule: RuleFold, Pos: 8, End: 13, Before: "1+0", After: "1"},
+			{Rule: RuleIdentity, Pos: 0, End: 13, Before: "{x}*1", After: "+{x}"},
+		})
+		So(RuleFold.String(), ShouldEqual, "fold")
+
+		// declared variables that are not dates
+		result, _ := optimize("0 + {y} - 0 + {d} - 0", WithVarTypes(VarTypes{"y": TypeNumber, "d": TypeDate}))
+		So(result, ShouldEqual, "+{y} + {d} - 0")
+		// names bound by LET hide the declared variables
+		result, _ = optimize("LET({y}, DATE(2024, 1, 1), {y} + 0) + (0 + {y})", WithVarTypes(VarTypes{"y": TypeNumber}))
+		So(result, ShouldEqual, "LET({y}, DATE(2024, 1, 1), {y} + 0) + +{y}")
+
+		_, rewrites = optimize("(1 + 2) * {x}")
+		So(rewrites, ShouldHaveLength, 1)
+		So(rewrites[0].Rule, ShouldEqual, RuleFold)
+
+		// the arguments of calls are not in parentheses
+		_, rewrites = optimize("EXP(1000) + LEN({s})")
+		So(rewrites, ShouldBeEmpty)
+		_, rewrites = optimize("MAX(3,5)")
+		So(rewrites, ShouldResemble, []Rewrite{
+			{Rule: RuleFold, Pos: 0, End: 8, Before: "MAX(3,5)", After: "5"},
+		})
+		_, rewrites = optimize("MAX((3), {x})")
+		So(rewrites, ShouldResemble, []Rewrite{
+			{Rule: RuleGroup, Pos: 5, End: 6, Before: "(3)", After: "3"},
+		})
+	})
+
+	Convey("evaluation options", t, func() {
+		result, _ := optimize("0.1 + 0.2")
+		So(result, ShouldEqual, "0.30000000000000004")
+		result, _ = optimize("0.1 + 0.2", WithEvalOptions(WithDecimal(4, RoundHalfUp)))
+		So(result, ShouldEqual, "0.3")
+		// rounding to the scale and changing the scale are not identities
+		result, _ = optimize("{a} / 1 + {b} * 1.0", WithEvalOptions(WithDecimal(4, RoundHalfUp)))
+		So(result, ShouldEqual, "{a} / 1 + {b} * 1.0")
+		result, _ = optimize("{a} / 1 + {b} * 1.0")
+		So(result, ShouldEqual, "+{a} + +{b}")
+	})
+
+	Convey("purity", t, func() {
+		registry := DefaultRegistry.Clone()
+		So(registry.Register("ONE", Pi(1), Signature{Result: TypeNumber}), ShouldBeNil)
+		So(registry.Register("PURE", Pi(1), Signature{Result: TypeNumber, Pure: true}), ShouldBeNil)
+		expr, err := ParseExpr("ONE() + PURE()", WithRegistry(registry))
+		So(err, ShouldBeNil)
+		result, _ := Optimize(expr)
+		So(Format(result), ShouldEqual, "ONE() + 3.141592653589793")
+	})
+
+	Convey("the optimized expressions evaluate alike", t, func() {
+		ops := []token.Token{token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.XOR, token.AND,
+			token.EQL, token.LSS, token.GEQ, token.LAND, token.LOR}
+		spellings := []string{"0", "1", "1.0", "2", "2.50", "0.1", "3"}
+		calls := map[string][2]int{"MAX": {1, 3}, "SUM": {1, 3}, "CONCAT": {1, 3}, "ROUND": {2, 2}, "IF": {2, 3}, "LEN": {1, 1}, "ABS": {1, 1}}
+		names := []string{"MAX", "SUM", "CONCAT", "ROUND", "IF", "LEN", "ABS"}
+		rnd := rand.New(rand.NewSource(1))
+		var gen func(depth int) Expr
+		gen = func(depth int) Expr {
+			var expr Expr
+			switch n := rnd.Intn(12); {
+			case depth == 0 || n < 3:
+				src := spellings[rnd.Intn(len(spellings))]
+				value, _ := strconv.ParseFloat(src, 64)
+				expr = &ConstExpr{Value: value, Src: src}
+			case n == 3:
+				expr = &StringExpr{Value: []string{"", "ab", "1"}[rnd.Intn(3)]}
+			case n == 4:
+				expr = &RefExpr{Name: []string{"x", "y", "s", "none"}[rnd.Intn(4)]}
+			case n == 5:
+				expr = &UnaryExpr{Op: []token.Token{token.NOT, token.ADD, token.SUB}[rnd.Intn(3)], X: gen(depth - 1)}
+			case n == 6:
+				call := &CallerExpr{Name: names[rnd.Intn(len(names))]}
+				arity := calls[call.Name]
+				for i := arity[0] + rnd.Intn(arity[1]-arity[0]+1); i > 0; i-- {
+					call.Args = append(call.Args, gen(depth-1))
+				}
+				expr = call
+			default:
+				expr = &BinaryExpr{X: gen(depth - 1), Op: ops[rnd.Intn(len(ops))], Y: gen(depth - 1)}
+			}
+			if rnd.Intn(4) == 0 {
+				expr = &GroupExpr{Expr: expr}
+			}
+			return expr
+		}
+		// decimals are alike by their digits, big.Int values holding them
+		// may differ
+		var alike func(x, y interface{}) bool
+		alike = func(x, y interface{}) bool {
+			switch x := x.(type) {
+			case Decimal:
+				y, ok := y.(Decimal)
+				return ok && x.String() == y.String()
+			case []interface{}:
+				y, ok := y.([]interface{})
+				if !ok || len(x) != len(y) {
+					return false
+				}
+				for i := range x {
+					if !alike(x[i], y[i]) {
+						return false
+					}
+				}
+				return true
+			default:
+				return reflect.DeepEqual(x, y)
+			}
+		}
+		env := MapEnv{"x": 4.5, "y": -2.0, "s": "text", "none": nil}
+		modes := [][]EvalOption{nil, {WithDecimal(6, RoundHalfEven)}}
+		folded := 0
+		for i := 0; i < 3000; i++ {
+			expr := gen(5)
+			for _, opts := range modes {
+				want, wantErr := Evaluate(context.Background(), expr, env, opts...)
+				result, rewrites := Optimize(expr, WithEvalOptions(opts...))
+				got, err := Evaluate(context.Background(), result, env, opts...)
+				folded += len(rewrites)
+				if (err != nil) != (wantErr != nil) || !alike(got, want) {
+					So(Format(result)+" = "+fmt.Sprint(got, err), ShouldEqual, Format(expr)+" = "+fmt.Sprint(want, wantErr))
+				}
+			}
+		}
+		So(folded, ShouldBeGreaterThan, 1000)
+	})
+}
@@ -1,52 +1,136 @@
 package formula
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"go/token"
 	"strconv"
+	"strings"
+
+	xjson "github.com/k0923/go/json"
 )
 
-type ParserError struct {
-	pos token.Pos
-	end token.Pos
-	err error
+type ParseOptions struct {
+	// Registry resolves the functions, DefaultRegistry when nil.
+	Registry *Registry
+	// Language of the error message, the diagnostics carry every language.
+	Language Language
+	// Limits bound the size of the formula, see WithParseLimits.
+	Limits ParseLimits
 }
 
-func (err *ParserError) Error() string {
-	msg := "unknow error"
-	if err.err != nil {
-		msg = err.err.Error()
-	}
-	return fmt.Sprintf("%s,pos:%v,end:%v", msg, err.pos, err.end)
+type ParseOption func(opt *ParseOptions)
+
+// WithRegistry parses calls against the functions of registry, e.g. the
+// clone of DefaultRegistry extended for a tenant.
+func WithRegistry(registry *Registry) ParseOption {
+	return func(opt *ParseOptions) { opt.Registry = registry }
 }
 
-func ParseExpr(expression string) (Expr, error) {
+// WithLanguage sets the language of the *ParserError message.
+func WithLanguage(lang Language) ParseOption {
+	return func(opt *ParseOptions) { opt.Language = lang }
+}
+
+// ParseExpr parses a formula. It recovers from errors to report as many
+// problems as it can, a failed parse returns a *ParserError holding all of
+// them.
+func ParseExpr(expression string, opts ...ParseOption) (Expr, error) {
 	p := &Parser{
 		scanner: NewFormulaScanner(expression),
 	}
-	return p.scanGroup(token.EOF, false)
+	for _, f := range opts {
+		f(&p.opt)
+	}
+	if p.opt.Registry == nil {
+		p.opt.Registry = DefaultRegistry
+	}
+	if max := p.opt.Limits.MaxLength; max > 0 && len(p.scanner.src) > max {
+		return nil, &LimitError{Limit: LimitLength, Max: max, Pos: token.Pos(max)}
+	}
+	expr := p.scanGroup(token.EOF)
+	if p.limit != nil {
+		return nil, p.limit
+	}
+	if expr == nil {
+		p.report(CodeEmptyExpression, p.pos, p.end, nil)
+	}
+	if len(p.diags) > 0 {
+		for _, diag := range p.diags {
+			diag.locate(p.scanner.src)
+		}
+		return nil, &ParserError{
+			Source:      expression,
+			Diagnostics: p.diags,
+			Language:    p.opt.Language,
+		}
+	}
+	return expr, nil
 }
 
 type Parser struct {
 	pos     token.Pos
+	end     token.Pos
 	tok     token.Token
 	lit     string
 	scanner *Scanner
+	opt     ParseOptions
+	diags   []*Diagnostic
+	// unread makes next deliver the current token again.
+	unread bool
+	// nodes and depth count against the limits, limit is the one exceeded.
+	nodes int
+	depth int
+	limit *LimitError
 }
 
 func (parser *Parser) next() {
+	if parser.limit != nil {
+		parser.tok, parser.lit = token.EOF, ""
+		return
+	}
+	if parser.unread {
+		parser.unread = false
+		return
+	}
 	parser.pos, parser.tok, parser.lit = parser.scanner.Scan()
+	parser.end = token.Pos(parser.scanner.offset)
+}
+
+func (parser *Parser) report(code ErrorCode, pos, end token.Pos, err error, args ...interface{}) {
+	parser.diags = append(parser.diags, &Diagnostic{
+		Code: code,
+		Pos:  pos,
+		End:  end,
+		Args: args,
+		Err:  err,
+	})
+}
+
+// text returns the source of the current token for messages.
+func (parser *Parser) text() string {
+	if parser.tok == token.EOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", string(parser.scanner.src[parser.pos:parser.end]))
 }
 
 func (parser *Parser) scanRef() (*RefExpr, error) {
 	pos := parser.pos
-	parser.next()
-	name := parser.lit
-	parser.next()
-	if parser.tok != token.RBRACE {
+	lit, ok := parser.scanner.scanUntil('}')
+	parser.end = token.Pos(parser.scanner.offset)
+	name := strings.TrimSpace(lit)
+	if !ok || name == "" {
 		return nil, fmt.Errorf("variable %s is not valid", name)
 	}
+	if root, path := splitRef(name); root == "" {
+		return nil, fmt.Errorf("variable %s is not valid", name)
+	} else if path != "" {
+		if err := xjson.ValidatePath(path); err != nil {
+			return nil, fmt.Errorf("variable %s is not valid: %w", name, err)
+		}
+	}
 	return &RefExpr{
 		Postion: pos,
 		Name:    name,
@@ -60,138 +144,237 @@ func (parser *Parser) scanConst() (*ConstExpr, error) {
 	}
 
 	return &ConstExpr{
-		Position: parser.pos - token.Pos(len(parser.lit)),
+		Position: parser.pos,
 		Value:    result,
 		Src:      parser.lit,
 	}, nil
 }
 
-func (parser *Parser) scanGroup(end token.Token, isParen bool) (Expr, error) {
+func (parser *Parser) scanString() (*StringExpr, error) {
+	value, err := unquote(parser.lit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid string literal:%s", parser.lit)
+	}
+	return &StringExpr{
+		Position: parser.pos,
+		Value:    value,
+		Src:      parser.lit,
+	}, nil
+}
+
+// unquote returns the value of a double quoted string literal, escapes are
+// the ones of Go.
+func unquote(lit string) (string, error) {
+	if !strings.HasPrefix(lit, `"`) {
+		return "", fmt.Errorf("invalid string literal:%s", lit)
+	}
+	return strconv.Unquote(lit)
+}
+
+// scanGroup parses an expression up to the end token. A closing parenthesis
+// also ends the groups of parentheses and arguments, which leave it to their
+// caller, as well as the end of input. It returns nil for an empty group,
+// after errors the result is only a placeholder.
+func (parser *Parser) scanGroup(end token.Token) Expr {
 	group := &ExprGroup{}
-	var pos token.Pos
-	var parserErr error
-loop:
 	for {
 		parser.next()
-		pos = parser.pos
-		if parser.tok == end {
-			break loop
-		}
+		start := parser.pos
 		switch {
-		case parser.tok.IsLiteral():
+		case parser.tok == end, parser.tok == token.EOF:
+			return parser.closeGroup(group)
+		case parser.tok == token.RPAREN && end != token.EOF:
+			return parser.closeGroup(group)
+		case parser.tok == token.INT || parser.tok == token.FLOAT:
+			parser.node(start)
 			if cst, err := parser.scanConst(); err != nil {
-				parserErr = err
-				break loop
-			} else if err := group.AddExpr(cst); err != nil {
-				parserErr = err
-				break loop
+				parser.report(CodeInvalidNumber, parser.pos, parser.end, err, parser.text())
+				parser.addOperand(group, start, parser.bad())
+			} else {
+				parser.addOperand(group, start, cst)
 			}
-			break
-		case parser.tok.IsOperator():
-			if err := group.AddOperator(parser.tok); err != nil {
-				parserErr = err
-				break loop
+		case parser.tok == token.STRING:
+			parser.node(start)
+			if str, err := parser.scanString(); err != nil {
+				parser.report(CodeInvalidString, parser.pos, parser.end, err, parser.text())
+				parser.addOperand(group, start, parser.bad())
+			} else {
+				parser.addOperand(group, start, str)
 			}
-			break
-		default:
-			switch parser.tok {
-			case token.IDENT:
-				if fn, err := parser.scanFn(); err != nil {
-					parserErr = err
-					break loop
-				} else if err := group.AddExpr(fn); err != nil {
-					parserErr = err
-					break loop
-				}
-			case token.LBRACE:
-				if ref, err := parser.scanRef(); err != nil {
-					parserErr = err
-					break loop
-				} else {
-					if err := ref.Valid(); err != nil {
-						parserErr = err
-						break loop
-					}
-					if err := group.AddExpr(ref); err != nil {
-						parserErr = err
-						break loop
-					}
-				}
-			case token.LPAREN:
-				if grp, err := parser.scanGroup(token.RPAREN, true); err != nil {
-					parserErr = err
-					break loop
-				} else if err := group.AddExpr(grp); err != nil {
-					parserErr = err
-					break loop
-				}
-			case token.RPAREN:
-				break loop
-			case token.EOF:
-				parserErr = errors.New("expression is not completed")
-				break loop
-			default:
-				parserErr = fmt.Errorf("unsupported token:%s", parser.tok)
+		case isUnaryOperator(parser.tok) && group.expectOperand():
+			parser.node(start)
+			group.AddUnary(parser.pos, parser.tok)
+		case isBinaryOperator(parser.tok):
+			if group.expectOperand() {
+				parser.report(CodeMissingOperand, parser.pos, parser.end, nil, parser.text())
+				continue
+			}
+			parser.node(start)
+			group.AddOperator(parser.tok)
+		case parser.tok == token.IDENT:
+			parser.node(start)
+			parser.addOperand(group, start, parser.scanFn())
+		case parser.tok == token.LBRACE:
+			parser.node(start)
+			if ref, err := parser.scanRef(); err != nil {
+				parser.report(CodeInvalidReference, start, parser.end, err, string(parser.scanner.src[start:parser.end]))
+				parser.addOperand(group, start, &badExpr{pos: start, end: parser.end})
+			} else {
+				parser.addOperand(group, start, ref)
 			}
+		case parser.tok == token.LPAREN:
+			parser.addOperand(group, start, parser.scanParen())
+		case parser.tok == token.ILLEGAL && strings.HasPrefix(parser.lit, `"`):
+			parser.report(CodeInvalidString, parser.pos, parser.end, nil, parser.text())
+			parser.addOperand(group, start, parser.bad())
+		case parser.tok == token.ILLEGAL && parser.lit != "" && isDecimal([]rune(parser.lit)[0]):
+			parser.report(CodeInvalidNumber, parser.pos, parser.end, nil, parser.text())
+			parser.addOperand(group, start, parser.bad())
+		default:
+			// skip the token and go on with the group
+			parser.report(CodeUnexpectedToken, parser.pos, parser.end, nil, parser.text())
 		}
 	}
+}
 
-	if parserErr != nil {
-		return nil, &ParserError{
-			pos: pos,
-			end: parser.pos,
-			err: parserErr,
-		}
+// closeGroup completes a group at its end token.
+func (parser *Parser) closeGroup(group *ExprGroup) Expr {
+	if group.expr == nil && len(group.unary) == 0 {
+		return nil
 	}
 	if err := group.Valid(); err != nil {
-		return nil, &ParserError{
-			pos: pos,
-			end: parser.pos,
-			err: err,
+		parser.report(CodeMissingOperand, parser.pos, parser.end, err, parser.text())
+		return parser.bad()
+	}
+	return group.Expr()
+}
+
+// addOperand adds expr, which starts at pos and ends at the current token, to
+// group, reporting a missing operator when the group expects one.
+func (parser *Parser) addOperand(group *ExprGroup, pos token.Pos, expr Expr) {
+	if !group.expectOperand() {
+		if _, ok := expr.(*badExpr); !ok {
+			src := string(parser.scanner.src[pos:parser.end])
+			parser.report(CodeMissingOperator, pos, parser.end, nil, fmt.Sprintf("%q", src))
 		}
+		return
+	}
+	group.AddExpr(expr)
+}
+
+func (parser *Parser) bad() *badExpr {
+	return &badExpr{pos: parser.pos, end: parser.end}
+}
+
+// scanParen parses a parenthesized group, the left parenthesis is the
+// current token.
+func (parser *Parser) scanParen() Expr {
+	pos, end := parser.pos, parser.end
+	parser.nest(pos)
+	grp := parser.scanGroup(token.RPAREN)
+	parser.depth--
+	if parser.tok != token.RPAREN {
+		parser.report(CodeUnclosedParen, pos, end, nil)
+		return &badExpr{pos: pos, end: parser.end}
+	}
+	if grp == nil {
+		parser.report(CodeEmptyExpression, pos, parser.end, nil)
+		return &badExpr{pos: pos, end: parser.end}
 	}
-	return group.Expr(), nil
+	return grp
 }
 
-func (parser *Parser) scanFn() (*CallerExpr, error) {
-	fnName := parser.lit
+func (parser *Parser) scanFn() Expr {
+	fnName, pos, nameEnd := parser.lit, parser.pos, parser.end
 	parser.next()
 	if parser.tok != token.LPAREN {
-		return nil, errors.New("there should be a left lparen after function name")
+		parser.report(CodeMissingCallParen, pos, nameEnd, nil, fnName)
+		parser.unread = true
+		return &badExpr{pos: pos, end: nameEnd}
 	}
+	lparen := parser.pos
 
+	def, ok := parser.opt.Registry.Lookup(fnName)
+	if !ok {
+		parser.report(CodeUnknownFunction, pos, nameEnd, nil, fnName)
+	}
 	expr := &CallerExpr{
 		Name: fnName,
 		Args: make([]Expr, 0),
+		pos:  pos,
+		def:  def,
 	}
-
-	fn := fns[fnName]
-	if fn == nil {
-		return nil, fmt.Errorf("function:%s is not existed", fnName)
-	}
-loop:
+	diags := len(parser.diags)
+	parser.nest(lparen)
 	for {
-		if grp, err := parser.scanGroup(token.COMMA, false); err != nil {
-			return nil, err
-		} else {
-			if grp != nil {
-				expr.Args = append(expr.Args, grp)
-			}
+		grp := parser.scanGroup(token.COMMA)
+		switch {
+		case grp != nil:
+			expr.Args = append(expr.Args, grp)
+		case parser.tok == token.RPAREN && len(expr.Args) == 0:
+			// call without arguments
+		case parser.tok != token.EOF:
+			parser.report(CodeMissingArgument, parser.pos, parser.end, nil, fnName, len(expr.Args)+1)
+			expr.Args = append(expr.Args, parser.bad())
 		}
-		switch parser.tok {
-		case token.RPAREN:
-			break loop
-		case token.COMMA:
-			continue
-		default:
-			return nil, errors.New("function is not completed")
+		if parser.tok != token.COMMA {
+			break
 		}
 	}
+	parser.depth--
+	if parser.tok != token.RPAREN {
+		parser.report(CodeUnclosedParen, lparen, lparen+1, nil)
+		return &badExpr{pos: pos, end: parser.end}
+	}
+	if !ok || len(parser.diags) > diags {
+		// the arguments are not checked after errors
+		return &badExpr{pos: pos, end: parser.end}
+	}
 
-	if err := fn.Valid(expr.Args); err != nil {
-		return nil, err
+	expr.Name = def.Name
+	if err := def.Signature.check(expr.Args); err != nil {
+		parser.reportCall(expr, parser.end, err)
+		return &badExpr{pos: pos, end: parser.end}
+	}
+	if err := def.Function.Valid(expr.Args); err != nil {
+		parser.reportCall(expr, parser.end, err)
+		return &badExpr{pos: pos, end: parser.end}
 	}
+	return expr
+}
 
-	return expr, nil
+// reportCall reports the error of a signature check or of Function.Valid.
+func (parser *Parser) reportCall(expr *CallerExpr, end token.Pos, err error) {
+	err = expr.locate(err)
+	sig := expr.def.Signature
+	var argErr *ArgumentError
+	switch {
+	case errors.Is(err, ErrArgumentCount):
+		parser.report(CodeArgumentCount, expr.pos, end, err, expr.Name, arityText{sig.MinArgs(), sig.MaxArgs()}, len(expr.Args))
+	case errors.Is(err, ErrArgumentType) && errors.As(err, &argErr):
+		parser.report(CodeArgumentType, argErr.Pos, argErr.End, err, expr.Name, argErr.Index+1, sig.Param(argErr.Index), staticType(expr.Args[argErr.Index]))
+	case errors.As(err, &argErr) && argErr.Index >= 0 && argErr.Index < len(expr.Args):
+		parser.report(CodeInvalidCall, argErr.Pos, argErr.End, err, expr.Name, argErr.Err)
+	default:
+		parser.report(CodeInvalidCall, expr.pos, end, err, expr.Name, err)
+	}
+}
+
+// badExpr stands for a part of the source with errors, so that parsing goes
+// on after them. It never leaves the parser.
+type badExpr struct {
+	pos token.Pos
+	end token.Pos
+}
+
+func (expr *badExpr) Calculate(ctx context.Context) (interface{}, error) {
+	return nil, errors.New("bad expression")
+}
+
+func (expr *badExpr) Pos() token.Pos {
+	return expr.pos
+}
 
+func (expr *badExpr) End() token.Pos {
+	return expr.end
 }
@@ -0,0 +1,334 @@
+package formula
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Type is a set of formula value types. A signature parameter accepts an
+// argument when their types intersect, e.g. TypeNumber|TypeArray accepts
+// both 1 and {items[*].price}. The type of array items is kept by ArrayOf,
+// TypeArray is an array of any items.
+type Type uint16
+
+const (
+	TypeNumber Type = 1 << iota
+	TypeString
+	TypeBool
+	TypeArray
+	TypeDate
+
+	TypeAny = TypeNumber | TypeString | TypeBool | TypeArray | TypeDate
+)
+
+// elemShift places the type of array items above the value types.
+const elemShift = 8
+
+// ArrayOf returns the type of arrays of elem items, e.g.
+// ArrayOf(TypeNumber) for {items[*].price}.
+func ArrayOf(elem Type) Type {
+	elem &= TypeAny
+	if elem == TypeAny {
+		return TypeArray
+	}
+	return TypeArray | elem<<elemShift
+}
+
+// Elem returns the type of the items of an array type, TypeAny when unknown.
+func (t Type) Elem() Type {
+	if elem := t >> elemShift; elem != 0 {
+		return elem
+	}
+	return TypeAny
+}
+
+var typeNames = []struct {
+	typ  Type
+	name string
+}{
+	{TypeNumber, "number"},
+	{TypeString, "string"},
+	{TypeBool, "bool"},
+	{TypeArray, "array"},
+	{TypeDate, "date"},
+}
+
+func (t Type) String() string {
+	if t == TypeAny {
+		return "any"
+	}
+	names := make([]string, 0, len(typeNames))
+	for _, item := range typeNames {
+		switch {
+		case t&item.typ == 0:
+		case item.typ == TypeArray && t.Elem() != TypeAny:
+			names = append(names, fmt.Sprintf("array<%s>", t.Elem()))
+		default:
+			names = append(names, item.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Accepts reports whether a value of type u may be passed as t. Arrays are
+// accepted when their items may be.
+func (t Type) Accepts(u Type) bool {
+	common := t & u & TypeAny
+	if common != TypeArray {
+		return common != 0
+	}
+	return t.Elem()&u.Elem() != 0
+}
+
+// Signature declares the parameters and the result of a function. The last
+// Optional parameters may be omitted, and the last parameter repeats when
+// the function is Variadic.
+type Signature struct {
+	Params   []Type
+	Optional int
+	Variadic bool
+	Result   Type
+	// Pure declares that the function returns the same result for the same
+	// arguments and evaluation options, so that Optimize may fold its calls
+	// on constants. Functions reading the clock, like NOW, are not pure.
+	Pure bool
+}
+
+// AnySignature accepts any number of arguments of any type.
+var AnySignature = Signature{Params: []Type{TypeAny}, Optional: 1, Variadic: true, Result: TypeAny}
+
+// MinArgs returns the least number of arguments.
+func (sig Signature) MinArgs() int {
+	return len(sig.Params) - sig.Optional
+}
+
+// MaxArgs returns the largest number of arguments, -1 when unbounded.
+func (sig Signature) MaxArgs() int {
+	if sig.Variadic {
+		return -1
+	}
+	return len(sig.Params)
+}
+
+// Param returns the type of the i-th argument.
+func (sig Signature) Param(i int) Type {
+	if i < len(sig.Params) {
+		return sig.Params[i]
+	}
+	if sig.Variadic && len(sig.Params) > 0 {
+		return sig.Params[len(sig.Params)-1]
+	}
+	return 0
+}
+
+// String formats the signature like "(string, [number]) string".
+func (sig Signature) String() string {
+	params := make([]string, len(sig.Params))
+	for i, param := range sig.Params {
+		params[i] = param.String()
+		if sig.Variadic && i == len(sig.Params)-1 {
+			params[i] += "..."
+		}
+		if i >= sig.MinArgs() {
+			params[i] = "[" + params[i] + "]"
+		}
+	}
+	return fmt.Sprintf("(%s) %s", strings.Join(params, ", "), sig.Result)
+}
+
+var ErrArgumentCount = errors.New("参数个数错误")
+
+// check validates the number of args and the types that are known before
+// evaluation.
+func (sig Signature) check(args []Expr) error {
+	if len(args) < sig.MinArgs() || sig.MaxArgs() >= 0 && len(args) > sig.MaxArgs() {
+		return fmt.Errorf("%w: expect %s but got %d", ErrArgumentCount, sig.arity(), len(args))
+	}
+	for i, arg := range args {
+		param, actual := sig.Param(i), staticType(arg)
+		if !param.Accepts(actual) {
+			return argError(i, fmt.Errorf("%w: expect %s but got %s", ErrArgumentType, param, actual))
+		}
+	}
+	return nil
+}
+
+func (sig Signature) arity() string {
+	switch min, max := sig.MinArgs(), sig.MaxArgs(); {
+	case max < 0:
+		return fmt.Sprintf("at least %d", min)
+	case min == max:
+		return fmt.Sprintf("%d", min)
+	default:
+		return fmt.Sprintf("%d to %d", min, max)
+	}
+}
+
+// staticType returns the types an expression may evaluate to, as far as is
+// known without variables.
+func staticType(expr Expr) Type {
+	switch expr := expr.(type) {
+	case *ConstExpr:
+		return TypeNumber
+	case *StringExpr:
+		return TypeString
+	case *GroupExpr:
+		return staticType(expr.Expr)
+	case *UnaryExpr:
+		if expr.Op == token.NOT {
+			return TypeBool
+		}
+		return TypeNumber
+	case *BinaryExpr:
+		switch {
+		case isComparison(expr.Op), expr.Op == token.LAND, expr.Op == token.LOR:
+			return TypeBool
+		case expr.Op == token.AND:
+			return TypeString
+		case (expr.Op == token.ADD || expr.Op == token.SUB) && (staticType(expr.X)|staticType(expr.Y))&TypeDate != 0:
+			// days added to a date, or the days between dates
+			return TypeNumber | TypeDate
+		default:
+			return TypeNumber
+		}
+	case *CallerExpr:
+		if expr.def != nil {
+			return expr.def.Signature.Result
+		}
+	}
+	return TypeAny
+}
+
+// FunctionDef is a function registered under its canonical, upper case name.
+type FunctionDef struct {
+	Name      string
+	Function  Function
+	Signature Signature
+	// Doc describes the function to formula authors, see SetDoc.
+	Doc string
+}
+
+// Registry holds the functions available to formulas. Names are case
+// insensitive. A Registry is safe for concurrent use, Clone it to extend the
+// built-in functions for a tenant without affecting others.
+type Registry struct {
+	mu  sync.RWMutex
+	fns map[string]*FunctionDef
+}
+
+// DefaultRegistry holds the built-in functions, it is used when no registry
+// is given to the parser.
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{fns: make(map[string]*FunctionDef)}
+}
+
+// Clone returns a registry with the functions of r, changes to either of them
+// do not affect the other.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := NewRegistry()
+	for name, def := range r.fns {
+		clone.fns[name] = def
+	}
+	return clone
+}
+
+// Register adds fn under name, the parser checks calls against sig before
+// calling fn.Valid.
+func (r *Registry) Register(name string, fn Function, sig Signature) error {
+	if fn == nil {
+		return errors.New("function should not be nil")
+	}
+	if !isFunctionName(name) {
+		return fmt.Errorf("invalid function name:%s", name)
+	}
+	if sig.Optional < 0 || sig.Optional > len(sig.Params) || sig.Variadic && len(sig.Params) == 0 {
+		return fmt.Errorf("invalid signature of function:%s", name)
+	}
+	def := &FunctionDef{Name: strings.ToUpper(name), Function: fn, Signature: sig}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exist := r.fns[def.Name]; exist {
+		return fmt.Errorf("duplicate function name:%s found", def.Name)
+	}
+	if r.fns == nil {
+		r.fns = make(map[string]*FunctionDef)
+	}
+	r.fns[def.Name] = def
+	return nil
+}
+
+// Unregister removes the function name, it reports whether it was found.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name = strings.ToUpper(name)
+	_, exist := r.fns[name]
+	delete(r.fns, name)
+	return exist
+}
+
+// SetDoc sets the doc of the function name shown by editors, it reports
+// whether the function was found.
+func (r *Registry) SetDoc(name, doc string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name = strings.ToUpper(name)
+	def, exist := r.fns[name]
+	if exist {
+		// the definition may be shared with clones
+		copied := *def
+		copied.Doc = doc
+		r.fns[name] = &copied
+	}
+	return exist
+}
+
+// Lookup finds a function by its case insensitive name.
+func (r *Registry) Lookup(name string) (*FunctionDef, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	def, ok := r.fns[strings.ToUpper(name)]
+	return def, ok
+}
+
+// Names returns the sorted names of the registered functions.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.fns))
+	for name := range r.fns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isFunctionName(name string) bool {
+	for i, ch := range name {
+		if !isLetter(ch) && (i == 0 || !isDecimal(ch)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Register adds fn to DefaultRegistry, named by its type name. Its calls
+// are only checked by fn.Valid.
+func Register(fn Function) error {
+	if fn == nil {
+		return errors.New("function should not be nil")
+	}
+	return DefaultRegistry.Register(reflect.TypeOf(fn).Name(), fn, AnySignature)
+}
@@ -0,0 +1,145 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("case insensitive lookup", t, func() {
+		result, err := calculate("sum(1, 2) + Max(3, 4)", nil)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 7.0)
+
+		expr, err := ParseExpr("len(\"abc\")")
+		So(err, ShouldBeNil)
+		So(fmt.Sprint(expr), ShouldStartWith, "LEN(")
+	})
+
+	Convey("signatures are checked at parse time", t, func() {
+		_, err := ParseExpr("MID(\"abc\", 1)")
+		So(errors.Is(err, ErrArgumentCount), ShouldBeTrue)
+		_, err = ParseExpr("LEFT(\"abc\", 1, 2)")
+		So(errors.Is(err, ErrArgumentCount), ShouldBeTrue)
+
+		_, err = ParseExpr("LEN(1 + 2)")
+		So(errors.Is(err, ErrArgumentType), ShouldBeTrue)
+		var argErr *ArgumentError
+		So(errors.As(err, &argErr), ShouldBeTrue)
+		So(argErr.Fn, ShouldEqual, "LEN")
+		So(argErr.Index, ShouldEqual, 0)
+		So(argErr.Pos, ShouldEqual, 4)
+
+		_, err = ParseExpr("SUM(1, \"a\" & \"b\")")
+		So(errors.Is(err, ErrArgumentType), ShouldBeTrue)
+		_, err = ParseExpr("UPPER(LEN(\"a\"))")
+		So(errors.Is(err, ErrArgumentType), ShouldBeTrue)
+		_, err = ParseExpr("SUM({items}, 1) + LEN({name})")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("tenant registries", t, func() {
+		tenant := DefaultRegistry.Clone()
+		So(tenant.RegisterFunc("discount", func(price float64, rate int) float64 {
+			return price * float64(100-rate) / 100
+		}), ShouldBeNil)
+		So(tenant.RegisterFunc("JOIN", func(sep string, items ...string) string {
+			return strings.Join(items, sep)
+		}), ShouldBeNil)
+		So(tenant.RegisterFunc("Total", func(ctx context.Context, prices []float64) (float64, error) {
+			if _, ok := decimalOptions(ctx); ok {
+				return 0, errors.New("decimal mode")
+			}
+			total := 0.0
+			for _, price := range prices {
+				total += price
+			}
+			return total, nil
+		}), ShouldBeNil)
+		So(tenant.Unregister("TEXT"), ShouldBeTrue)
+
+		evaluate := func(expression string, opts ...EvalOption) (interface{}, error) {
+			expr, err := ParseExpr(expression, WithRegistry(tenant))
+			if err != nil {
+				return nil, err
+			}
+			return Evaluate(context.Background(), expr, MapEnv{"prices": []int{1, 2, 3}}, opts...)
+		}
+		result, err := evaluate("DISCOUNT(200, 15)")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 170.0)
+		result, err = evaluate("join(\"-\", \"a\", \"b\", UPPER(\"c\"))")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "a-b-C")
+		result, err = evaluate("JOIN(\",\")")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "")
+		result, err = evaluate("total({prices}) + SUM({prices})")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 12.0)
+		_, err = evaluate("TOTAL({prices})", WithDecimal(2, RoundHalfUp))
+		So(err, ShouldNotBeNil)
+
+		_, err = evaluate("DISCOUNT(\"a\", 1)")
+		So(errors.Is(err, ErrArgumentType), ShouldBeTrue)
+		_, err = evaluate("TEXT(1, \"0\")")
+		So(err, ShouldNotBeNil)
+		_, err = ParseExpr("DISCOUNT(1, 2)")
+		So(err, ShouldNotBeNil)
+		_, ok := DefaultRegistry.Lookup("text")
+		So(ok, ShouldBeTrue)
+
+		def, ok := tenant.Lookup("join")
+		So(ok, ShouldBeTrue)
+		So(def.Signature.String(), ShouldEqual, "(string, [string...]) string")
+		So(tenant.Names(), ShouldContain, "TOTAL")
+	})
+
+	Convey("numbers should fit the parameters", t, func() {
+		registry := DefaultRegistry.Clone()
+		So(registry.RegisterFunc("INT", func(n int) int { return n }), ShouldBeNil)
+		So(registry.RegisterFunc("UINT", func(n uint) uint { return n }), ShouldBeNil)
+		So(registry.RegisterFunc("INT8", func(n int8) int8 { return n }), ShouldBeNil)
+		So(registry.RegisterFunc("FLOAT32", func(n float32) float32 { return n }), ShouldBeNil)
+		for expression, want := range map[string]interface{}{
+			"INT(-3) + UINT(3)":                    0.0,
+			"INT8(-128)":                           -128.0,
+			"INT(2^53)":                            9007199254740992.0,
+			"FLOAT32(1.5)":                         1.5,
+			"INT(2.7)":                             nil,
+			"INT(10^19)":                           nil,
+			"INT(10^300*10^300)":                   nil,
+			"INT((10^300*10^300)-(10^300*10^300))": nil,
+			"UINT(-1)":                             nil,
+			"UINT(2^64)":                           nil,
+			"INT8(128)":                            nil,
+			"FLOAT32(10^39)":                       nil,
+		} {
+			expr, err := ParseExpr(expression, WithRegistry(registry))
+			So(err, ShouldBeNil)
+			result, err := Evaluate(context.Background(), expr, nil)
+			if want == nil {
+				So(errors.Is(err, ErrArgumentType), ShouldBeTrue)
+				continue
+			}
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, want)
+		}
+	})
+
+	Convey("invalid registrations", t, func() {
+		registry := NewRegistry()
+		So(registry.RegisterFunc("F", 1), ShouldNotBeNil)
+		So(registry.RegisterFunc("F", func(m map[string]int) int { return 0 }), ShouldNotBeNil)
+		So(registry.RegisterFunc("F", func() (int, int) { return 0, 0 }), ShouldNotBeNil)
+		So(registry.RegisterFunc("1F", func() int { return 0 }), ShouldNotBeNil)
+		So(registry.Register("F", Sum(1), Signature{Params: []Type{TypeNumber}, Optional: 2}), ShouldNotBeNil)
+		So(registry.Register("F", Sum(1), AnySignature), ShouldBeNil)
+		So(registry.Register("f", Sum(1), AnySignature), ShouldNotBeNil)
+	})
+}
@@ -65,8 +65,37 @@ func (s *Scanner) Scan() (pos token.Pos, tok token.Token, lit string) {
 			tok = token.MUL
 		case '/':
 			tok = token.QUO
+		case '%':
+			tok = token.REM
+		case '^':
+			tok = token.XOR
 		case ',':
 			tok = token.COMMA
+		case '=':
+			if s.accept('=') {
+				tok = token.EQL
+			} else {
+				tok = token.ILLEGAL
+				lit = string(ch)
+			}
+		case '!':
+			tok = s.switch2(token.NOT, token.NEQ)
+		case '<':
+			tok = s.switch2(token.LSS, token.LEQ)
+		case '>':
+			tok = s.switch2(token.GTR, token.GEQ)
+		case '&':
+			// "&" concatenates text, "&&" is the logical and
+			tok = s.switch2By('&', token.AND, token.LAND)
+		case '"':
+			tok, lit = s.scanString()
+		case '|':
+			if s.accept('|') {
+				tok = token.LOR
+			} else {
+				tok = token.ILLEGAL
+				lit = string(ch)
+			}
 		default:
 			tok = token.ILLEGAL
 			lit = string(ch)
@@ -75,6 +104,63 @@ func (s *Scanner) Scan() (pos token.Pos, tok token.Token, lit string) {
 	return
 }
 
+// accept consumes the current character if it is ch.
+func (s *Scanner) accept(ch rune) bool {
+	if s.ch == ch {
+		s.next()
+		return true
+	}
+	return false
+}
+
+// switch2 returns tok1, or tok2 when the operator is followed by '='.
+func (s *Scanner) switch2(tok1, tok2 token.Token) token.Token {
+	return s.switch2By('=', tok1, tok2)
+}
+
+func (s *Scanner) switch2By(ch rune, tok1, tok2 token.Token) token.Token {
+	if s.accept(ch) {
+		return tok2
+	}
+	return tok1
+}
+
+// scanString scans a double quoted literal, the opening quote is already
+// consumed. lit keeps the quotes and escapes as written in the source.
+func (s *Scanner) scanString() (token.Token, string) {
+	offs := s.offset - 1
+	for {
+		switch s.ch {
+		case eof:
+			return token.ILLEGAL, string(s.src[offs:s.offset])
+		case '\\':
+			s.next()
+			if s.ch == eof {
+				return token.ILLEGAL, string(s.src[offs:s.offset])
+			}
+		case '"':
+			s.next()
+			return token.STRING, string(s.src[offs:s.offset])
+		}
+		s.next()
+	}
+}
+
+// scanUntil returns the raw source up to the closing delimiter and consumes
+// it, ok is false when the source ends first.
+func (s *Scanner) scanUntil(delim rune) (lit string, ok bool) {
+	offs := s.offset
+	for s.ch != delim {
+		if s.ch == eof {
+			return string(s.src[offs:s.offset]), false
+		}
+		s.next()
+	}
+	lit = string(s.src[offs:s.offset])
+	s.next()
+	return lit, true
+}
+
 func (s *Scanner) scanNumber() (token.Token, string) {
 	offs := s.offset
 	tok := token.INT
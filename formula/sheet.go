@@ -0,0 +1,386 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// References returns the sorted variables referenced by expr, nested
+// references such as {order.items[0].price} name their root variable. The
+// names bound by LET are not variables within the values following them and
+// the body.
+func References(expr Expr) []string {
+	seen := make(map[string]struct{})
+	references(expr, nil, seen)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// references adds the roots of the references of expr to seen, but the
+// names in bound.
+func references(expr Expr, bound map[string]bool, seen map[string]struct{}) {
+	Inspect(expr, func(node Expr) bool {
+		switch node := node.(type) {
+		case *RefExpr:
+			if root, _ := splitRef(node.Name); !bound[root] {
+				seen[root] = struct{}{}
+			}
+		case *CallerExpr:
+			if !isLet(node) || len(node.Args)%2 == 0 {
+				return true
+			}
+			inner := maps.Clone(bound)
+			if inner == nil {
+				inner = make(map[string]bool)
+			}
+			for i := 0; i < len(node.Args)-1; i += 2 {
+				name, err := bindingName(node.Args[i])
+				if err != nil {
+					references(node.Args[i], inner, seen)
+				}
+				references(node.Args[i+1], inner, seen)
+				if err == nil {
+					inner[name] = true
+				}
+			}
+			references(node.Args[len(node.Args)-1], inner, seen)
+			return false
+		}
+		return true
+	})
+}
+
+var ErrCircularReference = errors.New("circular reference")
+
+// CycleError reports formulas referencing each other, Cycle starts and ends
+// with the same name.
+type CycleError struct {
+	Cycle []string
+}
+
+func (err *CycleError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrCircularReference, strings.Join(err.Cycle, " -> "))
+}
+
+func (err *CycleError) Unwrap() error {
+	return ErrCircularReference
+}
+
+type SheetOptions struct {
+	// Registry resolves the functions of formulas set as text.
+	Registry *Registry
+	Eval     []EvalOption
+}
+
+type SheetOption func(opt *SheetOptions)
+
+func WithSheetRegistry(registry *Registry) SheetOption {
+	return func(opt *SheetOptions) { opt.Registry = registry }
+}
+
+func WithSheetEval(opts ...EvalOption) SheetOption {
+	return func(opt *SheetOptions) { opt.Eval = append(opt.Eval, opts...) }
+}
+
+type cell struct {
+	expr  Expr
+	deps  []string
+	value interface{}
+	err   error
+	dirty bool
+}
+
+// Sheet holds named formulas referencing inputs and each other, like the
+// cells of a spreadsheet. Formulas are calculated in dependency order, and
+// after a change only the formulas depending on it are recalculated. A
+// Sheet is safe for concurrent use.
+type Sheet struct {
+	mu       sync.Mutex
+	opt      SheetOptions
+	cells    map[string]*cell
+	inputs   map[string]interface{}
+	children map[string]map[string]struct{} // name -> formulas referencing it
+}
+
+func NewSheet(opts ...SheetOption) *Sheet {
+	sheet := &Sheet{
+		cells:    make(map[string]*cell),
+		inputs:   make(map[string]interface{}),
+		children: make(map[string]map[string]struct{}),
+	}
+	for _, f := range opts {
+		f(&sheet.opt)
+	}
+	return sheet
+}
+
+// Set parses expression and stores it as the formula name.
+func (sheet *Sheet) Set(name, expression string) error {
+	expr, err := ParseExpr(expression, WithRegistry(sheet.opt.Registry))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return sheet.SetExpr(name, expr)
+}
+
+// SetExpr stores expr as the formula name, replacing the previous one. It
+// fails with a *CycleError when the formula would reference itself.
+func (sheet *Sheet) SetExpr(name string, expr Expr) error {
+	if name == "" || expr == nil {
+		return errors.New("formula name and expression should not be empty")
+	}
+	deps := References(expr)
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	if cycle := sheet.findCycle(name, deps); cycle != nil {
+		return &CycleError{Cycle: cycle}
+	}
+	sheet.unlink(name)
+	sheet.cells[name] = &cell{expr: expr, deps: deps}
+	for _, dep := range deps {
+		if sheet.children[dep] == nil {
+			sheet.children[dep] = make(map[string]struct{})
+		}
+		sheet.children[dep][name] = struct{}{}
+	}
+	sheet.invalidate(name)
+	return nil
+}
+
+// Delete removes the formula name, formulas referencing it are recalculated.
+func (sheet *Sheet) Delete(name string) {
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	if _, ok := sheet.cells[name]; !ok {
+		return
+	}
+	sheet.invalidate(name)
+	sheet.unlink(name)
+	delete(sheet.cells, name)
+}
+
+// SetInput sets an input variable, formulas depending on it are
+// recalculated.
+func (sheet *Sheet) SetInput(name string, value interface{}) {
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	sheet.inputs[name] = value
+	sheet.invalidate(name)
+}
+
+// SetInputs sets several input variables at once.
+func (sheet *Sheet) SetInputs(inputs map[string]interface{}) {
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	for name, value := range inputs {
+		sheet.inputs[name] = value
+		sheet.invalidate(name)
+	}
+}
+
+// Dependencies returns the variables the formula name references.
+func (sheet *Sheet) Dependencies(name string) []string {
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	if c, ok := sheet.cells[name]; ok {
+		return append([]string(nil), c.deps...)
+	}
+	return nil
+}
+
+// Dependents returns the sorted formulas referencing name, directly or
+// through other formulas.
+func (sheet *Sheet) Dependents(name string) []string {
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	seen := make(map[string]struct{})
+	sheet.walkDependents(name, func(child string) {
+		seen[child] = struct{}{}
+	})
+	names := make([]string, 0, len(seen))
+	for child := range seen {
+		names = append(names, child)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Order returns the formulas in the order they are calculated, every
+// formula comes after the formulas it references.
+func (sheet *Sheet) Order() []string {
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	return sheet.order()
+}
+
+// Recalculate calculates the formulas changed since the last call and the
+// formulas depending on them, in dependency order. It returns the names of
+// the calculated formulas, and the errors of the ones that failed.
+func (sheet *Sheet) Recalculate(ctx context.Context) ([]string, error) {
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	env := sheetEnv{sheet: sheet}
+	calculated := make([]string, 0)
+	var errs []error
+	for _, name := range sheet.order() {
+		c := sheet.cells[name]
+		if !c.dirty {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return calculated, err
+		}
+		c.value, c.err = nil, nil
+		for _, dep := range c.deps {
+			if depCell, ok := sheet.cells[dep]; ok && depCell.err != nil {
+				c.err = fmt.Errorf("{%s}: %w", dep, depCell.err)
+				break
+			}
+		}
+		if c.err == nil {
+			c.value, c.err = Evaluate(ctx, c.expr, env, sheet.opt.Eval...)
+		}
+		c.dirty = false
+		calculated = append(calculated, name)
+		if c.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, c.err))
+		}
+	}
+	return calculated, errors.Join(errs...)
+}
+
+// Value returns the result of the formula name as of the last Recalculate,
+// or the value of the input name.
+func (sheet *Sheet) Value(name string) (interface{}, error) {
+	sheet.mu.Lock()
+	defer sheet.mu.Unlock()
+	if c, ok := sheet.cells[name]; ok {
+		return c.value, c.err
+	}
+	if value, ok := sheet.inputs[name]; ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("%w {%s}", ErrUndefinedVariable, name)
+}
+
+// findCycle returns the cycle formed by setting name to a formula
+// referencing deps, nil when there is none.
+func (sheet *Sheet) findCycle(name string, deps []string) []string {
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(node string) bool
+	visit = func(node string) bool {
+		if node == name {
+			return true
+		}
+		if visited[node] {
+			return false
+		}
+		visited[node] = true
+		c, ok := sheet.cells[node]
+		if !ok {
+			return false
+		}
+		path = append(path, node)
+		for _, dep := range c.deps {
+			if visit(dep) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	for _, dep := range deps {
+		path = path[:0]
+		if visit(dep) {
+			return append(append([]string{name}, path...), name)
+		}
+	}
+	return nil
+}
+
+func (sheet *Sheet) unlink(name string) {
+	if old, ok := sheet.cells[name]; ok {
+		for _, dep := range old.deps {
+			delete(sheet.children[dep], name)
+		}
+	}
+}
+
+// invalidate marks the formula name, if any, and its dependents dirty.
+func (sheet *Sheet) invalidate(name string) {
+	if c, ok := sheet.cells[name]; ok {
+		c.dirty = true
+	}
+	sheet.walkDependents(name, func(child string) {
+		sheet.cells[child].dirty = true
+	})
+}
+
+func (sheet *Sheet) walkDependents(name string, f func(child string)) {
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for child := range sheet.children[node] {
+			if !seen[child] {
+				seen[child] = true
+				f(child)
+				queue = append(queue, child)
+			}
+		}
+	}
+}
+
+// order sorts the formulas topologically, ties by name.
+func (sheet *Sheet) order() []string {
+	names := make([]string, 0, len(sheet.cells))
+	for name := range sheet.cells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]string, 0, len(names))
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		c, ok := sheet.cells[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, dep := range c.deps {
+			visit(dep)
+		}
+		result = append(result, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return result
+}
+
+// sheetEnv resolves formulas to their results and other names to inputs.
+type sheetEnv struct {
+	sheet *Sheet
+}
+
+func (env sheetEnv) Lookup(name string) (interface{}, bool) {
+	if c, ok := env.sheet.cells[name]; ok {
+		return c.value, true
+	}
+	value, ok := env.sheet.inputs[name]
+	if !ok {
+		return nil, false
+	}
+	return normalizeValue(value), true
+}
@@ -0,0 +1,118 @@
+package formula
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSheet(t *testing.T) {
+	Convey("references", t, func() {
+		expr, err := ParseExpr("{net} * 1.13 + SUM({order.items[*].price}, {net}, {order.tax})")
+		So(err, ShouldBeNil)
+		So(References(expr), ShouldResemble, []string{"net", "order"})
+
+		expr, err = ParseExpr("LET({x}, {x} + {y}, {z}, {x.a} * 2, {x} + {z}) + {z}")
+		So(err, ShouldBeNil)
+		So(References(expr), ShouldResemble, []string{"x", "y", "z"})
+	})
+
+	Convey("names bound by LET", t, func() {
+		sheet := NewSheet()
+		So(sheet.Set("total", "LET({total}, 1, {total} + 1)"), ShouldBeNil)
+		So(sheet.Set("x", "{y} + 1"), ShouldBeNil)
+		So(sheet.Set("y", "LET({x}, 2, {x} * 3)"), ShouldBeNil)
+		So(sheet.Dependencies("y"), ShouldBeEmpty)
+		_, err := sheet.Recalculate(context.Background())
+		So(err, ShouldBeNil)
+		total, err := sheet.Value("total")
+		So(err, ShouldBeNil)
+		So(total, ShouldEqual, 2)
+		x, err := sheet.Value("x")
+		So(err, ShouldBeNil)
+		So(x, ShouldEqual, 7)
+	})
+
+	Convey("topological evaluation", t, func() {
+		sheet := NewSheet()
+		So(sheet.Set("gross", "{net} * 1.13"), ShouldBeNil)
+		So(sheet.Set("net", "{price} * {qty}"), ShouldBeNil)
+		So(sheet.Set("label", `"total " & {gross}`), ShouldBeNil)
+		So(sheet.Set("shipping", "IF({qty} > 10, 0, 5)"), ShouldBeNil)
+		sheet.SetInputs(map[string]interface{}{"price": 10, "qty": 2})
+
+		So(sheet.Order(), ShouldResemble, []string{"net", "gross", "label", "shipping"})
+		So(sheet.Dependents("net"), ShouldResemble, []string{"gross", "label"})
+		So(sheet.Dependencies("gross"), ShouldResemble, []string{"net"})
+
+		calculated, err := sheet.Recalculate(context.Background())
+		So(err, ShouldBeNil)
+		So(calculated, ShouldResemble, []string{"net", "gross", "label", "shipping"})
+		gross, err := sheet.Value("gross")
+		So(err, ShouldBeNil)
+		So(gross, ShouldAlmostEqual, 22.6)
+
+		calculated, err = sheet.Recalculate(context.Background())
+		So(err, ShouldBeNil)
+		So(calculated, ShouldBeEmpty)
+
+		sheet.SetInput("price", 20)
+		calculated, err = sheet.Recalculate(context.Background())
+		So(err, ShouldBeNil)
+		So(calculated, ShouldResemble, []string{"net", "gross", "label"})
+		net, _ := sheet.Value("net")
+		So(net, ShouldEqual, 40.0)
+
+		So(sheet.Set("gross", "{net} * 1.2"), ShouldBeNil)
+		calculated, err = sheet.Recalculate(context.Background())
+		So(err, ShouldBeNil)
+		So(calculated, ShouldResemble, []string{"gross", "label"})
+		label, _ := sheet.Value("label")
+		So(label, ShouldEqual, "total 48")
+
+		sheet.Delete("net")
+		calculated, err = sheet.Recalculate(context.Background())
+		So(err, ShouldBeNil)
+		So(calculated, ShouldResemble, []string{"gross", "label"})
+		gross, err = sheet.Value("gross")
+		So(err, ShouldBeNil)
+		So(gross, ShouldBeNil)
+	})
+
+	Convey("cycles", t, func() {
+		sheet := NewSheet()
+		So(sheet.Set("a", "{b} + 1"), ShouldBeNil)
+		So(sheet.Set("b", "{c} + 1"), ShouldBeNil)
+		err := sheet.Set("c", "{a} + {input}")
+		So(errors.Is(err, ErrCircularReference), ShouldBeTrue)
+		var cycleErr *CycleError
+		So(errors.As(err, &cycleErr), ShouldBeTrue)
+		So(cycleErr.Cycle, ShouldResemble, []string{"c", "a", "b", "c"})
+		So(err.Error(), ShouldEqual, "circular reference: c -> a -> b -> c")
+
+		err = sheet.Set("d", "{d} * 2")
+		So(err.Error(), ShouldEqual, "circular reference: d -> d")
+		So(sheet.Order(), ShouldResemble, []string{"b", "a"})
+	})
+
+	Convey("errors propagate to dependents", t, func() {
+		sheet := NewSheet(WithSheetEval(WithUndefined(UndefinedAsError), WithDecimal(2, RoundHalfUp)))
+		So(sheet.Set("rate", "{amount} / {count}"), ShouldBeNil)
+		So(sheet.Set("fee", "{rate} * 0.1"), ShouldBeNil)
+		sheet.SetInput("amount", 10)
+		_, err := sheet.Recalculate(context.Background())
+		So(errors.Is(err, ErrUndefinedVariable), ShouldBeTrue)
+		_, err = sheet.Value("fee")
+		So(errors.Is(err, ErrUndefinedVariable), ShouldBeTrue)
+
+		sheet.SetInput("count", 3)
+		calculated, err := sheet.Recalculate(context.Background())
+		So(err, ShouldBeNil)
+		So(calculated, ShouldResemble, []string{"rate", "fee"})
+		fee, err := sheet.Value("fee")
+		So(err, ShouldBeNil)
+		So(convertToText(fee), ShouldEqual, "0.333")
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -49,9 +51,33 @@ type bindConfig struct {
 	UnMarshalMapping map[string]reflect.Type
 }
 
+// Layout 描述类型字段与数据字段的排布方式
+type Layout int
+
+const (
+	// LayoutWrapped: {"type": "xxx", "data": {...}}
+	LayoutWrapped Layout = iota
+	// LayoutFlat: {"type": "xxx", ...}
+	LayoutFlat
+	// LayoutCustom: 由自定义 Wrapper 决定
+	LayoutCustom
+)
+
+func (l Layout) String() string {
+	switch l {
+	case LayoutWrapped:
+		return "wrapped"
+	case LayoutFlat:
+		return "flat"
+	default:
+		return "custom"
+	}
+}
+
 type BindOption struct {
 	TypeKey          string
 	ValueKey         string
+	Layout           Layout
 	Initializer      func(interface{}) interface{}
 	MarshalWrapper   func(typeKey, typeName, valueKey string, value any) ([]byte, error)
 	UnmarshalWrapper func(data []byte, typeKey, valueKey string) (typeName string, valueData []byte, err error)
@@ -357,6 +383,52 @@ func ParseFromJSON[T any](typeName string, data []byte) (G[T], error) {
 	return NG(v), nil
 }
 
+// Binding 是某个接口类型绑定配置的只读快照，用于文档/Schema 生成等内省场景
+type Binding struct {
+	Interface reflect.Type
+	TypeKey   string
+	ValueKey  string
+	Layout    Layout
+	// Types 类型别名 -> 具体类型
+	Types map[string]reflect.Type
+}
+
+// LookupBinding 查询接口类型的绑定配置 (无锁)
+func LookupBinding(typ reflect.Type) (Binding, bool) {
+	config := loadConfig(typ)
+	if config == nil {
+		return Binding{}, false
+	}
+	return newBinding(typ, config), true
+}
+
+// Bindings 返回全部绑定配置，按接口类型名排序
+func Bindings() []Binding {
+	configs := globalConfigs.Load().(configMap)
+	result := make([]Binding, 0, len(configs))
+	for typ, config := range configs {
+		result = append(result, newBinding(typ, config))
+	}
+	slices.SortFunc(result, func(a, b Binding) int {
+		return strings.Compare(a.Interface.String(), b.Interface.String())
+	})
+	return result
+}
+
+func newBinding(typ reflect.Type, config *bindConfig) Binding {
+	types := make(map[string]reflect.Type, len(config.UnMarshalMapping))
+	for k, v := range config.UnMarshalMapping {
+		types[k] = v
+	}
+	return Binding{
+		Interface: typ,
+		TypeKey:   config.Option.TypeKey,
+		ValueKey:  config.Option.ValueKey,
+		Layout:    config.Option.Layout,
+		Types:     types,
+	}
+}
+
 // 内部辅助
 func applyInitializer[T any](data T) T {
 	config := loadConfig(reflect.TypeFor[T]())
@@ -396,6 +468,7 @@ func WithWrapper(m func(typeKey, typeName, valueKey string, value any) ([]byte,
 	return func(opt *BindOption) {
 		opt.MarshalWrapper = m
 		opt.UnmarshalWrapper = u
+		opt.Layout = LayoutCustom
 	}
 }
 
@@ -468,10 +541,15 @@ func WithJSONHandler(m MarshalFunc, u UnmarshalFunc) OptionFunc {
 	return func(opt *BindOption) {
 		opt.MarshalWrapper = newDefaultMarshalWrapper(m)
 		opt.UnmarshalWrapper = newDefaultUnmarshalWrapper(u)
+		opt.Layout = LayoutWrapped
 	}
 }
 
 // WithFlatLayout 启用扁平化结构支持。
 func WithFlatLayout() OptionFunc {
-	return WithWrapper(newFlatMarshalWrapper(json.Marshal), newFlatUnmarshalWrapper(json.Unmarshal))
+	wrapper := WithWrapper(newFlatMarshalWrapper(json.Marshal), newFlatUnmarshalWrapper(json.Unmarshal))
+	return func(opt *BindOption) {
+		wrapper(opt)
+		opt.Layout = LayoutFlat
+	}
 }
@@ -82,6 +82,15 @@ func TestJsonQueryPath(t *testing.T) {
 		So(v, ShouldEqualArrayIgnorePos, `["chess","netflix"]`)
 		v = getValue("$.*.city")
 		So(v, ShouldEqualArrayIgnorePos, `["San Fracisco",null]`)
+		v = getValue("$.hobbies[*]")
+		So(v, ShouldEqualArrayIgnorePos, `["chess","netflix"]`)
+	})
+
+	Convey("ValidatePath", t, func() {
+		So(ValidatePath("$.hobbies[*]"), ShouldBeNil)
+		So(ValidatePath("order.items[0:2].price"), ShouldBeNil)
+		So(ValidatePath("$.hobbies[*1]"), ShouldNotBeNil)
+		So(ValidatePath("$.hobbies[0"), ShouldNotBeNil)
 	})
 
 }
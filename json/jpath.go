@@ -135,14 +135,24 @@ func buildJsonPath(path string) ([]jsonPath, error) {
 
 }
 
+// ValidatePath 校验路径语法
+func ValidatePath(path string) error {
+	_, err := buildJsonPath(path)
+	return err
+}
+
 func scanIndexedPath(scanner *pathScanner) (jsonPath, error) {
 	path := strings.Builder{}
 	path.WriteString("[")
 	preToken := token.ILLEGAL
 	slice := slicePath{}
+	wildcard := false
 	for {
 		_, tok, lit := scanner.Scan()
 		path.WriteString(lit)
+		if wildcard && tok != token.RBRACK && tok != token.EOF {
+			return nil, fmt.Errorf("invalid indexed path:%s", path.String())
+		}
 		switch tok {
 		case token.EOF:
 			return nil, fmt.Errorf("invalid indexed path eof:%s", path.String())
@@ -156,7 +166,16 @@ func scanIndexedPath(scanner *pathScanner) (jsonPath, error) {
 
 		case token.COLON:
 			slice.AddColon()
+		case token.MUL:
+			// [*] 等价于 .*
+			if preToken != token.ILLEGAL {
+				return nil, fmt.Errorf("invalid indexed path:%s", path.String())
+			}
+			wildcard = true
 		case token.RBRACK:
+			if wildcard {
+				return wildcardPath("*"), nil
+			}
 			// todo 这边还需要更精细的判定
 			return slice.build(), nil
 		case token.SUB: